@@ -0,0 +1,192 @@
+package mapreduce
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+type accumulatorsKey struct{}
+
+// Accumulators stores the named accumulators of a calculation. Each
+// accumulator is either a sum, a max or a set. Accumulators from several
+// nodes are combined via Merge(). It is safe to use from several goroutines.
+type Accumulators struct {
+	mu    sync.Mutex
+	sums  map[string]int64
+	maxes map[string]int64
+	sets  map[string]map[string]bool
+}
+
+// NewAccumulators returns a new Accumulators.
+func NewAccumulators() *Accumulators {
+	return &Accumulators{
+		sums:  make(map[string]int64),
+		maxes: make(map[string]int64),
+		sets:  make(map[string]map[string]bool),
+	}
+}
+
+// AddSum adds delta to the named sum.
+func (a *Accumulators) AddSum(name string, delta int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sums[name] += delta
+}
+
+// AddMax stores value in the named max if it is larger than the current one.
+func (a *Accumulators) AddMax(name string, value int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addMax(name, value)
+}
+
+// AddSet adds the members to the named set.
+func (a *Accumulators) AddSet(name string, members ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addSet(name, members...)
+}
+
+// Sum returns the named sum.
+func (a *Accumulators) Sum(name string) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sums[name]
+}
+
+// Max returns the named max. It returns false if nothing was added to it.
+func (a *Accumulators) Max(name string) (max int64, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	max, ok = a.maxes[name]
+	return max, ok
+}
+
+// Set returns the sorted members of the named set.
+func (a *Accumulators) Set(name string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var members []string
+	for member := range a.sets[name] {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// AccumulatorValues is a snapshot of Accumulators. Unlike Accumulators it
+// is plain data, so a Network implementation can ship it between nodes.
+type AccumulatorValues struct {
+	Sums  map[string]int64
+	Maxes map[string]int64
+	Sets  map[string][]string
+}
+
+// Values returns a snapshot of the accumulators.
+func (a *Accumulators) Values() AccumulatorValues {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	v := AccumulatorValues{
+		Sums:  make(map[string]int64, len(a.sums)),
+		Maxes: make(map[string]int64, len(a.maxes)),
+		Sets:  make(map[string][]string, len(a.sets)),
+	}
+	for name, sum := range a.sums {
+		v.Sums[name] = sum
+	}
+	for name, max := range a.maxes {
+		v.Maxes[name] = max
+	}
+	for name, members := range a.sets {
+		for member := range members {
+			v.Sets[name] = append(v.Sets[name], member)
+		}
+		sort.Strings(v.Sets[name])
+	}
+	return v
+}
+
+// MergeValues combines the given values into a. A Network implementation
+// uses it to aggregate the accumulators of a remote node.
+func (a *Accumulators) MergeValues(v AccumulatorValues) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, delta := range v.Sums {
+		a.sums[name] += delta
+	}
+
+	for name, value := range v.Maxes {
+		a.addMax(name, value)
+	}
+
+	for name, members := range v.Sets {
+		a.addSet(name, members...)
+	}
+}
+
+// Merge combines the other accumulators into a. The other accumulators are
+// snapshotted before a is locked, so a.Merge(b) and b.Merge(a) can run at
+// the same time.
+func (a *Accumulators) Merge(other *Accumulators) {
+	a.MergeValues(other.Values())
+}
+
+func (a *Accumulators) addMax(name string, value int64) {
+	if max, ok := a.maxes[name]; ok && max >= value {
+		return
+	}
+	a.maxes[name] = value
+}
+
+func (a *Accumulators) addSet(name string, members ...string) {
+	if a.sets[name] == nil {
+		a.sets[name] = make(map[string]bool)
+	}
+
+	for _, member := range members {
+		a.sets[name][member] = true
+	}
+}
+
+// AccumulateSum adds delta to the named sum of the calculation. It does
+// nothing if the context does not belong to a calculation.
+func AccumulateSum(ctx context.Context, name string, delta int64) {
+	if a := AccumulatorsFrom(ctx); a != nil {
+		a.AddSum(name, delta)
+	}
+}
+
+// AccumulateMax updates the named max of the calculation. It does nothing if
+// the context does not belong to a calculation.
+func AccumulateMax(ctx context.Context, name string, value int64) {
+	if a := AccumulatorsFrom(ctx); a != nil {
+		a.AddMax(name, value)
+	}
+}
+
+// AccumulateSet adds the members to the named set of the calculation. It
+// does nothing if the context does not belong to a calculation.
+func AccumulateSet(ctx context.Context, name string, members ...string) {
+	if a := AccumulatorsFrom(ctx); a != nil {
+		a.AddSet(name, members...)
+	}
+}
+
+// AccumulatorsFrom returns the Accumulators stored in the context. It
+// returns nil if there are none.
+func AccumulatorsFrom(ctx context.Context) *Accumulators {
+	a, _ := ctx.Value(accumulatorsKey{}).(*Accumulators)
+	return a
+}
+
+// WithAccumulators returns a context that stores the given Accumulators. A
+// Network implementation uses it on the remote node before invoking the
+// Executor.
+func WithAccumulators(ctx context.Context, a *Accumulators) context.Context {
+	return context.WithValue(ctx, accumulatorsKey{}, a)
+}
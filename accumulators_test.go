@@ -0,0 +1,100 @@
+package mapreduce_test
+
+import (
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TA struct {
+	*testing.T
+	a *mapreduce.Accumulators
+}
+
+func TestAccumulators(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TA {
+		a := mapreduce.NewAccumulators()
+		a.AddSum("some-sum", 1)
+		a.AddMax("some-max", 5)
+		a.AddSet("some-set", "a")
+
+		return TA{
+			T: t,
+			a: a,
+		}
+	})
+
+	o.Group("when merging other accumulators", func() {
+		o.BeforeEach(func(t TA) TA {
+			other := mapreduce.NewAccumulators()
+			other.AddSum("some-sum", 2)
+			other.AddMax("some-max", 3)
+			other.AddMax("other-max", 7)
+			other.AddSet("some-set", "b")
+
+			t.a.Merge(other)
+			return t
+		})
+
+		o.Spec("it adds the sums", func(t TA) {
+			Expect(t, t.a.Sum("some-sum")).To(Equal(int64(3)))
+		})
+
+		o.Spec("it keeps the largest max", func(t TA) {
+			max, _ := t.a.Max("some-max")
+			Expect(t, max).To(Equal(int64(5)))
+
+			max, ok := t.a.Max("other-max")
+			Expect(t, ok).To(BeTrue())
+			Expect(t, max).To(Equal(int64(7)))
+		})
+
+		o.Spec("it unions the sets", func(t TA) {
+			Expect(t, t.a.Set("some-set")).To(Equal([]string{"a", "b"}))
+		})
+	})
+
+	o.Spec("it merges a snapshot of its values", func(t TA) {
+		v := t.a.Values()
+		Expect(t, v.Sums).To(Equal(map[string]int64{"some-sum": 1}))
+		Expect(t, v.Maxes).To(Equal(map[string]int64{"some-max": 5}))
+		Expect(t, v.Sets).To(Equal(map[string][]string{"some-set": {"a"}}))
+
+		other := mapreduce.NewAccumulators()
+		other.MergeValues(v)
+		other.MergeValues(v)
+		Expect(t, other.Sum("some-sum")).To(Equal(int64(2)))
+		max, _ := other.Max("some-max")
+		Expect(t, max).To(Equal(int64(5)))
+		Expect(t, other.Set("some-set")).To(Equal([]string{"a"}))
+	})
+
+	o.Spec("it merges accumulators into each other concurrently", func(t TA) {
+		other := mapreduce.NewAccumulators()
+		other.AddSum("some-sum", 2)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				other.Merge(t.a)
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			t.a.Merge(other)
+		}
+		<-done
+	})
+
+	o.Spec("it reports a max that was never added", func(t TA) {
+		_, ok := t.a.Max("unknown")
+		Expect(t, ok).To(BeFalse())
+	})
+}
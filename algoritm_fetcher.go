@@ -20,3 +20,16 @@ func (f AlgFetcherMap) Alg(name string, meta []byte) (Algorithm, error) {
 
 	return alg, nil
 }
+
+// Validate returns an error if any of the algorithms are incomplete. It is
+// useful to call right after building the map so that a missing Mapper or
+// Reducer is caught before any calculation is started.
+func (f AlgFetcherMap) Validate() error {
+	for name, alg := range f {
+		if err := alg.Validate(); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	return nil
+}
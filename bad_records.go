@@ -0,0 +1,52 @@
+package mapreduce
+
+import "golang.org/x/net/context"
+
+type badRecordPolicyKey struct{}
+
+// BadRecordPolicy decides what happens to a record that is corrupt (see
+// CorruptRecordError) or otherwise invalid, or that the Mapper returns an
+// error for. A FileSystem reports an invalid record by returning an error
+// with a BadRecord() []byte method from its reader.
+type BadRecordPolicy int
+
+const (
+	// FailOnBadRecords fails the calculation. It is the default.
+	FailOnBadRecords BadRecordPolicy = iota
+
+	// SkipBadRecords leaves the record out of the calculation and counts it
+	// in the SkippedRecordsCounter.
+	SkipBadRecords
+
+	// QuarantineBadRecords skips the record like SkipBadRecords and also
+	// writes it to the quarantine. It is set via WithQuarantine().
+	QuarantineBadRecords
+)
+
+// SkippedRecordsCounter is the counter (see Job.Counters()) that holds the
+// number of records that were left out due to SkipBadRecords or
+// QuarantineBadRecords.
+const SkippedRecordsCounter = "mapreduce.skipped-records"
+
+// WithBadRecords sets the policy for bad records. By default a single bad
+// record fails the calculation.
+func WithBadRecords(p BadRecordPolicy) MapReduceOption {
+	return func(r *MapReduce) {
+		r.badRecords = p
+	}
+}
+
+// BadRecordPolicyFrom returns the policy for bad records that is stored in
+// the context. A Network implementation uses it to ship the policy to the
+// remote node.
+func BadRecordPolicyFrom(ctx context.Context) BadRecordPolicy {
+	p, _ := ctx.Value(badRecordPolicyKey{}).(BadRecordPolicy)
+	return p
+}
+
+// WithBadRecordPolicy returns a context that stores the given policy for bad
+// records. A Network implementation uses it on the remote node before
+// invoking the Executor.
+func WithBadRecordPolicy(ctx context.Context, p BadRecordPolicy) context.Context {
+	return context.WithValue(ctx, badRecordPolicyKey{}, p)
+}
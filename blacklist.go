@@ -0,0 +1,119 @@
+package mapreduce
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WithBlacklist excludes the nodes that the Blacklist currently excludes and
+// reports each node that fails a file to it. A file that is only available on
+// excluded nodes still uses them.
+func WithBlacklist(b *Blacklist) MapReduceOption {
+	return func(r *MapReduce) {
+		r.blacklist = b
+	}
+}
+
+// Blacklist tracks the failures of each node across calculations. Each
+// failure adds 1 to the score of the node and the score halves for every
+// half life that passes without one. A node is excluded while its score is at least the threshold, so it
+// is reinstated automatically once it stops failing. It is safe for
+// concurrent use, so it can be shared by every calculation.
+//
+// It should be created with NewBlacklist().
+type Blacklist struct {
+	threshold float64
+	halfLife  time.Duration
+
+	mu     sync.Mutex
+	scores map[string]blacklistScore
+}
+
+type blacklistScore struct {
+	value   float64
+	updated time.Time
+}
+
+// NewBlacklist returns a new Blacklist. For example, a threshold of 3 and a
+// half life of a minute excludes a node that failed 3 times in quick
+// succession for about a minute.
+func NewBlacklist(threshold float64, halfLife time.Duration) *Blacklist {
+	return &Blacklist{
+		threshold: threshold,
+		halfLife:  halfLife,
+		scores:    make(map[string]blacklistScore),
+	}
+}
+
+// Failed records a failure of the node.
+func (b *Blacklist) Failed(nodeID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.scores[nodeID] = blacklistScore{
+		value:   b.score(nodeID, now) + 1,
+		updated: now,
+	}
+}
+
+// Excluded reports whether the node is currently excluded.
+func (b *Blacklist) Excluded(nodeID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.score(nodeID, time.Now()) >= b.threshold
+}
+
+// Nodes returns the nodes that are currently excluded.
+func (b *Blacklist) Nodes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var nodeIDs []string
+	for nodeID := range b.scores {
+		if b.score(nodeID, now) >= b.threshold {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs
+}
+
+// score returns the decayed score of the node. Scores that decayed to
+// nothing are forgotten.
+func (b *Blacklist) score(nodeID string, now time.Time) float64 {
+	s, ok := b.scores[nodeID]
+	if !ok {
+		return 0
+	}
+
+	value := s.value
+	if b.halfLife > 0 {
+		value *= math.Pow(0.5, math.Floor(float64(now.Sub(s.updated))/float64(b.halfLife)))
+	}
+
+	if value < 0.01 {
+		delete(b.scores, nodeID)
+		return 0
+	}
+	return value
+}
+
+// available filters out the excluded nodes. If every node is excluded, the
+// node IDs are returned as is.
+func (b *Blacklist) available(ids []string) []string {
+	var available []string
+	for _, id := range ids {
+		if !b.Excluded(id) {
+			available = append(available, id)
+		}
+	}
+
+	if len(available) == 0 {
+		return ids
+	}
+	return available
+}
@@ -0,0 +1,50 @@
+package mapreduce_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TB struct {
+	*testing.T
+	blacklist *mapreduce.Blacklist
+}
+
+func TestBlacklist(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TB {
+		return TB{
+			T:         t,
+			blacklist: mapreduce.NewBlacklist(2, 20*time.Millisecond),
+		}
+	})
+
+	o.Spec("it does not exclude a node below the threshold", func(t TB) {
+		t.blacklist.Failed("id-a")
+		Expect(t, t.blacklist.Excluded("id-a")).To(BeFalse())
+	})
+
+	o.Spec("it excludes a node that keeps failing", func(t TB) {
+		t.blacklist.Failed("id-a")
+		t.blacklist.Failed("id-a")
+		Expect(t, t.blacklist.Excluded("id-a")).To(BeTrue())
+		Expect(t, t.blacklist.Excluded("id-b")).To(BeFalse())
+		Expect(t, t.blacklist.Nodes()).To(Equal([]string{"id-a"}))
+	})
+
+	o.Spec("it reinstates a node once the failures decay", func(t TB) {
+		t.blacklist.Failed("id-a")
+		t.blacklist.Failed("id-a")
+		time.Sleep(30 * time.Millisecond)
+		Expect(t, t.blacklist.Excluded("id-a")).To(BeFalse())
+		Expect(t, t.blacklist.Nodes()).To(HaveLen(0))
+	})
+}
@@ -0,0 +1,174 @@
+package mapreduce
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Cache stores the Results of previous calculations. It has to be safe for
+// concurrent use.
+type Cache interface {
+	// Get returns the Results stored for the key.
+	Get(key string) (results Results, ok bool)
+
+	// Set stores the Results for the key.
+	Set(key string, results Results)
+}
+
+// WithCache makes Calculate return cached Results for repeated calculations
+// with the same route, algorithm name and meta information. The options that
+// change what is calculated (e.g., WithNodes, WithSideInput, WithSplitSize
+// or WithBadRecords), the version of the algorithm and the files with their
+// size and modification time (see StatFileSystem) are part of the key as
+// well, so changed inputs are calculated again. A calculation with
+// WithConvergence is never cached, as its predicate cannot be part of the
+// key, and neither is one with an OutputReducer, as the Cache does not hold
+// its side outputs. A cache hit still writes WithOutputFile. Pass a nil
+// Cache to Calculate to bypass the cache for a single calculation.
+func WithCache(c Cache) MapReduceOption {
+	return func(r *MapReduce) {
+		r.cache = c
+	}
+}
+
+// CacheKey returns a key for the calculation of the route with the algorithm
+// and meta information. It only covers those, so it does not tell apart
+// calculations with different options or inputs like the key Calculate uses
+// does (see WithCache).
+func CacheKey(route, algName string, meta []byte) string {
+	return hashParts([]byte(route), []byte(algName), meta)
+}
+
+// hashParts returns the hex encoded hash of the parts. Each part is prefixed
+// with its length, so that the boundaries between them count.
+func hashParts(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		binary.Write(h, binary.BigEndian, uint32(len(part)))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKey returns the key Calculate uses for the Cache (see WithCache). It
+// is derived from the same Algorithm and files that are calculated.
+func (r MapReduce) cacheKey(routes []string, algName string, alg Algorithm, files map[string][]string, ctx context.Context, meta []byte) (string, error) {
+	parts := [][]byte{
+		[]byte(strings.Join(routes, "\x00")),
+		[]byte(algName),
+		meta,
+		[]byte(alg.Version),
+		[]byte(fmt.Sprintf("recursive=%t split-size=%d bad-records=%d quarantine=%s max-reduce-iterations=%d", r.recursive, r.splitSize, r.badRecords, r.quarantinePrefix, r.maxReduceIterations)),
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statter, _ := r.fs.(StatFileSystem)
+	for _, name := range names {
+		parts = append(parts, []byte(name))
+		if statter == nil {
+			continue
+		}
+
+		info, err := statter.Stat(name, ctx, meta)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, []byte(fmt.Sprintf("%d %d", info.Size, info.ModTime.UnixNano())))
+	}
+
+	var nodeIDs []string
+	for id := range r.nodes {
+		nodeIDs = append(nodeIDs, id)
+	}
+	sort.Strings(nodeIDs)
+	parts = append(parts, []byte(fmt.Sprintf("nodes=%q", nodeIDs)))
+
+	var sideInputs []string
+	for name := range r.sideInputs {
+		sideInputs = append(sideInputs, name)
+	}
+	sort.Strings(sideInputs)
+	for _, name := range sideInputs {
+		parts = append(parts, []byte(name), r.sideInputs[name])
+	}
+
+	return hashParts(parts...), nil
+}
+
+// MemoryCache is an in-memory Cache whose entries expire after a TTL.
+type MemoryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	results Results
+	expires time.Time
+}
+
+// NewMemoryCache returns a new MemoryCache. A TTL of 0 never expires
+// entries.
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		entries: make(map[string]memoryCacheEntry),
+	}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(key string) (Results, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.results.clone(), true
+}
+
+// Set implements Cache.
+func (c *MemoryCache) Set(key string, results Results) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = memoryCacheEntry{
+		results: results.clone(),
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// Invalidate removes the entry for the key.
+func (c *MemoryCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Purge removes every entry.
+func (c *MemoryCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]memoryCacheEntry)
+}
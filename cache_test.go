@@ -0,0 +1,65 @@
+package mapreduce_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TC struct {
+	*testing.T
+	c *mapreduce.MemoryCache
+}
+
+func TestMemoryCache(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TC {
+		c := mapreduce.NewMemoryCache(time.Minute)
+		c.Set("some-key", mapreduce.Results{"a": []byte("b")})
+
+		return TC{
+			T: t,
+			c: c,
+		}
+	})
+
+	o.Spec("it returns the stored results", func(t TC) {
+		results, ok := t.c.Get("some-key")
+		Expect(t, ok).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{"a": []byte("b")}))
+	})
+
+	o.Spec("it does not share the stored results", func(t TC) {
+		results, _ := t.c.Get("some-key")
+		results["c"] = []byte("d")
+
+		results, _ = t.c.Get("some-key")
+		Expect(t, results).To(Equal(mapreduce.Results{"a": []byte("b")}))
+	})
+
+	o.Spec("it does not return invalidated results", func(t TC) {
+		t.c.Invalidate("some-key")
+		_, ok := t.c.Get("some-key")
+		Expect(t, ok).To(BeFalse())
+	})
+
+	o.Spec("it does not return expired results", func(t TC) {
+		c := mapreduce.NewMemoryCache(time.Nanosecond)
+		c.Set("some-key", mapreduce.Results{})
+		time.Sleep(time.Millisecond)
+
+		_, ok := c.Get("some-key")
+		Expect(t, ok).To(BeFalse())
+	})
+
+	o.Spec("it uses distinct keys for distinct calculations", func(t TC) {
+		Expect(t, mapreduce.CacheKey("ab", "c", nil)).To(Not(Equal(mapreduce.CacheKey("a", "bc", nil))))
+	})
+}
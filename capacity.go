@@ -0,0 +1,102 @@
+package mapreduce
+
+import (
+	"math"
+
+	"golang.org/x/net/context"
+)
+
+// Capacity reports the relative capacity of the nodes (e.g., their number of
+// cores or their memory). It has to be safe for concurrent use.
+type Capacity interface {
+	// Capacities returns the capacity of each node ID. A node that is missing
+	// has a capacity of 1.
+	Capacities(ctx context.Context) (map[string]float64, error)
+}
+
+// CapacityFunc wraps a function into a Capacity.
+type CapacityFunc func(ctx context.Context) (map[string]float64, error)
+
+// Capacities implements Capacity.
+func (f CapacityFunc) Capacities(ctx context.Context) (map[string]float64, error) {
+	return f(ctx)
+}
+
+// StaticCapacity returns a Capacity that always reports the given
+// capacities.
+func StaticCapacity(capacities map[string]float64) Capacity {
+	return CapacityFunc(func(ctx context.Context) (map[string]float64, error) {
+		return capacities, nil
+	})
+}
+
+// WithCapacity assigns the files (or splits) of a calculation to the nodes
+// in proportion to the capacity that c reports when the calculation is
+// started, instead of at random. A node with twice the capacity calculates
+// about twice the bytes (see WithSplitSize), or twice the files if they are
+// not split.
+func WithCapacity(c Capacity) MapReduceOption {
+	return func(r *MapReduce) {
+		r.capacity = c
+	}
+}
+
+// balancer assigns work to the node with the least load relative to its
+// capacity.
+type balancer struct {
+	capacities map[string]float64
+	load       map[string]float64
+}
+
+// balance returns a balancer for the reported capacities. It returns nil if
+// there is no Capacity.
+func (r MapReduce) balance(ctx context.Context) (*balancer, error) {
+	if r.capacity == nil {
+		return nil, nil
+	}
+
+	capacities, err := r.capacity.Capacities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &balancer{
+		capacities: capacities,
+		load:       make(map[string]float64),
+	}, nil
+}
+
+// assign returns the node that is least loaded once it took on the given
+// weight and adds the weight to its load.
+func (b *balancer) assign(nodeIDs []string, weight float64) string {
+	var (
+		best      string
+		bestScore = math.Inf(1)
+	)
+	for _, id := range nodeIDs {
+		capacity, ok := b.capacities[id]
+		if !ok {
+			capacity = 1
+		}
+
+		score := math.Inf(1)
+		if capacity > 0 {
+			score = (b.load[id] + weight) / capacity
+		}
+
+		if best == "" || score < bestScore {
+			best, bestScore = id, score
+		}
+	}
+
+	b.load[best] += weight
+	return best
+}
+
+// weight returns the amount of work of a split. A whole file counts as 1.
+func weight(split *Split) float64 {
+	if split == nil {
+		return 1
+	}
+	return float64(split.End - split.Start)
+}
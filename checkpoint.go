@@ -0,0 +1,177 @@
+package mapreduce
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// WithCheckpoints periodically writes the files (or splits) that were
+// calculated and the values merged from them to a file below the given
+// prefix, named after the Job's ID. If the coordinator crashes, the
+// calculation is continued with Resume(), which only calculates the
+// remaining files with the options of the checkpoint. A checkpoint is also written once every file was
+// calculated. The FileSystem has to be a WriteFileSystem. Checkpoints cannot
+// be combined with WithShuffle, as the shuffled values are held by the
+// nodes.
+func WithCheckpoints(prefix string, interval time.Duration) MapReduceOption {
+	return func(r *MapReduce) {
+		r.checkpointPrefix = prefix
+		r.checkpointInterval = interval
+	}
+}
+
+// checkpoint is the state of a calculation that is written by WithCheckpoints.
+// It is stored as a single record encoded as JSON.
+type checkpoint struct {
+	Routes []string `json:"routes"`
+	Alg    string   `json:"alg"`
+	Meta   []byte   `json:"meta,omitempty"`
+
+	// Files holds the files that were selected (see WithPartitionFilter).
+	// The other fields hold the options that decide how they are read.
+	Files            []string          `json:"files,omitempty"`
+	Recursive        bool              `json:"recursive,omitempty"`
+	SplitSize        uint64            `json:"split_size,omitempty"`
+	SideInputs       map[string][]byte `json:"side_inputs,omitempty"`
+	BadRecords       BadRecordPolicy   `json:"bad_records,omitempty"`
+	QuarantinePrefix string            `json:"quarantine_prefix,omitempty"`
+
+	// Completed holds the idempotency key of each file (or split) that was
+	// calculated.
+	Completed []string `json:"completed,omitempty"`
+
+	// Values holds the values that were merged from the completed files.
+	Values map[string][][]byte `json:"values,omitempty"`
+}
+
+// Resume continues the calculation of the Job with the given ID from its
+// last checkpoint (see WithCheckpoints). The routes, algorithm and meta
+// information are taken from the checkpoint, and the files that were
+// calculated before are not calculated again. So are the files that were
+// selected, the split size, the side inputs and the handling of bad
+// records, which replace the ones of the given options. The same checkpoint
+// prefix has to be configured, either via New() or the given options.
+func (r MapReduce) Resume(jobID string, ctx context.Context, opts ...MapReduceOption) (*Job, error) {
+	for _, o := range opts {
+		o(&r)
+	}
+
+	if r.checkpointPrefix == "" {
+		return nil, fmt.Errorf("checkpoints are not configured")
+	}
+
+	cp, err := r.loadCheckpoint(jobID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cp.apply(&r)
+	r.resumeID = jobID
+	r.resumed = cp
+	r.log.Printf("Resuming %s with %d completed files", jobID, len(cp.Completed))
+	return r.submit(cp.Routes, cp.Alg, ctx, cp.Meta, nil, nil, false)
+}
+
+// newCheckpoint returns the checkpoint of a calculation of the given files.
+func (r MapReduce) newCheckpoint(routes []string, algName string, meta []byte, files map[string][]string) *checkpoint {
+	cp := &checkpoint{
+		Routes:           routes,
+		Alg:              algName,
+		Meta:             meta,
+		Recursive:        r.recursive,
+		SplitSize:        r.splitSize,
+		SideInputs:       r.sideInputs,
+		BadRecords:       r.badRecords,
+		QuarantinePrefix: r.quarantinePrefix,
+	}
+
+	for fileName := range files {
+		cp.Files = append(cp.Files, fileName)
+	}
+	sort.Strings(cp.Files)
+	return cp
+}
+
+// apply configures the calculation with the options of the checkpoint. The
+// partition filter is not needed, as only the files of the checkpoint are
+// calculated (see selected).
+func (cp *checkpoint) apply(r *MapReduce) {
+	r.recursive = cp.Recursive
+	r.splitSize = cp.SplitSize
+	r.sideInputs = cp.SideInputs
+	r.badRecords = cp.BadRecords
+	r.quarantinePrefix = cp.QuarantinePrefix
+	r.partitionFilter = nil
+}
+
+// selected reports whether the file was selected by the calculation. A
+// checkpoint without files (e.g., of a calculation without any) selects
+// every file.
+func (cp *checkpoint) selected(fileName string) bool {
+	if len(cp.Files) == 0 {
+		return true
+	}
+
+	i := sort.SearchStrings(cp.Files, fileName)
+	return i < len(cp.Files) && cp.Files[i] == fileName
+}
+
+// checkpointFile returns the name of the checkpoint of the Job.
+func (r MapReduce) checkpointFile(jobID string) string {
+	return path.Join(r.checkpointPrefix, jobID)
+}
+
+// loadCheckpoint reads the checkpoint of the Job.
+func (r MapReduce) loadCheckpoint(jobID string, ctx context.Context) (*checkpoint, error) {
+	reader, err := r.fs.Reader(r.checkpointFile(jobID), ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint of %s: %s", jobID, err)
+	}
+
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint of %s: %s", jobID, err)
+	}
+	return cp, nil
+}
+
+// writeCheckpoint writes the checkpoint of the Job. A checkpoint that cannot
+// be written is logged, as the calculation itself is not affected.
+func (r MapReduce) writeCheckpoint(jobID string, cp *checkpoint, ctx context.Context) {
+	if err := r.storeCheckpoint(jobID, cp, ctx); err != nil {
+		r.log.Printf("Failed to write checkpoint of %s: %s", jobID, err)
+	}
+}
+
+func (r MapReduce) storeCheckpoint(jobID string, cp *checkpoint, ctx context.Context) error {
+	fs, ok := r.fs.(WriteFileSystem)
+	if !ok {
+		return fmt.Errorf("file system does not support writing")
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	writer, close, err := fs.Writer(r.checkpointFile(jobID), ctx, cp.Meta)
+	if err != nil {
+		return err
+	}
+
+	if err := writer(data); err != nil {
+		close()
+		return err
+	}
+	return close()
+}
@@ -0,0 +1,85 @@
+package mapreduce
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+type countersKey struct{}
+
+// Counters stores the named counters of a calculation (e.g., the number of
+// bad records). It is safe to use from several goroutines.
+type Counters struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+// NewCounters returns a new Counters.
+func NewCounters() *Counters {
+	return &Counters{
+		values: make(map[string]int64),
+	}
+}
+
+// Add adds delta to the named counter.
+func (c *Counters) Add(name string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[name] += delta
+}
+
+// Merge adds each of the given values to the according counter. A Network
+// implementation uses it to aggregate the counters of a remote node.
+func (c *Counters) Merge(values map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, delta := range values {
+		c.values[name] += delta
+	}
+}
+
+func (c *Counters) value(name string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[name]
+}
+
+// Values returns a copy of every counter.
+func (c *Counters) Values() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make(map[string]int64)
+	for name, value := range c.values {
+		values[name] = value
+	}
+	return values
+}
+
+// IncCounter increments the named counter of the calculation.
+func IncCounter(ctx context.Context, name string) {
+	AddCounter(ctx, name, 1)
+}
+
+// AddCounter adds delta to the named counter of the calculation. It does
+// nothing if the context does not belong to a calculation.
+func AddCounter(ctx context.Context, name string, delta int64) {
+	if c := CountersFrom(ctx); c != nil {
+		c.Add(name, delta)
+	}
+}
+
+// CountersFrom returns the Counters stored in the context. It returns nil if
+// there are none.
+func CountersFrom(ctx context.Context) *Counters {
+	c, _ := ctx.Value(countersKey{}).(*Counters)
+	return c
+}
+
+// WithCounters returns a context that stores the given Counters. A Network
+// implementation uses it on the remote node before invoking the Executor and
+// then merges the resulting values into the coordinator's Counters.
+func WithCounters(ctx context.Context, c *Counters) context.Context {
+	return context.WithValue(ctx, countersKey{}, c)
+}
@@ -0,0 +1,125 @@
+package mapreduce
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+// DivergedFilesCounter is the counter (see Job.Counters()) that holds the
+// number of files whose results differed between two nodes (see
+// WithCrossCheck).
+const DivergedFilesCounter = "mapreduce.diverged-files"
+
+// WithCrossCheck calculates each file (or split) on a second node that has it
+// as well and compares the digests of both results. A divergence points to
+// flaky hardware or a non-deterministic algorithm: it is logged, counted in
+// the DivergedFilesCounter and reported by Job.Divergences(). The result of
+// the first node is used either way. Files that only a single node has are
+// not cross-checked, and neither are calculations that shuffle, as their
+// values stay on the nodes. The second node runs alongside the merge and does
+// not take a slot of WithParallelism. Its counters and accumulators are not
+// added to the Job's.
+func WithCrossCheck() MapReduceOption {
+	return func(r *MapReduce) {
+		r.crossCheck = true
+	}
+}
+
+// Divergence describes a file (or split) whose results differed between two
+// nodes.
+type Divergence struct {
+	File  string
+	Split *Split
+	Nodes []string
+}
+
+// Divergences returns the files whose results differed between two nodes
+// (see WithCrossCheck).
+func (j *Job) Divergences() []Divergence {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Divergence(nil), j.divergences...)
+}
+
+func (j *Job) addDivergence(d Divergence) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.divergences = append(j.divergences, d)
+}
+
+// checkReplica calculates the assignment on another node than the one that
+// produced the result with the given digest and compares both. The replica
+// updates its own counters, accumulators and record counts, so that they are
+// not counted twice.
+func (r MapReduce) checkReplica(job *Job, a assignment, resultDigest []byte, nodeID, algName string, ctx context.Context, meta []byte) {
+	var other string
+	for _, id := range a.nodes {
+		if id != nodeID {
+			other = id
+			break
+		}
+	}
+
+	if other == "" {
+		return
+	}
+
+	replicaCtx := WithCounters(ctx, NewCounters())
+	replicaCtx = WithAccumulators(replicaCtx, NewAccumulators())
+	replicaCtx = WithRecordCounts(replicaCtx, NewCounters())
+	hashes := make(map[string][]byte)
+	err := r.executeOn(a.file, algName, other, replicaCtx, meta, func(batch map[string][]byte) {
+		for key, value := range batch {
+			hashes[key] = entryHash(key, value)
+		}
+	})
+	if err != nil {
+		r.log.Printf("Unable to cross-check file %s on %s: %s", a.file, other, err)
+		return
+	}
+
+	if bytes.Equal(resultDigest, digest(hashes)) {
+		return
+	}
+
+	r.log.Printf("Results of file %s diverged between %s and %s", a.file, nodeID, other)
+	AddCounter(ctx, DivergedFilesCounter, 1)
+	job.addDivergence(Divergence{
+		File:  a.file,
+		Split: a.split,
+		Nodes: []string{nodeID, other},
+	})
+}
+
+// entryHash returns the hash of a key and its value. The digest of a result
+// is built from the hashes of its keys, so that the result does not have to
+// be held to compute it.
+func entryHash(key string, value []byte) []byte {
+	h := sha256.New()
+	var size [binary.MaxVarintLen64]byte
+	h.Write(size[:binary.PutUvarint(size[:], uint64(len(key)))])
+	h.Write([]byte(key))
+	h.Write(size[:binary.PutUvarint(size[:], uint64(len(value)))])
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// digest returns a digest of the hashes of a result (see entryHash) that
+// does not depend on the order of its keys.
+func digest(hashes map[string][]byte) []byte {
+	keys := make([]string, 0, len(hashes))
+	for key := range hashes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write(hashes[key])
+	}
+	return h.Sum(nil)
+}
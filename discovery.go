@@ -0,0 +1,80 @@
+package mapreduce
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Discovery reports the nodes that are currently part of the cluster, so
+// that nodes joining or leaving are picked up without a restart. It is
+// usually backed by a service registry (e.g., Consul or etcd). It has to be
+// safe for concurrent use.
+type Discovery interface {
+	// Nodes returns the IDs of the nodes.
+	Nodes(ctx context.Context) ([]string, error)
+}
+
+// DiscoveryFunc wraps a function into a Discovery.
+type DiscoveryFunc func(ctx context.Context) ([]string, error)
+
+// Nodes implements Discovery.
+func (f DiscoveryFunc) Nodes(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// StaticNodes returns a Discovery that always reports the given nodes.
+func StaticNodes(nodeIDs ...string) Discovery {
+	return DiscoveryFunc(func(ctx context.Context) ([]string, error) {
+		return nodeIDs, nil
+	})
+}
+
+// SRVDiscovery returns a Discovery that looks up the nodes via the DNS SRV
+// records of the given service (see net.LookupSRV). Each node ID is the
+// host:port of a record.
+func SRVDiscovery(service, proto, name string) Discovery {
+	return DiscoveryFunc(func(ctx context.Context) ([]string, error) {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var nodeIDs []string
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			nodeIDs = append(nodeIDs, net.JoinHostPort(host, fmt.Sprint(r.Port)))
+		}
+		return nodeIDs, nil
+	})
+}
+
+// WithDiscovery restricts each calculation to the nodes that the Discovery
+// reports when the calculation is started. Files that are only available on
+// nodes that have left fail the calculation, like they do with WithNodes.
+func WithDiscovery(d Discovery) MapReduceOption {
+	return func(r *MapReduce) {
+		r.discovery = d
+	}
+}
+
+// discover returns the nodes that the Discovery reports. It returns nil if
+// there is no Discovery.
+func (r MapReduce) discover(ctx context.Context) (map[string]bool, error) {
+	if r.discovery == nil {
+		return nil, nil
+	}
+
+	nodeIDs, err := r.discovery.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	discovered := make(map[string]bool)
+	for _, id := range nodeIDs {
+		discovered[id] = true
+	}
+	return discovered, nil
+}
@@ -0,0 +1,112 @@
+package mapreduce_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type TD struct {
+	*testing.T
+	resolver *net.Resolver
+	conn     net.PacketConn
+}
+
+// TestDiscovery replaces net.DefaultResolver, so it does not run in
+// parallel.
+func TestDiscovery(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TD {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go serveSRV(conn, "_mapreduce._tcp.example.com.", []dnsmessage.SRVResource{
+			{Target: dnsmessage.MustNewName("node-a.example.com."), Port: 8080},
+			{Target: dnsmessage.MustNewName("node-b.example.com."), Port: 8081},
+		})
+
+		resolver := net.DefaultResolver
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+			},
+		}
+
+		return TD{
+			T:        t,
+			resolver: resolver,
+			conn:     conn,
+		}
+	})
+
+	o.AfterEach(func(t TD) {
+		net.DefaultResolver = t.resolver
+		t.conn.Close()
+	})
+
+	o.Spec("it reports the nodes of the SRV records", func(t TD) {
+		nodeIDs, err := mapreduce.SRVDiscovery("mapreduce", "tcp", "example.com.").Nodes(context.Background())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, nodeIDs).To(Equal([]string{"node-a.example.com:8080", "node-b.example.com:8081"}))
+	})
+
+	o.Spec("it returns an error for an unknown service", func(t TD) {
+		_, err := mapreduce.SRVDiscovery("unknown", "tcp", "example.com.").Nodes(context.Background())
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+// serveSRV answers the DNS queries for the SRV records of the name. Any
+// other name does not exist.
+func serveSRV(conn net.PacketConn, name string, records []dnsmessage.SRVResource) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+
+		header := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true}
+		if q.Name.String() != name {
+			header.RCode = dnsmessage.RCodeNameError
+		}
+
+		b := dnsmessage.NewBuilder(nil, header)
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		if header.RCode == dnsmessage.RCodeSuccess && q.Type == dnsmessage.TypeSRV {
+			for _, r := range records {
+				b.SRVResource(dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: 60}, r)
+			}
+		}
+
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		conn.WriteTo(msg, addr)
+	}
+}
@@ -1,87 +1,406 @@
 package mapreduce
 
 import (
+	"fmt"
+	"hash/crc32"
 	"io"
+	"sync"
 
 	"golang.org/x/net/context"
 )
 
+// ExecutorOption is used to configure a new Executor.
+type ExecutorOption func(*Executor)
+
 // Executor is used to apply algorithms to data. It maps and then returns the
 // reduced data from the given algorithm.
 //
 // An Executor has to be created with NewExecutor().
 type Executor struct {
-	algFetcher AlgorithmFetcher
-	fs         FileSystem
+	algFetcher  AlgorithmFetcher
+	fs          FileSystem
+	shuffler    Shuffler
+	partitioner Partitioner
+	readRetries int
+
+	mu       sync.Mutex
+	shuffled map[string]map[string]map[string][]byte
 }
 
 // NewExecutor returns a new Executor.
-func NewExecutor(algFetcher AlgorithmFetcher, fs FileSystem) *Executor {
-	return &Executor{
+func NewExecutor(algFetcher AlgorithmFetcher, fs FileSystem, opts ...ExecutorOption) *Executor {
+	e := &Executor{
 		algFetcher: algFetcher,
 		fs:         fs,
+		shuffled:   make(map[string]map[string]map[string][]byte),
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e
+}
+
+// WithReadRetries retries a read of a file that failed, up to n times per
+// record. The FileSystem has to implement SeekFileSystem: the reader seeks
+// back to the record that failed, so the records that were mapped already
+// are not read again. Reads are not retried by default.
+func WithReadRetries(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.readRetries = n
 	}
 }
 
 // Execute maps local data from the file (fileName) via the mapper given from the algorithm (algName) and reduces it.
 func (e *Executor) Execute(fileName, algName string, ctx context.Context, meta []byte) (result map[string][]byte, err error) {
-	alg, err := e.algFetcher.Alg(algName, meta)
+	result = make(map[string][]byte)
+	err = e.ExecuteStream(fileName, algName, ctx, meta, func(key string, value []byte) error {
+		result[key] = value
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return result, nil
+}
+
+// ExecuteStream is like Execute, but it invokes emit for each key as soon as
+// the key is reduced, so that the result does not have to be held by the
+// node. An error from emit stops the calculation. The keys of a calculation
+// that shuffles are sent to their nodes instead (see WithShuffler). The
+// side outputs of an OutputReducer cannot be returned, so the ReducePlan in
+// the context has to leave its reduction to the coordinator.
+func (e *Executor) ExecuteStream(fileName, algName string, ctx context.Context, meta []byte, emit func(key string, value []byte) error) error {
+	alg, err := e.algFetcher.Alg(algName, meta)
+	if err != nil {
+		return err
+	}
+
+	if err := alg.Validate(); err != nil {
+		return fmt.Errorf("%s: %s", algName, err)
+	}
+
+	if err := checkVersion(algName, alg, ctx); err != nil {
+		return err
+	}
+
+	plan, _ := ReducePlanFrom(ctx)
+	if err := checkOutputs(algName, alg, plan); err != nil {
+		return err
+	}
+
+	reader, err := e.reader(alg.Mapper, fileName, ctx, meta)
+	if err != nil {
+		return err
+	}
+
+	m, err := e.consumeFile(alg.Mapper, reader, fileName, ctx, meta)
+	if err != nil {
+		return err
+	}
+	countRecords(ctx, m)
+
+	if shufflePlan, ok := ShufflePlanFrom(ctx); ok {
+		result, err := combine(alg, plan, m)
+		if err != nil {
+			return err
+		}
+		return e.shuffle(shufflePlan, taskID(fileName, ctx), result, ctx)
+	}
+
+	for key, values := range m {
+		value, err := reduceKey(alg, plan, key, values)
+		if err != nil {
+			return err
+		}
+
+		delete(m, key)
+		if err := emit(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// combine reduces the values of each key to a single one (see reduceKey).
+func combine(alg Algorithm, plan ReducePlan, m map[string][][]byte) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	for key, values := range m {
+		value, err := reduceKey(alg, plan, key, values)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+// reduceKey reduces the values of the key to a single one, invoking the
+// Reducer at most plan.MaxIterations times. The values of an Unreduced plan
+// are joined instead (see joinValues).
+func reduceKey(alg Algorithm, plan ReducePlan, key string, values [][]byte) ([]byte, error) {
+	if plan.Unreduced {
+		return joinValues(values), nil
+	}
+
+	var err error
+	for i := 0; len(values) > 1; i++ {
+		if plan.MaxIterations > 0 && i >= plan.MaxIterations {
+			return nil, fmt.Errorf("%s: key %s did not converge after %d iterations", stageName(alg.Reducer, ReduceStage), key, plan.MaxIterations)
+		}
+
+		values, err = alg.Reduce(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[0], nil
+}
+
+// CorruptRecordError is returned when the checksum of a record does not
+// match its data (see ChecksumFileSystem).
+type CorruptRecordError struct {
+	File string
+
+	// Record is the index of the record within the file.
+	Record uint64
+
+	// Data holds the corrupt record.
+	Data []byte
+}
+
+// Error implements error.
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt record %d in %s: checksum mismatch", e.Record, e.File)
+}
+
+// BadRecord returns the corrupt record.
+func (e *CorruptRecordError) BadRecord() []byte {
+	return e.Data
+}
+
+// badRecordError is implemented by the errors a reader returns for a single
+// bad record, such as CorruptRecordError. The reader may be invoked again to
+// read the next record.
+type badRecordError interface {
+	error
+	BadRecord() []byte
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// reader returns a reader for the file, or for the split of it that is
+// stored in the context. The filter of a FilteredMapper is handed to a
+// FilterFileSystem. The records of a file that has checksums are verified
+// (see ChecksumFileSystem) and thus not filtered by the FileSystem. A split
+// of such a file can not be verified and fails.
+func (e *Executor) reader(mapper Mapper, fileName string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	split, ok := SplitFrom(ctx)
+	if !ok {
+		filter, ok := recordFilter(mapper)
+		if fs, isFilterFS := e.fs.(FilterFileSystem); ok && isFilterFS {
+			return e.verifiedReader(fileName, ctx, meta, func() (func() ([]byte, error), error) {
+				return fs.FilteredReader(fileName, filter, ctx, meta)
+			})
+		}
+
+		return e.verifiedReader(fileName, ctx, meta, func() (func() ([]byte, error), error) {
+			if fs, ok := e.fs.(SeekFileSystem); ok && e.readRetries > 0 {
+				return e.retryingReader(fs, fileName, ctx, meta)
+			}
+			return e.fs.Reader(fileName, ctx, meta)
+		})
+	}
+
+	fs, ok := e.fs.(RangeFileSystem)
+	if !ok {
+		return nil, fmt.Errorf("FileSystem does not support reading a split of %s", fileName)
+	}
 
-	reader, err := e.fs.Reader(fileName, ctx, meta)
+	checksums, err := e.hasChecksums(fileName, ctx, meta)
 	if err != nil {
 		return nil, err
 	}
 
-	m, err := e.consumeFile(alg, reader)
+	if checksums {
+		return nil, fmt.Errorf("FileSystem can not verify the checksums of a split of %s", fileName)
+	}
+	return fs.RangeReader(fileName, split.Start, split.End, ctx, meta)
+}
+
+// retryingReader returns a reader for the file that retries a failed read
+// (see WithReadRetries). Bad records are returned as they are, as the
+// Executor moves past them. The file is closed once the reader returns any
+// other error (including io.EOF).
+func (e *Executor) retryingReader(fs SeekFileSystem, fileName string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	next, seek, close, err := fs.Seeker(fileName, ctx, meta)
 	if err != nil {
 		return nil, err
 	}
 
-	result = make(map[string][]byte)
-	for key, values := range m {
-		for len(values) > 1 {
-			values, err = alg.Reduce(values)
-			if err != nil {
-				return nil, err
+	var record uint64
+	return func() ([]byte, error) {
+		data, err := next()
+		for retry := 0; err != nil && retry < e.readRetries; retry++ {
+			if _, bad := err.(badRecordError); bad || err == io.EOF || ctx.Err() != nil {
+				break
+			}
+
+			if seekErr := seek(record); seekErr != nil {
+				break
 			}
+			data, err = next()
 		}
 
-		if len(values) == 0 {
-			result[key] = nil
-			continue
+		if _, bad := err.(badRecordError); err != nil && !bad {
+			close()
+			return nil, err
 		}
 
-		result[key] = values[0]
+		record++
+		return data, err
+	}, nil
+}
+
+// verifiedReader returns a reader for the file. If the FileSystem stores
+// checksums for the file, each record is verified before it is returned.
+// Otherwise the unverified reader is used.
+func (e *Executor) verifiedReader(fileName string, ctx context.Context, meta []byte, unverified func() (func() ([]byte, error), error)) (func() ([]byte, error), error) {
+	fs, ok := e.fs.(ChecksumFileSystem)
+	if !ok {
+		return unverified()
 	}
 
-	return result, nil
+	reader, err := fs.ChecksumReader(fileName, ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if reader == nil {
+		return unverified()
+	}
+
+	var record uint64
+	return func() ([]byte, error) {
+		data, checksum, err := reader()
+		if err != nil {
+			return nil, err
+		}
+
+		record++
+		if crc32.Checksum(data, castagnoli) != checksum {
+			return nil, &CorruptRecordError{File: fileName, Record: record - 1, Data: data}
+		}
+		return data, nil
+	}, nil
+}
+
+// hasChecksums reports whether the FileSystem stores checksums for the file.
+func (e *Executor) hasChecksums(fileName string, ctx context.Context, meta []byte) (bool, error) {
+	fs, ok := e.fs.(ChecksumFileSystem)
+	if !ok {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reader, err := fs.ChecksumReader(fileName, ctx, meta)
+	if err != nil || reader == nil {
+		return false, err
+	}
+
+	// A reader stops once its context is done, which releases the file.
+	cancel()
+	reader()
+	return true, nil
 }
 
 // consumeFile maps data from the reader to the according keys.
-func (e *Executor) consumeFile(alg Mapper, reader func() ([]byte, error)) (map[string][][]byte, error) {
+func (e *Executor) consumeFile(mapper Mapper, reader func() ([]byte, error), fileName string, ctx context.Context, meta []byte) (map[string][][]byte, error) {
+	mapFn := mapper.Map
+	if contextMapper, ok := mapper.(ContextMapper); ok {
+		mapFn = func(value []byte) (string, []byte, error) {
+			return contextMapper.MapContext(ctx, value)
+		}
+	}
+
+	policy := BadRecordPolicyFrom(ctx)
+	var q *quarantine
+	if policy == QuarantineBadRecords {
+		q = newQuarantine(e.fs, fileName, ctx, meta)
+	}
+
+	// badRecord returns the error unless the policy skips bad records.
+	badRecord := func(record uint64, data []byte, err error) error {
+		if policy == FailOnBadRecords {
+			return err
+		}
+
+		IncCounter(ctx, SkippedRecordsCounter)
+		if q == nil {
+			return nil
+		}
+		return q.add(record, data, err)
+	}
+
+	m, err := e.mapRecords(mapFn, reader, badRecord, ctx)
+	if q == nil {
+		return m, err
+	}
+
+	if closeErr := q.finish(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// mapRecords maps each record from the reader. Bad records are handed to
+// badRecord.
+func (e *Executor) mapRecords(mapFn MapFunc, reader func() ([]byte, error), badRecord func(record uint64, data []byte, err error) error, ctx context.Context) (map[string][][]byte, error) {
 	m := make(map[string][][]byte)
-	for {
+	for record := uint64(0); ; record++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		data, err := reader()
 		if err == io.EOF {
 			return m, nil
 		}
 
+		if bad, ok := err.(badRecordError); ok {
+			if err := badRecord(record, bad.BadRecord(), err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		if err != nil {
 			return nil, err
 		}
 
-		key, data, err := alg.Map(data)
+		key, value, err := mapFn(data)
 		if err != nil {
-			return nil, err
+			if err := badRecord(record, data, err); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		if len(key) == 0 {
 			continue
 		}
 
-		m[key] = append(m[key], data)
+		m[key] = append(m[key], value)
 	}
 }
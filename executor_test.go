@@ -2,13 +2,20 @@ package mapreduce_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/poy/eachers/testhelpers"
 	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/fs/local"
+	"github.com/poy/mapreduce/fs/records"
 	"github.com/poy/onpar"
 	. "github.com/poy/onpar/expect"
 	. "github.com/poy/onpar/matchers"
@@ -17,10 +24,12 @@ import (
 type TE struct {
 	*testing.T
 	e              *mapreduce.Executor
+	fs             *fsfakes.InMemory
 	mockFileSystem *mockFileSystem
 	mockReducer    *mockReducer
 	mockMapper     *mockMapper
 	mockAlgFetcher *mockAlgorithmFetcher
+	dir            string
 }
 
 func TestExecutor(t *testing.T) {
@@ -31,7 +40,7 @@ func TestExecutor(t *testing.T) {
 	o.BeforeEach(func(t *testing.T) TE {
 		mockReducer := newMockReducer()
 		mockMapper := newMockMapper()
-		mockFileSystem := newMockFileSystem()
+		fs := fsfakes.NewInMemory()
 		mockAlgFetcher := newMockAlgorithmFetcher()
 
 		mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Mapper: mockMapper, Reducer: mockReducer}
@@ -41,22 +50,16 @@ func TestExecutor(t *testing.T) {
 			T:              t,
 			mockMapper:     mockMapper,
 			mockReducer:    mockReducer,
-			mockFileSystem: mockFileSystem,
-			e:              mapreduce.NewExecutor(mockAlgFetcher, mockFileSystem),
+			mockAlgFetcher: mockAlgFetcher,
+			fs:             fs,
+			e:              mapreduce.NewExecutor(mockAlgFetcher, fs),
 		}
 	})
 
 	o.Group("when the filesystem does not return an error", func() {
 		o.BeforeEach(func(t TE) TE {
-			results := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
-			t.mockFileSystem.ReaderOutput.Reader <- func() ([]byte, error) {
-				if len(results) == 0 {
-					return nil, io.EOF
-				}
-				defer func() { results = results[1:] }()
-				return results[0], nil
-			}
-			close(t.mockFileSystem.ReaderOutput.Err)
+			t.fs.Write("file", []byte("a"), []byte("b"), []byte("c"))
+			t.fs.Write("other-file", []byte("x"))
 			return t
 		})
 
@@ -75,10 +78,11 @@ func TestExecutor(t *testing.T) {
 					return t
 				})
 				o.Spec("it uses the correct file", func(t TE) {
-					t.e.Execute("file", "a", context.Background(), nil)
-					Expect(t, t.mockFileSystem.ReaderInput.File).To(Chain(
-						Receive(), Equal("file"),
-					))
+					t.e.Execute("other-file", "a", context.Background(), nil)
+					s := toSliceBytes(t.mockMapper.MapInput.Value, 1)
+					Expect(t, s).To(Equal([][]byte{
+						[]byte("x"),
+					}))
 				})
 
 				o.Spec("it uses mapper for each value in file", func(t TE) {
@@ -101,6 +105,59 @@ func TestExecutor(t *testing.T) {
 					}))
 				})
 
+				o.Spec("it rejects a different version of the algorithm", func(t TE) {
+					ctx := mapreduce.WithAlgorithmVersion(context.Background(), "v2")
+					_, err := t.e.Execute("file", "a", ctx, nil)
+
+					mismatch, ok := err.(*mapreduce.VersionMismatchError)
+					Expect(t, ok).To(BeTrue())
+					Expect(t, mismatch).To(Equal(&mapreduce.VersionMismatchError{
+						Name:        "a",
+						Coordinator: "v2",
+						Node:        "",
+					}))
+					Expect(t, t.mockMapper.MapCalled).To(Always(HaveLen(0)))
+				})
+
+				o.Spec("it stops reading once the context is done", func(t TE) {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+
+					_, err := t.e.Execute("file", "a", ctx, nil)
+					Expect(t, err).To(Equal(context.Canceled))
+					Expect(t, t.mockMapper.MapCalled).To(Always(HaveLen(0)))
+				})
+
+				o.Spec("it reads the split of the file", func(t TE) {
+					t.e = mapreduce.NewExecutor(t.mockAlgFetcher, rangeFileSystem{t.fs})
+					ctx := mapreduce.WithSplit(context.Background(), mapreduce.Split{Start: 2, End: 5})
+					_, err := t.e.Execute("file", "a", ctx, nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					s := toSliceBytes(t.mockMapper.MapInput.Value, 1)
+					Expect(t, s).To(Equal([][]byte{
+						[]byte("file:2-5"),
+					}))
+				})
+
+				o.Spec("it returns an error when the FileSystem cannot read a split", func(t TE) {
+					ctx := mapreduce.WithSplit(context.Background(), mapreduce.Split{Start: 2, End: 5})
+					_, err := t.e.Execute("file", "a", ctx, nil)
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it returns every value when the ReducePlan leaves the reduction to the coordinator", func(t TE) {
+					ctx := mapreduce.WithReducePlan(context.Background(), mapreduce.ReducePlan{Unreduced: true})
+					result, err := t.e.Execute("file", "a", ctx, nil)
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, mapreduce.Results(result).Values("key")).To(Equal([][]byte{
+						[]byte("a"),
+						[]byte("a"),
+						[]byte("a"),
+					}))
+					Expect(t, t.mockReducer.ReduceCalled).To(Always(HaveLen(0)))
+				})
+
 				o.Spec("it returns a result for each key", func(t TE) {
 					result, err := t.e.Execute("file", "a", context.Background(), nil)
 					Expect(t, err == nil).To(BeTrue())
@@ -124,6 +181,58 @@ func TestExecutor(t *testing.T) {
 					Expect(t, err == nil).To(BeFalse())
 				})
 			})
+
+			o.Group("when the reducer never shrinks its input", func() {
+				o.BeforeEach(func(t TE) TE {
+					mockAlgFetcher := newMockAlgorithmFetcher()
+					mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+						Mapper: t.mockMapper,
+						Reducer: mapreduce.ReduceFunc(func(value [][]byte) ([][]byte, error) {
+							return value, nil
+						}),
+					}
+					close(mockAlgFetcher.AlgOutput.Err)
+
+					t.e = mapreduce.NewExecutor(mockAlgFetcher, t.fs)
+					return t
+				})
+
+				o.Spec("it gives up after the iterations of the ReducePlan", func(t TE) {
+					ctx := mapreduce.WithReducePlan(context.Background(), mapreduce.ReducePlan{MaxIterations: 3})
+					_, err := t.e.Execute("file", "a", ctx, nil)
+					Expect(t, err == nil).To(BeFalse())
+					Expect(t, err.Error()).To(Equal("reduce: key key did not converge after 3 iterations"))
+				})
+			})
+
+			o.Group("when the reducer writes to side outputs", func() {
+				o.BeforeEach(func(t TE) TE {
+					mockAlgFetcher := newMockAlgorithmFetcher()
+					mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+						Mapper: t.mockMapper,
+						Reducer: mapreduce.NamedReducer("outputs", mapreduce.OutputReduceFunc(func(value [][]byte, emit mapreduce.Emit) ([][]byte, error) {
+							emit("sizes", []byte(fmt.Sprint(len(value))))
+							return value[:1], nil
+						})),
+					}
+					close(mockAlgFetcher.AlgOutput.Err)
+
+					t.e = mapreduce.NewExecutor(mockAlgFetcher, t.fs)
+					return t
+				})
+
+				o.Spec("it returns an error instead of losing the side outputs", func(t TE) {
+					_, err := t.e.Execute("file", "a", context.Background(), nil)
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it leaves the reduction to the coordinator when told to", func(t TE) {
+					ctx := mapreduce.WithReducePlan(context.Background(), mapreduce.ReducePlan{Unreduced: true})
+					result, err := t.e.Execute("file", "a", ctx, nil)
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, result).To(HaveLen(1))
+				})
+			})
 		})
 
 		o.Group("when the mapper returns an error", func() {
@@ -138,13 +247,324 @@ func TestExecutor(t *testing.T) {
 				_, err := t.e.Execute("file", "a", context.Background(), nil)
 				Expect(t, err == nil).To(BeFalse())
 			})
+
+			o.Spec("it skips the records when told to", func(t TE) {
+				testhelpers.AlwaysReturn(t.mockMapper.MapOutput.Err, fmt.Errorf("some-error"))
+				counters := mapreduce.NewCounters()
+				ctx := mapreduce.WithCounters(context.Background(), counters)
+				ctx = mapreduce.WithBadRecordPolicy(ctx, mapreduce.SkipBadRecords)
+				result, err := t.e.Execute("file", "a", ctx, nil)
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, result).To(HaveLen(0))
+				Expect(t, counters.Values()[mapreduce.SkippedRecordsCounter]).To(Equal(int64(3)))
+			})
+		})
+	})
+
+	o.Group("when the mapper uses the context", func() {
+		o.BeforeEach(func(t TE) TE {
+			t.fs.Write("file", []byte("a"))
+
+			mockAlgFetcher := newMockAlgorithmFetcher()
+			mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+				Mapper: mapreduce.MapContextFunc(func(ctx context.Context, value []byte) (string, []byte, error) {
+					data, _ := mapreduce.SideInput(ctx, "some-input")
+					return string(data), value, nil
+				}),
+				Reducer: t.mockReducer,
+			}
+			close(mockAlgFetcher.AlgOutput.Err)
+
+			t.e = mapreduce.NewExecutor(mockAlgFetcher, t.fs)
+			return t
+		})
+
+		o.Spec("it makes the side inputs available to the mapper", func(t TE) {
+			ctx := mapreduce.WithSideInputs(context.Background(), map[string][]byte{
+				"some-input": []byte("some-key"),
+			})
+			result, err := t.e.Execute("file", "a", ctx, nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, result).To(Equal(map[string][]byte{
+				"some-key": []byte("a"),
+			}))
+		})
+	})
+
+	o.Group("when the FileSystem stores checksums", func() {
+		o.BeforeEach(func(t TE) TE {
+			dir, err := ioutil.TempDir("", "executor")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.dir = dir
+
+			fs := local.New(dir, "some-id", local.WithFormat(records.Checksummed))
+			writer, closeFile, _ := fs.Writer("file", context.Background(), nil)
+			writer([]byte("first"))
+			writer([]byte("second"))
+			closeFile()
+
+			testhelpers.AlwaysReturn(t.mockMapper.MapOutput.Key, "key")
+			testhelpers.AlwaysReturn(t.mockMapper.MapOutput.Output, []byte("a"))
+			close(t.mockMapper.MapOutput.Err)
+			testhelpers.AlwaysReturn(t.mockReducer.ReduceOutput.Reduced, [][]byte{[]byte("a")})
+			close(t.mockReducer.ReduceOutput.Err)
+
+			t.e = mapreduce.NewExecutor(t.mockAlgFetcher, fs)
+			return t
+		})
+
+		o.AfterEach(func(t TE) {
+			os.RemoveAll(t.dir)
+		})
+
+		o.Spec("it maps the verified records", func(t TE) {
+			_, err := t.e.Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+		})
+
+		o.Spec("it returns a CorruptRecordError for a corrupt record", func(t TE) {
+			path := filepath.Join(t.dir, "file")
+			data, _ := ioutil.ReadFile(path)
+			data[len(data)-1] ^= 0xff
+			ioutil.WriteFile(path, data, 0644)
+
+			_, err := t.e.Execute("file", "a", context.Background(), nil)
+			corrupt, ok := err.(*mapreduce.CorruptRecordError)
+			Expect(t, ok).To(BeTrue())
+			Expect(t, corrupt.Record).To(Equal(uint64(1)))
+		})
+
+		o.Spec("it skips a corrupt record when told to", func(t TE) {
+			path := filepath.Join(t.dir, "file")
+			data, _ := ioutil.ReadFile(path)
+			data[len(data)-1] ^= 0xff
+			ioutil.WriteFile(path, data, 0644)
+
+			counters := mapreduce.NewCounters()
+			ctx := mapreduce.WithCounters(context.Background(), counters)
+			ctx = mapreduce.WithBadRecordPolicy(ctx, mapreduce.SkipBadRecords)
+			_, err := t.e.Execute("file", "a", ctx, nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, counters.Values()[mapreduce.SkippedRecordsCounter]).To(Equal(int64(1)))
+		})
+
+		o.Spec("it writes a corrupt record to the quarantine when told to", func(t TE) {
+			path := filepath.Join(t.dir, "file")
+			data, _ := ioutil.ReadFile(path)
+			data[len(data)-1] ^= 0xff
+			ioutil.WriteFile(path, data, 0644)
+
+			ctx := mapreduce.WithBadRecordPolicy(context.Background(), mapreduce.QuarantineBadRecords)
+			ctx = mapreduce.WithQuarantinePrefix(ctx, "quarantine")
+			_, err := t.e.Execute("file", "a", ctx, nil)
+			Expect(t, err == nil).To(BeTrue())
+
+			fs := local.New(t.dir, "some-id", local.WithFormat(records.Checksummed))
+			reader, err := fs.Reader("quarantine/file", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+
+			encoded, err := reader()
+			Expect(t, err == nil).To(BeTrue())
+
+			var record mapreduce.QuarantinedRecord
+			Expect(t, json.Unmarshal(encoded, &record) == nil).To(BeTrue())
+			Expect(t, record.File).To(Equal("file"))
+			Expect(t, record.Record).To(Equal(uint64(1)))
+			Expect(t, record.Data).To(Equal([]byte("secon\x9b")))
+
+			_, err = reader()
+			Expect(t, err).To(Equal(io.EOF))
+		})
+
+		o.Spec("it verifies the records of a filtered file", func(t TE) {
+			path := filepath.Join(t.dir, "file")
+			data, _ := ioutil.ReadFile(path)
+			data[len(data)-1] ^= 0xff
+			ioutil.WriteFile(path, data, 0644)
+
+			mockAlgFetcher := newMockAlgorithmFetcher()
+			mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+				Mapper: mapreduce.FilterMapper(mapreduce.RecordFilter{Prefix: []byte("s")}, mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return "key", value, nil
+				})),
+				Reducer: t.mockReducer,
+			}
+			close(mockAlgFetcher.AlgOutput.Err)
+
+			fs := &checksumFileSystem{FileSystem: local.New(t.dir, "some-id", local.WithFormat(records.Checksummed))}
+			_, err := mapreduce.NewExecutor(mockAlgFetcher, fs).Execute("file", "a", context.Background(), nil)
+			_, ok := err.(*mapreduce.CorruptRecordError)
+			Expect(t, ok).To(BeTrue())
+		})
+
+		o.Spec("it does not read a split it can not verify", func(t TE) {
+			fs := &checksumFileSystem{FileSystem: local.New(t.dir, "some-id", local.WithFormat(records.Checksummed))}
+			ctx := mapreduce.WithSplit(context.Background(), mapreduce.Split{Start: 0, End: 5})
+			_, err := mapreduce.NewExecutor(t.mockAlgFetcher, fs).Execute("file", "a", ctx, nil)
+			Expect(t, err == nil).To(BeFalse())
+			Expect(t, fs.ranges).To(Equal(0))
+		})
+	})
+
+	o.Group("when a read of the FileSystem fails", func() {
+		o.BeforeEach(func(t TE) TE {
+			dir, err := ioutil.TempDir("", "executor")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.dir = dir
+			ioutil.WriteFile(filepath.Join(dir, "file"), []byte("a\nb\nc\n"), 0644)
+
+			mockAlgFetcher := newMockAlgorithmFetcher()
+			mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: t.mockReducer,
+			}
+			close(mockAlgFetcher.AlgOutput.Err)
+			t.mockAlgFetcher = mockAlgFetcher
+			return t
+		})
+
+		o.AfterEach(func(t TE) {
+			os.RemoveAll(t.dir)
+		})
+
+		o.Spec("it seeks back to the record that failed", func(t TE) {
+			fs := &flakyFileSystem{FileSystem: local.New(t.dir, "some-id"), record: 1}
+			result, err := mapreduce.NewExecutor(t.mockAlgFetcher, fs, mapreduce.WithReadRetries(1)).Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, result).To(Equal(map[string][]byte{
+				"a": []byte("a"),
+				"b": []byte("b"),
+				"c": []byte("c"),
+			}))
+			Expect(t, fs.seeks).To(Equal([]uint64{1}))
+		})
+
+		o.Spec("it gives up once the retries are exhausted", func(t TE) {
+			fs := &flakyFileSystem{FileSystem: local.New(t.dir, "some-id"), record: 1, failures: 2}
+			_, err := mapreduce.NewExecutor(t.mockAlgFetcher, fs, mapreduce.WithReadRetries(1)).Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeFalse())
+		})
+
+		o.Spec("it does not seek by default", func(t TE) {
+			fs := &flakyFileSystem{FileSystem: local.New(t.dir, "some-id"), record: 1}
+			_, err := mapreduce.NewExecutor(t.mockAlgFetcher, fs).Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, fs.seeks).To(HaveLen(0))
+		})
+	})
+
+	o.Group("when the FileSystem returns an invalid record", func() {
+		o.BeforeEach(func(t TE) TE {
+			dir, err := ioutil.TempDir("", "executor")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.dir = dir
+			ioutil.WriteFile(filepath.Join(dir, "file"), []byte("{\"a\":1}\n{\"a\":\n"), 0644)
+
+			testhelpers.AlwaysReturn(t.mockMapper.MapOutput.Key, "key")
+			testhelpers.AlwaysReturn(t.mockMapper.MapOutput.Output, []byte("a"))
+			close(t.mockMapper.MapOutput.Err)
+			testhelpers.AlwaysReturn(t.mockReducer.ReduceOutput.Reduced, [][]byte{[]byte("a")})
+			close(t.mockReducer.ReduceOutput.Err)
+
+			t.e = mapreduce.NewExecutor(t.mockAlgFetcher, local.New(dir, "some-id", local.WithFormat(records.JSONLines)))
+			return t
+		})
+
+		o.AfterEach(func(t TE) {
+			os.RemoveAll(t.dir)
+		})
+
+		o.Spec("it returns an error", func(t TE) {
+			_, err := t.e.Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeFalse())
+		})
+
+		o.Spec("it skips the record when told to", func(t TE) {
+			counters := mapreduce.NewCounters()
+			ctx := mapreduce.WithCounters(context.Background(), counters)
+			ctx = mapreduce.WithBadRecordPolicy(ctx, mapreduce.SkipBadRecords)
+			_, err := t.e.Execute("file", "a", ctx, nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, counters.Values()[mapreduce.SkippedRecordsCounter]).To(Equal(int64(1)))
+		})
+	})
+
+	o.Group("when the mapper filters the records", func() {
+		newExecutor := func(fs mapreduce.FileSystem) *mapreduce.Executor {
+			mockAlgFetcher := newMockAlgorithmFetcher()
+			mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+				Mapper: mapreduce.FilterMapper(mapreduce.RecordFilter{Prefix: []byte("a-")}, mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return "key", value, nil
+				})),
+				Reducer: mapreduce.ReduceFunc(func(value [][]byte) ([][]byte, error) {
+					return [][]byte{[]byte(fmt.Sprint(len(value)))}, nil
+				}),
+			}
+			close(mockAlgFetcher.AlgOutput.Err)
+
+			return mapreduce.NewExecutor(mockAlgFetcher, fs)
+		}
+
+		o.BeforeEach(func(t TE) TE {
+			t.fs.Write("file", []byte("a-1"), []byte("b-2"), []byte("a-3"))
+			return t
+		})
+
+		o.Spec("it only maps the matching records", func(t TE) {
+			result, err := newExecutor(t.fs).Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, result).To(Equal(map[string][]byte{
+				"key": []byte("2"),
+			}))
+		})
+
+		o.Spec("it hands the filter to a FilterFileSystem", func(t TE) {
+			fs := &filterFileSystem{InMemory: t.fs}
+			result, err := newExecutor(fs).Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, result).To(Equal(map[string][]byte{
+				"key": []byte("2"),
+			}))
+			Expect(t, fs.filter).To(Equal(mapreduce.RecordFilter{Prefix: []byte("a-")}))
+		})
+	})
+
+	o.Group("when the algorithm is incomplete", func() {
+		o.BeforeEach(func(t TE) TE {
+			mockAlgFetcher := newMockAlgorithmFetcher()
+			mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Reducer: t.mockReducer}
+			close(mockAlgFetcher.AlgOutput.Err)
+
+			t.mockFileSystem = newMockFileSystem()
+			t.e = mapreduce.NewExecutor(mockAlgFetcher, t.mockFileSystem)
+			return t
+		})
+
+		o.Spec("it returns an error", func(t TE) {
+			_, err := t.e.Execute("file", "a", context.Background(), nil)
+			Expect(t, err == nil).To(BeFalse())
+		})
+
+		o.Spec("it does not read the file", func(t TE) {
+			t.e.Execute("file", "a", context.Background(), nil)
+			Expect(t, t.mockFileSystem.ReaderCalled).To(Always(HaveLen(0)))
 		})
 	})
 
 	o.Group("when the filesystem returns an error", func() {
 		o.BeforeEach(func(t TE) TE {
+			t.mockFileSystem = newMockFileSystem()
 			close(t.mockFileSystem.ReaderOutput.Reader)
 			t.mockFileSystem.ReaderOutput.Err <- fmt.Errorf("some-error")
+			t.e = mapreduce.NewExecutor(t.mockAlgFetcher, t.mockFileSystem)
 			return t
 		})
 
@@ -155,6 +575,32 @@ func TestExecutor(t *testing.T) {
 	})
 }
 
+type filterFileSystem struct {
+	*fsfakes.InMemory
+	filter mapreduce.RecordFilter
+}
+
+func (fs *filterFileSystem) FilteredReader(file string, filter mapreduce.RecordFilter, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	fs.filter = filter
+	return fs.Reader(file, ctx, meta)
+}
+
+// checksumFileSystem filters and splits the files of a local FileSystem
+// without verifying their checksums.
+type checksumFileSystem struct {
+	*local.FileSystem
+	ranges int
+}
+
+func (fs *checksumFileSystem) FilteredReader(file string, filter mapreduce.RecordFilter, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	return fs.Reader(file, ctx, meta)
+}
+
+func (fs *checksumFileSystem) RangeReader(file string, start, end uint64, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	fs.ranges++
+	return fs.Reader(file, ctx, meta)
+}
+
 func toSliceBytes(c <-chan []byte, count int) (results [][]byte) {
 	for i := 0; i < count; i++ {
 		select {
@@ -180,3 +626,42 @@ func toSliceDoubleBytes(c <-chan [][]byte, count int) (results [][][]byte) {
 
 	return results
 }
+
+// flakyFileSystem fails the read of the given record as often as told to
+// (once by default), after the record was read from the file.
+type flakyFileSystem struct {
+	*local.FileSystem
+	record   uint64
+	failures int
+	seeks    []uint64
+}
+
+func (fs *flakyFileSystem) Seeker(file string, ctx context.Context, meta []byte) (func() ([]byte, error), func(record uint64) error, func() error, error) {
+	next, seek, close, err := fs.FileSystem.Seeker(file, ctx, meta)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	failures := fs.failures
+	if failures == 0 {
+		failures = 1
+	}
+
+	var record uint64
+	reader := func() ([]byte, error) {
+		data, err := next()
+		if record == fs.record && failures > 0 {
+			failures--
+			return nil, fmt.Errorf("some-error")
+		}
+		record++
+		return data, err
+	}
+
+	seeker := func(r uint64) error {
+		fs.seeks = append(fs.seeks, r)
+		record = r
+		return seek(r)
+	}
+	return reader, seeker, close, nil
+}
@@ -0,0 +1,179 @@
+package mapreduce
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// NodeTimeCounter is the counter of the nanoseconds the nodes spent on the
+// files (or splits) of a calculation, including the attempts that failed. It
+// is only counted for the calculations of a Scheduler.
+const NodeTimeCounter = "mapreduce.node-time-ns"
+
+// WithTenant sets the tenant (e.g., a team) that a calculation is run for.
+// The Scheduler shares the calculations between the tenants (see
+// WithFairShare) and reports the usage of each of them. The default tenant
+// is "".
+func WithTenant(name string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.tenant = name
+	}
+}
+
+// WithFairShare shares the calculations of the Scheduler between the
+// tenants (see WithTenant) according to the given weights. A tenant that is
+// missing has a weight of 1. While other tenants have calculations queued, a
+// tenant runs at most its share of the concurrency (but at least one
+// calculation), and the queued calculation of the tenant that used the
+// least node time relative to its weight is started first. Priorities (see
+// WithPriority) only order the calculations of the same tenant.
+func WithFairShare(weights map[string]float64) SchedulerOption {
+	return func(s *Scheduler) {
+		s.weights = weights
+	}
+}
+
+// TenantUsage is what a tenant used of a Scheduler.
+type TenantUsage struct {
+	// NodeTime is the time the nodes spent on the calculations of the
+	// tenant, including the running ones (see NodeTimeCounter).
+	NodeTime time.Duration
+
+	// Finished, Running and Queued are the numbers of calculations of the
+	// tenant in each state.
+	Finished, Running, Queued int
+}
+
+// tenant is the state of a tenant within a Scheduler.
+type tenant struct {
+	running  int
+	finished int
+	nodeTime time.Duration
+	jobs     map[*Job]bool
+}
+
+// Usage returns what each tenant used of the Scheduler.
+func (s *Scheduler) Usage() map[string]TenantUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := make(map[string]TenantUsage)
+	for name, t := range s.tenants {
+		usage[name] = TenantUsage{
+			NodeTime: s.nodeTime(name),
+			Finished: t.finished,
+			Running:  t.running,
+		}
+	}
+
+	for _, j := range s.queue {
+		u := usage[j.tenant]
+		u.Queued++
+		usage[j.tenant] = u
+	}
+	return usage
+}
+
+// tenant returns the state of the named tenant. The lock has to be held.
+func (s *Scheduler) tenant(name string) *tenant {
+	t, ok := s.tenants[name]
+	if !ok {
+		t = &tenant{jobs: make(map[*Job]bool)}
+		s.tenants[name] = t
+	}
+	return t
+}
+
+// nodeTime returns the node time the tenant used so far. The lock has to be
+// held.
+func (s *Scheduler) nodeTime(name string) time.Duration {
+	t := s.tenant(name)
+	d := t.nodeTime
+	for job := range t.jobs {
+		d += nodeTime(job)
+	}
+	return d
+}
+
+// weight returns the weight of the tenant.
+func (s *Scheduler) weight(name string) float64 {
+	if w, ok := s.weights[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// limit returns how many calculations the tenant may run at once. The
+// tenant may use every slot while no other tenant waits. The lock has to be
+// held.
+func (s *Scheduler) limit(name string) int {
+	active := map[string]bool{name: true}
+	waiting := false
+	for _, j := range s.queue {
+		active[j.tenant] = true
+		waiting = waiting || j.tenant != name
+	}
+
+	if !waiting {
+		return s.concurrency
+	}
+
+	for other, t := range s.tenants {
+		if t.running > 0 {
+			active[other] = true
+		}
+	}
+
+	var total float64
+	for other := range active {
+		total += s.weight(other)
+	}
+
+	share := int(math.Floor(float64(s.concurrency) * s.weight(name) / total))
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
+
+// before reports whether the calculation a is started before b: the tenant
+// that used less of its share comes first, then the higher priority and
+// then the one that was submitted first. The lock has to be held.
+func (s *Scheduler) before(a, b *ScheduledJob) bool {
+	if s.weights != nil && a.tenant != b.tenant {
+		ua := float64(s.nodeTime(a.tenant)) / s.weight(a.tenant)
+		ub := float64(s.nodeTime(b.tenant)) / s.weight(b.tenant)
+		if ua != ub {
+			return ua < ub
+		}
+	}
+	return a.priority > b.priority
+}
+
+// executeTimed executes the file on the node and counts the node time (see
+// NodeTimeCounter).
+func (r MapReduce) executeTimed(file, algName, nodeID string, ctx context.Context, meta []byte, emit func(batch map[string][]byte)) error {
+	if !r.countNodeTime {
+		return r.executeOn(file, algName, nodeID, ctx, meta, emit)
+	}
+
+	start := time.Now()
+	defer func() {
+		AddCounter(ctx, NodeTimeCounter, int64(time.Since(start)))
+	}()
+	return r.executeOn(file, algName, nodeID, ctx, meta, emit)
+}
+
+// withNodeTime counts the node time of a calculation.
+func withNodeTime() MapReduceOption {
+	return func(r *MapReduce) {
+		r.countNodeTime = true
+	}
+}
+
+// nodeTime returns the node time the Job used so far.
+func nodeTime(job *Job) time.Duration {
+	return time.Duration(job.counters.Values()[NodeTimeCounter])
+}
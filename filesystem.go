@@ -1,6 +1,10 @@
 package mapreduce
 
-import "golang.org/x/net/context"
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
 
 // FileSystem is used to store data local to the node.
 type FileSystem interface {
@@ -8,6 +12,103 @@ type FileSystem interface {
 	// error will exit the operation.
 	Files(route string, ctx context.Context, meta []byte) (files map[string][]string, err error)
 
-	// Reader returns a reader to read data from the given file.
+	// Reader returns a reader to read data from the given file. The reader should stop with an error once the
+	// context is done, so that a canceled calculation does not keep on reading.
 	Reader(file string, ctx context.Context, meta []byte) (reader func() (data []byte, err error), err error)
 }
+
+// WriteFileSystem is a FileSystem that can also store data.
+type WriteFileSystem interface {
+	FileSystem
+
+	// Writer returns a writer to store data in the given file. Each write stores a single record that Reader
+	// returns as is. The file is complete once close is invoked.
+	Writer(file string, ctx context.Context, meta []byte) (writer func(data []byte) error, close func() error, err error)
+}
+
+// ListFileSystem is a FileSystem that can enumerate every file below a prefix. It is used when a calculation is
+// configured with WithRecursive().
+type ListFileSystem interface {
+	FileSystem
+
+	// List returns every file below the given prefix, including the ones within nested directories, with the nodes
+	// they are available on.
+	List(prefix string, ctx context.Context, meta []byte) (files map[string][]string, err error)
+}
+
+// FileInfo describes a file.
+type FileInfo struct {
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// Records is the number of records within the file, or -1 if it is not known.
+	Records int64
+
+	// ModTime is the time the file was last modified.
+	ModTime time.Time
+
+	// Compression names the compression of the file (e.g., "gzip"). It is empty for an uncompressed file.
+	Compression string
+}
+
+// StatFileSystem is a FileSystem that can describe its files.
+type StatFileSystem interface {
+	FileSystem
+
+	// Stat returns the FileInfo for the given file.
+	Stat(file string, ctx context.Context, meta []byte) (info FileInfo, err error)
+}
+
+// RangeFileSystem is a FileSystem that can read a byte range of a file. It is used to calculate the splits of a file
+// (see WithSplitSize).
+type RangeFileSystem interface {
+	FileSystem
+
+	// RangeReader returns a reader for the records that start within the bytes of the file from start up to end. A
+	// range that starts in the middle of a record skips ahead to the next one, while the record that straddles end is
+	// returned whole.
+	RangeReader(file string, start, end uint64, ctx context.Context, meta []byte) (reader func() (data []byte, err error), err error)
+}
+
+// SeekFileSystem is a FileSystem whose readers can jump to any record of a file, so that a single open file can
+// serve several reads. The Executor uses it to retry a failed read from the record that failed instead of from
+// the start of the file (see WithReadRetries).
+type SeekFileSystem interface {
+	FileSystem
+
+	// Seeker returns a reader like Reader does along with a function that makes the reader return the record with
+	// the given index next. The file stays open until close is invoked.
+	Seeker(file string, ctx context.Context, meta []byte) (reader func() (data []byte, err error), seek func(record uint64) error, close func() error, err error)
+}
+
+// ChecksumFileSystem is a FileSystem that stores a checksum with each record. The Executor verifies the checksums
+// before mapping the records and fails with a *CorruptRecordError on a mismatch. The records of a file with
+// checksums are not handed to a FilterFileSystem, and a split of such a file (see WithSplitSize) fails, as neither
+// could be verified.
+type ChecksumFileSystem interface {
+	FileSystem
+
+	// ChecksumReader returns a reader like Reader does that also returns the CRC-32 (Castagnoli) that was stored
+	// with each record. A nil reader means the file does not have checksums.
+	ChecksumReader(file string, ctx context.Context, meta []byte) (reader func() (data []byte, checksum uint32, err error), err error)
+}
+
+// FilterFileSystem is a FileSystem that can filter records where they are stored, so that records a
+// FilteredMapper is not interested in are not read at all.
+type FilterFileSystem interface {
+	FileSystem
+
+	// FilteredReader returns a reader like Reader does that leaves out records that do not match the filter. It
+	// may return records that do not match, as the Mapper filters them again.
+	FilteredReader(file string, filter RecordFilter, ctx context.Context, meta []byte) (reader func() (data []byte, err error), err error)
+}
+
+// LocalityFileSystem is a FileSystem that knows which nodes hold a range of a file. The calculation prefers those
+// nodes over the other ones that report having the file.
+type LocalityFileSystem interface {
+	FileSystem
+
+	// NodesFor returns the nodes that hold the bytes of the file from start up to end. An end of 0 means the end
+	// of the file.
+	NodesFor(file string, start, end uint64) []string
+}
@@ -0,0 +1,80 @@
+package mapreduce
+
+import (
+	"bytes"
+
+	"golang.org/x/net/context"
+)
+
+// RecordFilter describes the records a Mapper is interested in. It is
+// declarative so that a FileSystem can apply it where the data is stored
+// (see FilterFileSystem). Empty fields match every record.
+type RecordFilter struct {
+	// Prefix only matches records that start with it.
+	Prefix []byte
+
+	// Contains only matches records that contain it.
+	Contains []byte
+}
+
+// Match reports whether the record matches the filter.
+func (f RecordFilter) Match(record []byte) bool {
+	return bytes.HasPrefix(record, f.Prefix) && bytes.Contains(record, f.Contains)
+}
+
+// FilteredMapper is a Mapper that is only interested in some of the
+// records. The Executor hands its RecordFilter to a FilterFileSystem so that
+// the other records are not read at all.
+type FilteredMapper interface {
+	Mapper
+
+	// RecordFilter returns the filter for the records. It returns false if
+	// every record is of interest.
+	RecordFilter() (filter RecordFilter, ok bool)
+}
+
+// FilterMapper returns a Mapper that only maps the records that match the
+// filter. The other records are filtered out, even if the FileSystem does
+// not apply the filter itself.
+func FilterMapper(filter RecordFilter, m Mapper) Mapper {
+	return filteredMapper{
+		filter: filter,
+		mapper: m,
+	}
+}
+
+// recordFilter returns the RecordFilter of the Mapper if it has one.
+func recordFilter(m Mapper) (RecordFilter, bool) {
+	if filtered, ok := m.(FilteredMapper); ok {
+		return filtered.RecordFilter()
+	}
+	return RecordFilter{}, false
+}
+
+type filteredMapper struct {
+	filter RecordFilter
+	mapper Mapper
+}
+
+func (m filteredMapper) RecordFilter() (RecordFilter, bool) {
+	return m.filter, true
+}
+
+func (m filteredMapper) StageName() string {
+	return stageName(m.mapper, MapStage)
+}
+
+func (m filteredMapper) Map(value []byte) (key string, output []byte, err error) {
+	return m.MapContext(context.Background(), value)
+}
+
+func (m filteredMapper) MapContext(ctx context.Context, value []byte) (key string, output []byte, err error) {
+	if !m.filter.Match(value) {
+		return "", nil, nil
+	}
+
+	if contextMapper, ok := m.mapper.(ContextMapper); ok {
+		return contextMapper.MapContext(ctx, value)
+	}
+	return m.mapper.Map(value)
+}
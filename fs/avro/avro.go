@@ -0,0 +1,151 @@
+// Package avro implements a mapreduce.FileSystem over Avro object container
+// files. Each datum is a record, encoded with the Avro binary encoding of
+// its schema, so a Mapper can decode it with Fields.
+package avro
+
+import (
+	"io"
+
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+	"golang.org/x/net/context"
+)
+
+// Source provides the Avro object container files. Use Dir for files on the
+// local disk.
+type Source interface {
+	// Files behaves like mapreduce.FileSystem.Files.
+	Files(route string, ctx context.Context, meta []byte) (map[string][]string, error)
+
+	// Open opens the file.
+	Open(file string, ctx context.Context) (io.ReadCloser, error)
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithReaderSchema resolves the schema each file was written with against
+// the given schema. The records are encoded with the given schema, so the
+// Mapper sees the same schema even if the files were written with different
+// (but compatible) versions of it. Fields that are missing from a file get
+// their default values.
+func WithReaderSchema(schema avro.Schema) Option {
+	return func(fs *FileSystem) {
+		fs.schema = schema
+	}
+}
+
+// FileSystem implements mapreduce.FileSystem over Avro object container
+// files. By default each record is encoded with the schema of its file.
+//
+// It should be created with New().
+type FileSystem struct {
+	source Source
+	schema avro.Schema
+}
+
+// New returns a new FileSystem for the Avro files of the given source.
+func New(source Source, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		source: source,
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return fs.source.Files(route, ctx, meta)
+}
+
+// Reader implements mapreduce.FileSystem. It returns an error if the schema
+// of the file cannot be resolved against the reader schema. The file is
+// closed once the reader returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	f, err := fs.source.Open(file, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := ocf.NewDecoder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	encode, err := fs.encoder(dec.Schema())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	next := func() ([]byte, error) {
+		if !dec.HasNext() {
+			if err := dec.Error(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+
+		var datum interface{}
+		if err := dec.Decode(&datum); err != nil {
+			return nil, err
+		}
+		return encode(datum)
+	}
+
+	return func() ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		data, err := next()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return data, nil
+	}, nil
+}
+
+// encoder returns a function that encodes a datum of the writer schema as a
+// record.
+func (fs *FileSystem) encoder(writer avro.Schema) (func(datum interface{}) ([]byte, error), error) {
+	if fs.schema == nil {
+		return func(datum interface{}) ([]byte, error) {
+			return avro.Marshal(writer, datum)
+		}, nil
+	}
+
+	resolved, err := avro.NewSchemaCompatibility().Resolve(fs.schema, writer)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(datum interface{}) ([]byte, error) {
+		data, err := avro.Marshal(writer, datum)
+		if err != nil {
+			return nil, err
+		}
+
+		var resolvedDatum interface{}
+		if err := avro.Unmarshal(resolved, data, &resolvedDatum); err != nil {
+			return nil, err
+		}
+		return avro.Marshal(fs.schema, resolvedDatum)
+	}, nil
+}
+
+// Fields decodes a record of the given record schema into its fields.
+func Fields(schema avro.Schema, record []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := avro.Unmarshal(schema, record, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
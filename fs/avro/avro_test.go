@@ -0,0 +1,138 @@
+package avro_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	havro "github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/avro"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+const writerSchema = `{
+	"type": "record",
+	"name": "event",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "name", "type": "string"}
+	]
+}`
+
+const readerSchema = `{
+	"type": "record",
+	"name": "event",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "source", "type": "string", "default": "unknown"}
+	]
+}`
+
+type TA struct {
+	*testing.T
+	dir string
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TA {
+		dir, err := ioutil.TempDir("", "avro")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Create(filepath.Join(dir, "events.avro"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		enc, err := ocf.NewEncoder(writerSchema, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.Encode(map[string]interface{}{"id": int64(1), "name": "a"})
+		enc.Encode(map[string]interface{}{"id": int64(2), "name": "b"})
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		return TA{
+			T:   t,
+			dir: dir,
+		}
+	})
+
+	o.AfterEach(func(t TA) {
+		os.RemoveAll(t.dir)
+	})
+
+	o.Spec("it implements FileSystem", func(t TA) {
+		var fs mapreduce.FileSystem = avro.New(avro.Dir(t.dir, "some-id"))
+		_ = fs
+	})
+
+	o.Spec("it returns the files of the directory", func(t TA) {
+		files, err := avro.New(avro.Dir(t.dir, "some-id")).Files("", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"events.avro": {"some-id"},
+		}))
+	})
+
+	o.Spec("it reads each datum with the schema of the file", func(t TA) {
+		schema := havro.MustParse(writerSchema)
+		records := readAll(t, avro.New(avro.Dir(t.dir, "some-id")))
+		Expect(t, records).To(HaveLen(2))
+
+		fields, err := avro.Fields(schema, records[1])
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, fields).To(Equal(map[string]interface{}{"id": int64(2), "name": "b"}))
+	})
+
+	o.Spec("it resolves the schema of the file against the reader schema", func(t TA) {
+		schema := havro.MustParse(readerSchema)
+		records := readAll(t, avro.New(avro.Dir(t.dir, "some-id"), avro.WithReaderSchema(schema)))
+		Expect(t, records).To(HaveLen(2))
+
+		fields, err := avro.Fields(schema, records[0])
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, fields).To(Equal(map[string]interface{}{"id": int64(1), "source": "unknown"}))
+	})
+
+	o.Spec("it returns an error for an incompatible reader schema", func(t TA) {
+		schema := havro.MustParse(`{"type": "record", "name": "event", "fields": [{"name": "other", "type": "int"}]}`)
+		_, err := avro.New(avro.Dir(t.dir, "some-id"), avro.WithReaderSchema(schema)).Reader("events.avro", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+func readAll(t TA, fs *avro.FileSystem) [][]byte {
+	reader, err := fs.Reader("events.avro", context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records [][]byte
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, data)
+	}
+}
@@ -0,0 +1,179 @@
+// Package azblob implements a mapreduce.FileSystem over the blobs of an Azure
+// Blob Storage container.
+package azblob
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/records"
+	"golang.org/x/net/context"
+)
+
+// Container is the subset of the Azure Blob Storage API that the FileSystem
+// uses. Use NewContainer to create one from a *container.Client.
+type Container interface {
+	// Blobs returns the names of the blobs with the given prefix.
+	Blobs(ctx context.Context, prefix string) ([]string, error)
+
+	// NewReader returns the content of the blob.
+	NewReader(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// Upload stores the blob.
+	Upload(ctx context.Context, name string, data []byte) error
+}
+
+// NewContainer returns a Container for the given container client.
+func NewContainer(c *container.Client) Container {
+	return containerClient{c: c}
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithDiscovery reports the files to be available on the nodes that the
+// Discovery currently reports, instead of the nodes given to New. It picks up
+// nodes that start reading from the container without a restart.
+func WithDiscovery(d mapreduce.Discovery) Option {
+	return func(fs *FileSystem) {
+		fs.discovery = d
+	}
+}
+
+// WithFormat sets the format of the records. It defaults to records.Lines.
+func WithFormat(f records.Format) Option {
+	return func(fs *FileSystem) {
+		fs.format = f
+	}
+}
+
+// FileSystem implements mapreduce.WriteFileSystem over the blobs of a
+// container. Blobs can be read from any node, so each file is reported to be
+// available on every configured node.
+//
+// It should be created with New().
+type FileSystem struct {
+	container Container
+	discovery mapreduce.Discovery
+	format    records.Format
+}
+
+// New returns a new FileSystem for the given container. The nodes are the
+// ones that are able to read from the container.
+func New(container Container, nodeIDs []string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		container: container,
+		discovery: mapreduce.StaticNodes(nodeIDs...),
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route is used as a blob name
+// prefix.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	names, err := fs.container.Blobs(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeIDs, err := fs.discovery.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, name := range names {
+		files[name] = nodeIDs
+	}
+	return files, nil
+}
+
+// List implements mapreduce.ListFileSystem. The blob names are flat, so it
+// returns the same files as Files.
+func (fs *FileSystem) List(prefix string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return fs.Files(prefix, ctx, meta)
+}
+
+// Reader implements mapreduce.FileSystem. The blob is closed once the reader
+// returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	body, err := fs.container.NewReader(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	next := records.NewReader(body, fs.format)
+	return func() ([]byte, error) {
+		data, err := next()
+		if err != nil {
+			if !records.IsInvalid(err) {
+				body.Close()
+			}
+			return nil, err
+		}
+		return data, nil
+	}, nil
+}
+
+// Writer implements mapreduce.WriteFileSystem. The records are buffered and
+// uploaded as a single blob once the writer is closed.
+func (fs *FileSystem) Writer(file string, ctx context.Context, meta []byte) (func(data []byte) error, func() error, error) {
+	buf := &bytes.Buffer{}
+	writer := func(data []byte) error {
+		return records.Write(buf, fs.format, data)
+	}
+
+	close := func() error {
+		return fs.container.Upload(ctx, file, buf.Bytes())
+	}
+
+	return writer, close, nil
+}
+
+type containerClient struct {
+	c *container.Client
+}
+
+func (c containerClient) Blobs(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	pager := c.c.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix: &prefix,
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if page.Segment == nil {
+			continue
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil {
+				names = append(names, *item.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (c containerClient) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := c.c.NewBlobClient(name).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c containerClient) Upload(ctx context.Context, name string, data []byte) error {
+	_, err := c.c.NewBlockBlobClient(name).UploadBuffer(ctx, data, nil)
+	return err
+}
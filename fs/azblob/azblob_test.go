@@ -0,0 +1,125 @@
+package azblob_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/azblob"
+	"github.com/poy/mapreduce/fs/records"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TA struct {
+	*testing.T
+	container *fakeContainer
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TA {
+		return TA{
+			T: t,
+			container: &fakeContainer{
+				blobs: map[string]string{
+					"logs/a": "first\nsecond\n",
+					"other":  "x\n",
+				},
+			},
+		}
+	})
+
+	o.Spec("it implements WriteFileSystem and ListFileSystem", func(t TA) {
+		var fs mapreduce.WriteFileSystem = azblob.New(t.container, nil)
+		_ = fs
+
+		var lister mapreduce.ListFileSystem = azblob.New(t.container, nil)
+		_ = lister
+	})
+
+	o.Spec("it lists the blobs with the prefix", func(t TA) {
+		files, err := azblob.New(t.container, []string{"id-a", "id-b"}).Files("logs/", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/a": {"id-a", "id-b"},
+		}))
+	})
+
+	o.Spec("it reads the records of a blob", func(t TA) {
+		fs := azblob.New(t.container, nil)
+		Expect(t, readAll(t, fs, "logs/a")).To(Equal([]string{"first", "second"}))
+	})
+
+	o.Spec("it writes the records on close", func(t TA) {
+		writer, close, err := azblob.New(t.container, nil, azblob.WithFormat(records.LengthPrefixed)).Writer("out", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		writer([]byte("a"))
+		writer([]byte("bc"))
+
+		_, ok := t.container.blobs["out"]
+		Expect(t, ok).To(BeFalse())
+
+		Expect(t, close() == nil).To(BeTrue())
+		Expect(t, t.container.blobs["out"]).To(Equal("\x01a\x02bc"))
+	})
+}
+
+func readAll(t TA, fs *azblob.FileSystem, file string) []string {
+	reader, err := fs.Reader(file, context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
+
+type fakeContainer struct {
+	mu    sync.Mutex
+	blobs map[string]string
+}
+
+func (c *fakeContainer) Blobs(ctx context.Context, prefix string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for name := range c.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (c *fakeContainer) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ioutil.NopCloser(strings.NewReader(c.blobs[name])), nil
+}
+
+func (c *fakeContainer) Upload(ctx context.Context, name string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blobs[name] = string(data)
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package fsfakes provides FileSystem implementations for tests and
+// examples.
+package fsfakes
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+)
+
+// InMemory implements mapreduce.WriteFileSystem over records held in memory.
+// It is safe for concurrent use.
+//
+// It should be created with NewInMemory().
+type InMemory struct {
+	mu      sync.Mutex
+	nodeIDs []string
+	files   map[string]*file
+}
+
+type file struct {
+	nodeIDs []string
+	records [][]byte
+	modTime time.Time
+}
+
+// NewInMemory returns a new, empty InMemory. Files are reported to be
+// available on the given nodes unless SetNodes says otherwise.
+func NewInMemory(nodeIDs ...string) *InMemory {
+	return &InMemory{
+		nodeIDs: nodeIDs,
+		files:   make(map[string]*file),
+	}
+}
+
+// Write appends the records to the file, creating it if necessary.
+func (fs *InMemory) Write(name string, records ...[]byte) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f := fs.file(name)
+	for _, r := range records {
+		f.records = append(f.records, append([]byte(nil), r...))
+	}
+	f.modTime = time.Now()
+}
+
+// SetNodes sets the nodes the file is reported to be available on, creating
+// the file if necessary.
+func (fs *InMemory) SetNodes(name string, nodeIDs ...string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.file(name).nodeIDs = nodeIDs
+}
+
+// Records returns the records of the file. It returns false if the file does
+// not exist.
+func (fs *InMemory) Records(name string) ([][]byte, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, ok := fs.files[name]
+	if !ok {
+		return nil, false
+	}
+	return append([][]byte(nil), f.records...), true
+}
+
+// Files implements mapreduce.FileSystem. It returns every file whose name
+// starts with the route.
+func (fs *InMemory) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	files := make(map[string][]string)
+	for name, f := range fs.files {
+		if strings.HasPrefix(name, route) {
+			files[name] = f.nodeIDs
+		}
+	}
+	return files, nil
+}
+
+// List implements mapreduce.ListFileSystem. The names are flat, so it
+// returns the same files as Files.
+func (fs *InMemory) List(prefix string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return fs.Files(prefix, ctx, meta)
+}
+
+// Stat implements mapreduce.StatFileSystem. The size is the sum of the
+// sizes of the records.
+func (fs *InMemory) Stat(name string, ctx context.Context, meta []byte) (mapreduce.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, ok := fs.files[name]
+	if !ok {
+		return mapreduce.FileInfo{}, fmt.Errorf("unknown file %s", name)
+	}
+
+	info := mapreduce.FileInfo{
+		Records: int64(len(f.records)),
+		ModTime: f.modTime,
+	}
+	for _, r := range f.records {
+		info.Size += int64(len(r))
+	}
+	return info, nil
+}
+
+// Reader implements mapreduce.FileSystem. Records written after the reader
+// was created are not returned.
+func (fs *InMemory) Reader(name string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	records, ok := fs.Records(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown file %s", name)
+	}
+
+	return func() ([]byte, error) {
+		if len(records) == 0 {
+			return nil, io.EOF
+		}
+
+		data := records[0]
+		records = records[1:]
+		return data, nil
+	}, nil
+}
+
+// Writer implements mapreduce.WriteFileSystem. The file replaces any
+// existing one once close is invoked.
+func (fs *InMemory) Writer(name string, ctx context.Context, meta []byte) (func(data []byte) error, func() error, error) {
+	var records [][]byte
+	writer := func(data []byte) error {
+		records = append(records, append([]byte(nil), data...))
+		return nil
+	}
+
+	close := func() error {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+
+		f := fs.file(name)
+		f.records = records
+		f.modTime = time.Now()
+		return nil
+	}
+
+	return writer, close, nil
+}
+
+// file returns the named file, creating it if necessary. The lock has to be
+// held.
+func (fs *InMemory) file(name string) *file {
+	f, ok := fs.files[name]
+	if !ok {
+		f = &file{nodeIDs: fs.nodeIDs}
+		fs.files[name] = f
+	}
+	return f
+}
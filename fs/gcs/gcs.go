@@ -0,0 +1,259 @@
+// Package gcs implements a mapreduce.FileSystem over the objects of a Google
+// Cloud Storage bucket.
+package gcs
+
+import (
+	"io"
+
+	"cloud.google.com/go/storage"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/records"
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
+
+// Bucket is the subset of the GCS API that the FileSystem uses. Use
+// NewBucket to create one from a *storage.BucketHandle.
+type Bucket interface {
+	// Objects returns the names of the objects with the given prefix.
+	Objects(ctx context.Context, prefix string) ([]string, error)
+
+	// Size returns the size of the object in bytes.
+	Size(ctx context.Context, name string) (int64, error)
+
+	// NewRangeReader reads length bytes of the object starting at offset.
+	// A negative length reads until the end of the object.
+	NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+
+	// NewWriter writes the object. The object is stored once the writer is
+	// closed.
+	NewWriter(ctx context.Context, name string) io.WriteCloser
+}
+
+// NewBucket returns a Bucket for the given bucket handle.
+func NewBucket(b *storage.BucketHandle) Bucket {
+	return bucketHandle{b: b}
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithDiscovery reports the files to be available on the nodes that the
+// Discovery currently reports, instead of the nodes given to New. It picks up
+// nodes that start reading from the bucket without a restart.
+func WithDiscovery(d mapreduce.Discovery) Option {
+	return func(fs *FileSystem) {
+		fs.discovery = d
+	}
+}
+
+// WithFormat sets the format of the records. It defaults to records.Lines.
+func WithFormat(f records.Format) Option {
+	return func(fs *FileSystem) {
+		fs.format = f
+	}
+}
+
+// WithChunks reads objects in chunks of the given size, fetching up to
+// concurrency chunks at the same time. By default an object is read with a
+// single request.
+func WithChunks(size int64, concurrency int) Option {
+	return func(fs *FileSystem) {
+		fs.chunkSize = size
+		fs.concurrency = concurrency
+	}
+}
+
+// FileSystem implements mapreduce.WriteFileSystem over the objects of a
+// bucket. Objects can be read from any node, so each file is reported to be
+// available on every configured node.
+//
+// It should be created with New().
+type FileSystem struct {
+	bucket      Bucket
+	discovery   mapreduce.Discovery
+	format      records.Format
+	chunkSize   int64
+	concurrency int
+}
+
+// New returns a new FileSystem for the given bucket. The nodes are the ones
+// that are able to read from the bucket.
+func New(bucket Bucket, nodeIDs []string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		bucket:      bucket,
+		discovery:   mapreduce.StaticNodes(nodeIDs...),
+		concurrency: 1,
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route is used as an object name
+// prefix.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	names, err := fs.bucket.Objects(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeIDs, err := fs.discovery.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, name := range names {
+		files[name] = nodeIDs
+	}
+	return files, nil
+}
+
+// List implements mapreduce.ListFileSystem. The object names are flat, so it
+// returns the same files as Files.
+func (fs *FileSystem) List(prefix string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return fs.Files(prefix, ctx, meta)
+}
+
+// Reader implements mapreduce.FileSystem. The object is closed once the
+// reader returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	body, err := fs.open(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	next := records.NewReader(body, fs.format)
+	return func() ([]byte, error) {
+		data, err := next()
+		if err != nil {
+			if !records.IsInvalid(err) {
+				body.Close()
+			}
+			return nil, err
+		}
+		return data, nil
+	}, nil
+}
+
+// Writer implements mapreduce.WriteFileSystem.
+func (fs *FileSystem) Writer(file string, ctx context.Context, meta []byte) (func(data []byte) error, func() error, error) {
+	w := fs.bucket.NewWriter(ctx, file)
+	writer := func(data []byte) error {
+		return records.Write(w, fs.format, data)
+	}
+
+	return writer, w.Close, nil
+}
+
+// open returns the content of the object. With chunks configured, the
+// chunks are fetched concurrently and stitched back together in order.
+func (fs *FileSystem) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if fs.chunkSize <= 0 {
+		return fs.bucket.NewRangeReader(ctx, name, 0, -1)
+	}
+
+	size, err := fs.bucket.Size(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+
+	concurrency := fs.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	pending := make(chan chan chunk, concurrency)
+	go func() {
+		defer close(pending)
+		for offset := int64(0); offset < size; offset += fs.chunkSize {
+			c := make(chan chunk, 1)
+			select {
+			case pending <- c:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(offset int64) {
+				c <- fs.fetch(ctx, name, offset)
+			}(offset)
+		}
+	}()
+
+	go func() {
+		defer cancel()
+		for c := range pending {
+			chunk := <-c
+			if chunk.err != nil {
+				pw.CloseWithError(chunk.err)
+				return
+			}
+
+			if _, err := pw.Write(chunk.data); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	return pr, nil
+}
+
+type chunk struct {
+	data []byte
+	err  error
+}
+
+func (fs *FileSystem) fetch(ctx context.Context, name string, offset int64) chunk {
+	r, err := fs.bucket.NewRangeReader(ctx, name, offset, fs.chunkSize)
+	if err != nil {
+		return chunk{err: err}
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	return chunk{data: data, err: err}
+}
+
+type bucketHandle struct {
+	b *storage.BucketHandle
+}
+
+func (h bucketHandle) Objects(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	it := h.b.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, attrs.Name)
+	}
+}
+
+func (h bucketHandle) Size(ctx context.Context, name string) (int64, error) {
+	attrs, err := h.b.Object(name).Attrs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+func (h bucketHandle) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return h.b.Object(name).NewRangeReader(ctx, offset, length)
+}
+
+func (h bucketHandle) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return h.b.Object(name).NewWriter(ctx)
+}
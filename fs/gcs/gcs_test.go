@@ -0,0 +1,158 @@
+package gcs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/gcs"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TG struct {
+	*testing.T
+	bucket *fakeBucket
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TG {
+		return TG{
+			T: t,
+			bucket: &fakeBucket{
+				objects: map[string]string{
+					"logs/a": "first\nsecond\nthird\n",
+					"other":  "x\n",
+				},
+			},
+		}
+	})
+
+	o.Spec("it implements WriteFileSystem and ListFileSystem", func(t TG) {
+		var fs mapreduce.WriteFileSystem = gcs.New(t.bucket, nil)
+		_ = fs
+
+		var lister mapreduce.ListFileSystem = gcs.New(t.bucket, nil)
+		_ = lister
+	})
+
+	o.Spec("it lists the objects with the prefix", func(t TG) {
+		files, err := gcs.New(t.bucket, []string{"id-a"}).Files("logs/", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/a": {"id-a"},
+		}))
+	})
+
+	o.Spec("it reports the objects on the discovered nodes", func(t TG) {
+		fs := gcs.New(t.bucket, []string{"id-a"}, gcs.WithDiscovery(mapreduce.StaticNodes("id-b", "id-c")))
+		files, err := fs.Files("logs/", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/a": {"id-b", "id-c"},
+		}))
+	})
+
+	o.Spec("it reads the records of an object", func(t TG) {
+		fs := gcs.New(t.bucket, nil)
+		Expect(t, readAll(t, fs, "logs/a")).To(Equal([]string{"first", "second", "third"}))
+	})
+
+	o.Spec("it reads the records of an object in chunks", func(t TG) {
+		fs := gcs.New(t.bucket, nil, gcs.WithChunks(4, 3))
+		Expect(t, readAll(t, fs, "logs/a")).To(Equal([]string{"first", "second", "third"}))
+		Expect(t, t.bucket.rangeReads).To(Equal(5))
+	})
+
+	o.Spec("it writes the records", func(t TG) {
+		writer, close, err := gcs.New(t.bucket, nil).Writer("out", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		writer([]byte("a"))
+		Expect(t, close() == nil).To(BeTrue())
+		Expect(t, t.bucket.objects["out"]).To(Equal("a\n"))
+	})
+}
+
+func readAll(t TG, fs *gcs.FileSystem, file string) []string {
+	reader, err := fs.Reader(file, context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
+
+type fakeBucket struct {
+	mu         sync.Mutex
+	objects    map[string]string
+	rangeReads int
+}
+
+func (b *fakeBucket) Objects(ctx context.Context, prefix string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var names []string
+	for name := range b.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (b *fakeBucket) Size(ctx context.Context, name string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.objects[name])), nil
+}
+
+func (b *fakeBucket) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rangeReads++
+
+	data := b.objects[name][offset:]
+	if length >= 0 && int64(len(data)) > length {
+		data = data[:length]
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func (b *fakeBucket) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return &fakeWriter{bucket: b, name: name}
+}
+
+type fakeWriter struct {
+	bytes.Buffer
+	bucket *fakeBucket
+	name   string
+}
+
+func (w *fakeWriter) Close() error {
+	w.bucket.mu.Lock()
+	defer w.bucket.mu.Unlock()
+	w.bucket.objects[w.name] = w.String()
+	return nil
+}
@@ -0,0 +1,168 @@
+// Package hdfs implements a mapreduce.FileSystem over the files of HDFS. Each
+// file is reported to be available on the nodes that hold its blocks, so the
+// calculations run where the data is stored.
+package hdfs
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/poy/mapreduce/fs/records"
+	"golang.org/x/net/context"
+)
+
+// NameNode is the subset of the HDFS API that the FileSystem uses. Use
+// NewWebHDFS to create one that talks to the WebHDFS REST API.
+type NameNode interface {
+	// List returns the paths of the files within the given directory. For a
+	// file, it returns the file itself.
+	List(ctx context.Context, path string) ([]string, error)
+
+	// BlockHosts returns the hosts that store a block within length bytes of
+	// the file starting at offset. A length of 0 means the rest of the file.
+	BlockHosts(ctx context.Context, path string, offset, length uint64) ([]string, error)
+
+	// Open returns the content of the file.
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// Create stores the file, replacing any existing one.
+	Create(ctx context.Context, path string, data []byte) error
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithFormat sets the format of the records. It defaults to records.Lines.
+func WithFormat(f records.Format) Option {
+	return func(fs *FileSystem) {
+		fs.format = f
+	}
+}
+
+// WithHostMapping sets how a DataNode host is mapped to a node ID. It
+// defaults to using the host as the node ID.
+func WithHostMapping(f func(host string) (nodeID string)) Option {
+	return func(fs *FileSystem) {
+		fs.nodeID = f
+	}
+}
+
+// FileSystem implements mapreduce.WriteFileSystem over the files of HDFS.
+//
+// It should be created with New().
+type FileSystem struct {
+	nameNode NameNode
+	nodeIDs  []string
+	nodeID   func(host string) string
+	format   records.Format
+}
+
+// New returns a new FileSystem for the given NameNode. The nodes are the ones
+// that are able to read from HDFS. A file is reported to be available on the
+// nodes that hold one of its blocks, or on every node when none of them do.
+func New(nameNode NameNode, nodeIDs []string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		nameNode: nameNode,
+		nodeIDs:  nodeIDs,
+		nodeID: func(host string) string {
+			return host
+		},
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route names either a file or a
+// directory. For a directory, each file within it is returned.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	paths, err := fs.nameNode.List(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, path := range paths {
+		hosts, err := fs.nameNode.BlockHosts(ctx, path, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := fs.hostNodes(hosts)
+		if len(ids) == 0 {
+			ids = fs.nodeIDs
+		}
+		files[path] = ids
+	}
+	return files, nil
+}
+
+// NodesFor implements mapreduce.LocalityFileSystem. It returns the nodes
+// that hold a block of the range, or none if the NameNode cannot be reached.
+func (fs *FileSystem) NodesFor(file string, start, end uint64) []string {
+	var length uint64
+	if end > start {
+		length = end - start
+	}
+
+	hosts, err := fs.nameNode.BlockHosts(context.Background(), file, start, length)
+	if err != nil {
+		return nil
+	}
+	return fs.hostNodes(hosts)
+}
+
+// Reader implements mapreduce.FileSystem. The file is closed once the reader
+// returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	body, err := fs.nameNode.Open(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	next := records.NewReader(body, fs.format)
+	return func() ([]byte, error) {
+		data, err := next()
+		if err != nil {
+			if !records.IsInvalid(err) {
+				body.Close()
+			}
+			return nil, err
+		}
+		return data, nil
+	}, nil
+}
+
+// Writer implements mapreduce.WriteFileSystem. The records are buffered and
+// stored as a single file once the writer is closed.
+func (fs *FileSystem) Writer(file string, ctx context.Context, meta []byte) (func(data []byte) error, func() error, error) {
+	buf := &bytes.Buffer{}
+	writer := func(data []byte) error {
+		return records.Write(buf, fs.format, data)
+	}
+
+	close := func() error {
+		return fs.nameNode.Create(ctx, file, buf.Bytes())
+	}
+
+	return writer, close, nil
+}
+
+// hostNodes returns the configured nodes that run on one of the hosts.
+func (fs *FileSystem) hostNodes(hosts []string) []string {
+	local := make(map[string]bool)
+	for _, host := range hosts {
+		local[fs.nodeID(host)] = true
+	}
+
+	var ids []string
+	for _, id := range fs.nodeIDs {
+		if local[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,244 @@
+package hdfs_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/hdfs"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TH struct {
+	*testing.T
+	nameNode *fakeNameNode
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TH {
+		return TH{
+			T: t,
+			nameNode: &fakeNameNode{
+				files: map[string]string{
+					"/logs/a": "first\nsecond\n",
+					"/logs/b": "x\n",
+				},
+				hosts: map[string][]string{
+					"/logs/a": {"dn-1", "dn-2"},
+					"/logs/b": {"dn-3"},
+				},
+			},
+		}
+	})
+
+	o.Spec("it implements WriteFileSystem and LocalityFileSystem", func(t TH) {
+		var fs mapreduce.WriteFileSystem = hdfs.New(t.nameNode, nil)
+		_ = fs
+
+		var locality mapreduce.LocalityFileSystem = hdfs.New(t.nameNode, nil)
+		_ = locality
+	})
+
+	o.Spec("it reports the nodes that hold the blocks of each file", func(t TH) {
+		fs := hdfs.New(t.nameNode, []string{"dn-1", "dn-2", "dn-3"})
+		files, err := fs.Files("/logs", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"/logs/a": {"dn-1", "dn-2"},
+			"/logs/b": {"dn-3"},
+		}))
+	})
+
+	o.Spec("it maps the hosts to node IDs", func(t TH) {
+		fs := hdfs.New(t.nameNode, []string{"node-dn-1", "node-dn-3"}, hdfs.WithHostMapping(func(host string) string {
+			return "node-" + host
+		}))
+		files, err := fs.Files("/logs", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files["/logs/a"]).To(Equal([]string{"node-dn-1"}))
+	})
+
+	o.Spec("it reports every node when none hold the blocks", func(t TH) {
+		fs := hdfs.New(t.nameNode, []string{"id-a", "id-b"})
+		files, err := fs.Files("/logs", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files["/logs/b"]).To(Equal([]string{"id-a", "id-b"}))
+	})
+
+	o.Spec("it reports the nodes that hold a range of a file", func(t TH) {
+		fs := hdfs.New(t.nameNode, []string{"dn-1", "dn-2", "dn-3"})
+		Expect(t, fs.NodesFor("/logs/a", 1, 2)).To(Equal([]string{"dn-2"}))
+		Expect(t, fs.NodesFor("/logs/a", 0, 0)).To(Equal([]string{"dn-1", "dn-2"}))
+	})
+
+	o.Spec("it reads the records of a file", func(t TH) {
+		reader, err := hdfs.New(t.nameNode, nil).Reader("/logs/a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(Equal([]string{"first", "second"}))
+	})
+
+	o.Spec("it writes the records on close", func(t TH) {
+		writer, close, err := hdfs.New(t.nameNode, nil).Writer("/out", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		writer([]byte("a"))
+		Expect(t, close() == nil).To(BeTrue())
+		Expect(t, t.nameNode.files["/out"]).To(Equal("a\n"))
+	})
+}
+
+func TestWebHDFS(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TH {
+		return TH{T: t}
+	})
+
+	o.Spec("it lists the files of a directory", func(t TH) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(t, r.URL.Path).To(Equal("/webhdfs/v1/logs"))
+			Expect(t, r.URL.Query().Get("op")).To(Equal("LISTSTATUS"))
+			fmt.Fprint(w, `{"FileStatuses":{"FileStatus":[
+				{"pathSuffix":"a","type":"FILE"},
+				{"pathSuffix":"sub","type":"DIRECTORY"}
+			]}}`)
+		}))
+		defer server.Close()
+
+		paths, err := hdfs.NewWebHDFS(server.URL, nil).List(context.Background(), "/logs")
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, paths).To(Equal([]string{"/logs/a"}))
+	})
+
+	o.Spec("it returns the distinct block hosts", func(t TH) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(t, r.URL.Query().Get("op")).To(Equal("GETFILEBLOCKLOCATIONS"))
+			Expect(t, r.URL.Query().Get("offset")).To(Equal("0"))
+			fmt.Fprint(w, `{"BlockLocations":{"BlockLocation":[
+				{"hosts":["dn-1","dn-2"]},
+				{"hosts":["dn-2","dn-3"]}
+			]}}`)
+		}))
+		defer server.Close()
+
+		hosts, err := hdfs.NewWebHDFS(server.URL, nil).BlockHosts(context.Background(), "/logs/a", 0, 0)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, hosts).To(Equal([]string{"dn-1", "dn-2", "dn-3"}))
+	})
+
+	o.Spec("it returns the remote exception", func(t TH) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"RemoteException":{"exception":"FileNotFoundException","message":"File does not exist: /missing"}}`)
+		}))
+		defer server.Close()
+
+		_, err := hdfs.NewWebHDFS(server.URL, nil).Open(context.Background(), "/missing")
+		Expect(t, err == nil).To(BeFalse())
+		Expect(t, err.Error()).To(Equal("webhdfs /missing: FileNotFoundException: File does not exist: /missing"))
+	})
+
+	o.Spec("it follows the redirect to create a file", func(t TH) {
+		var created string
+		dataNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			created = string(data)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer dataNode.Close()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(t, r.Method).To(Equal("PUT"))
+			Expect(t, r.URL.Query().Get("op")).To(Equal("CREATE"))
+			http.Redirect(w, r, dataNode.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		}))
+		defer server.Close()
+
+		err := hdfs.NewWebHDFS(server.URL, nil).Create(context.Background(), "/out", []byte("a\n"))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, created).To(Equal("a\n"))
+	})
+}
+
+func readAll(t TH, reader func() ([]byte, error)) []string {
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
+
+type fakeNameNode struct {
+	mu    sync.Mutex
+	files map[string]string
+	hosts map[string][]string
+}
+
+func (n *fakeNameNode) List(ctx context.Context, path string) ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var paths []string
+	for name := range n.files {
+		if strings.HasPrefix(name, path+"/") {
+			paths = append(paths, name)
+		}
+	}
+	return paths, nil
+}
+
+func (n *fakeNameNode) BlockHosts(ctx context.Context, path string, offset, length uint64) ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Each fake block is a single byte, hosted by one of the hosts in turn.
+	hosts := n.hosts[path]
+	if length == 0 {
+		return hosts, nil
+	}
+
+	seen := make(map[string]bool)
+	var blockHosts []string
+	for i := offset; i < offset+length && len(seen) < len(hosts); i++ {
+		host := hosts[int(i)%len(hosts)]
+		if !seen[host] {
+			seen[host] = true
+			blockHosts = append(blockHosts, host)
+		}
+	}
+	return blockHosts, nil
+}
+
+func (n *fakeNameNode) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return ioutil.NopCloser(strings.NewReader(n.files[path])), nil
+}
+
+func (n *fakeNameNode) Create(ctx context.Context, path string, data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.files[path] = string(data)
+	return nil
+}
@@ -0,0 +1,153 @@
+package hdfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"golang.org/x/net/context"
+)
+
+// NewWebHDFS returns a NameNode that uses the WebHDFS REST API of the
+// NameNode at the given address (e.g., http://namenode:9870). If client is
+// nil, http.DefaultClient is used.
+func NewWebHDFS(addr string, client *http.Client) NameNode {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return webHDFS{
+		addr:   addr,
+		client: client,
+	}
+}
+
+type webHDFS struct {
+	addr   string
+	client *http.Client
+}
+
+func (w webHDFS) List(ctx context.Context, p string) ([]string, error) {
+	var resp struct {
+		FileStatuses struct {
+			FileStatus []struct {
+				PathSuffix string `json:"pathSuffix"`
+				Type       string `json:"type"`
+			}
+		}
+	}
+
+	if err := w.getJSON(ctx, p, "LISTSTATUS", &resp); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, status := range resp.FileStatuses.FileStatus {
+		if status.Type != "FILE" {
+			continue
+		}
+		paths = append(paths, path.Join(p, status.PathSuffix))
+	}
+	return paths, nil
+}
+
+func (w webHDFS) BlockHosts(ctx context.Context, p string, offset, length uint64) ([]string, error) {
+	var resp struct {
+		BlockLocations struct {
+			BlockLocation []struct {
+				Hosts []string `json:"hosts"`
+			}
+		}
+	}
+
+	op := fmt.Sprintf("GETFILEBLOCKLOCATIONS&offset=%d", offset)
+	if length > 0 {
+		op += fmt.Sprintf("&length=%d", length)
+	}
+
+	if err := w.getJSON(ctx, p, op, &resp); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, block := range resp.BlockLocations.BlockLocation {
+		for _, host := range block.Hosts {
+			if seen[host] {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+func (w webHDFS) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	resp, err := w.do(ctx, "GET", p, "OPEN", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (w webHDFS) Create(ctx context.Context, p string, data []byte) error {
+	// The NameNode redirects to a DataNode. The client follows the redirect
+	// and sends the data again.
+	resp, err := w.do(ctx, "PUT", p, "CREATE&overwrite=true", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (w webHDFS) getJSON(ctx context.Context, p, op string, v interface{}) error {
+	resp, err := w.do(ctx, "GET", p, op, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (w webHDFS) do(ctx context.Context, method, p, op string, body io.Reader) (*http.Response, error) {
+	u := fmt.Sprintf("%s/webhdfs/v1%s?op=%s", w.addr, (&url.URL{Path: path.Join("/", p)}).EscapedPath(), op)
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, remoteError(p, resp)
+	}
+
+	return resp, nil
+}
+
+// remoteError returns the RemoteException reported by WebHDFS.
+func remoteError(p string, resp *http.Response) error {
+	var e struct {
+		RemoteException struct {
+			Exception string `json:"exception"`
+			Message   string `json:"message"`
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.RemoteException.Message == "" {
+		return fmt.Errorf("webhdfs %s: unexpected status %d", p, resp.StatusCode)
+	}
+
+	return fmt.Errorf("webhdfs %s: %s: %s", p, e.RemoteException.Exception, e.RemoteException.Message)
+}
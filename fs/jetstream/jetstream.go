@@ -0,0 +1,155 @@
+// Package jetstream implements a mapreduce.FileSystem over NATS JetStream
+// streams. Each stream is a file and each message within it is a record, so
+// a bounded reprocessing job can run straight off a stream without dumping
+// it to files first.
+package jetstream
+
+import (
+	"io"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+)
+
+// Client is the subset of the JetStream API that the FileSystem uses. It is
+// usually a thin wrapper around the NATS client.
+type Client interface {
+	// Sequences returns the sequence of the first message of the stream
+	// that is still available and the sequence of the last message. An
+	// empty stream has a last sequence below the first one.
+	Sequences(ctx context.Context, stream string) (first, last uint64, err error)
+
+	// Read returns a reader for the messages of the stream, starting at the
+	// given sequence. The reader returns each message with its sequence. It
+	// has to return io.EOF once it has returned every message that was in
+	// the stream when Read was invoked, instead of waiting for new ones.
+	Read(ctx context.Context, stream string, seq uint64) (reader func() (data []byte, seq uint64, err error), err error)
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithDiscovery reports the files to be available on the nodes that the
+// Discovery currently reports, instead of the nodes given to New. It picks up
+// nodes that start reading from the streams without a restart.
+func WithDiscovery(d mapreduce.Discovery) Option {
+	return func(fs *FileSystem) {
+		fs.discovery = d
+	}
+}
+
+// FileSystem implements mapreduce.RangeFileSystem over JetStream streams. A
+// file is named after its stream. Its sequences are used as the byte offsets
+// of a split, so a stream can be calculated in ranges of sequences with
+// mapreduce.WithSplitSize. Streams can be read from any node, so each file
+// is reported to be available on every configured node.
+//
+// It should be created with New().
+type FileSystem struct {
+	client    Client
+	discovery mapreduce.Discovery
+}
+
+// New returns a new FileSystem for the given client. The nodes are the ones
+// that are able to read from the streams.
+func New(client Client, nodeIDs []string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		client:    client,
+		discovery: mapreduce.StaticNodes(nodeIDs...),
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route is the name of a stream.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	if _, _, err := fs.client.Sequences(ctx, route); err != nil {
+		return nil, err
+	}
+
+	nodeIDs, err := fs.discovery.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]string{route: nodeIDs}, nil
+}
+
+// Stat implements mapreduce.StatFileSystem. The size of a stream is the
+// sequence that follows its last message.
+func (fs *FileSystem) Stat(file string, ctx context.Context, meta []byte) (mapreduce.FileInfo, error) {
+	first, last, err := fs.client.Sequences(ctx, file)
+	if err != nil {
+		return mapreduce.FileInfo{}, err
+	}
+
+	var records int64
+	if last >= first {
+		records = int64(last - first + 1)
+	}
+
+	return mapreduce.FileInfo{
+		Size:    int64(last + 1),
+		Records: records,
+	}, nil
+}
+
+// Reader implements mapreduce.FileSystem. It reads the messages that are in
+// the stream when it is invoked.
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	return fs.RangeReader(file, 0, 0, ctx, meta)
+}
+
+// RangeReader implements mapreduce.RangeFileSystem. It reads the messages
+// with a sequence from start up to, but not including, end. An end of 0
+// reads the messages that are in the stream when it is invoked.
+func (fs *FileSystem) RangeReader(file string, start, end uint64, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	first, last, err := fs.client.Sequences(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if start < first {
+		start = first
+	}
+
+	if end == 0 || end > last+1 {
+		end = last + 1
+	}
+
+	if start >= end {
+		return func() ([]byte, error) {
+			return nil, io.EOF
+		}, nil
+	}
+
+	read, err := fs.client.Read(ctx, file, start)
+	if err != nil {
+		return nil, err
+	}
+
+	done := false
+	return func() ([]byte, error) {
+		if done {
+			return nil, io.EOF
+		}
+
+		data, seq, err := read()
+		if err != nil {
+			return nil, err
+		}
+
+		if seq >= end {
+			done = true
+			return nil, io.EOF
+		}
+
+		if seq == end-1 {
+			done = true
+		}
+		return data, nil
+	}, nil
+}
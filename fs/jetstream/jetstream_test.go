@@ -0,0 +1,129 @@
+package jetstream_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/jetstream"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TJ struct {
+	*testing.T
+	fs *jetstream.FileSystem
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TJ {
+		client := fakeClient{
+			"orders": {first: 3, messages: []string{"c", "d", "e"}},
+			"empty":  {first: 1},
+		}
+
+		return TJ{
+			T:  t,
+			fs: jetstream.New(client, []string{"id-a", "id-b"}),
+		}
+	})
+
+	o.Spec("it implements RangeFileSystem and StatFileSystem", func(t TJ) {
+		var fs mapreduce.RangeFileSystem = t.fs
+		_ = fs
+
+		var statter mapreduce.StatFileSystem = t.fs
+		_ = statter
+	})
+
+	o.Spec("it reports the stream on every node", func(t TJ) {
+		files, err := t.fs.Files("orders", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"orders": {"id-a", "id-b"},
+		}))
+	})
+
+	o.Spec("it returns an error for an unknown stream", func(t TJ) {
+		_, err := t.fs.Files("unknown", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it reports the sequences as the size", func(t TJ) {
+		info, err := t.fs.Stat("orders", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, info).To(Equal(mapreduce.FileInfo{Size: 6, Records: 3}))
+
+		info, err = t.fs.Stat("empty", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, info.Records).To(Equal(int64(0)))
+	})
+
+	o.Spec("it reads every available message", func(t TJ) {
+		reader, err := t.fs.Reader("orders", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(Equal([]string{"c", "d", "e"}))
+	})
+
+	o.Spec("it reads a range of sequences", func(t TJ) {
+		reader, err := t.fs.RangeReader("orders", 0, 5, context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(Equal([]string{"c", "d"}))
+	})
+
+	o.Spec("it reads nothing from an empty stream", func(t TJ) {
+		reader, err := t.fs.Reader("empty", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(HaveLen(0))
+	})
+}
+
+func readAll(t TJ, reader func() ([]byte, error)) []string {
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
+
+type fakeStream struct {
+	first    uint64
+	messages []string
+}
+
+type fakeClient map[string]fakeStream
+
+func (c fakeClient) Sequences(ctx context.Context, stream string) (uint64, uint64, error) {
+	s, ok := c[stream]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown stream %s", stream)
+	}
+	return s.first, s.first + uint64(len(s.messages)) - 1, nil
+}
+
+func (c fakeClient) Read(ctx context.Context, stream string, seq uint64) (func() ([]byte, uint64, error), error) {
+	s := c[stream]
+	return func() ([]byte, uint64, error) {
+		i := seq - s.first
+		if i >= uint64(len(s.messages)) {
+			return nil, 0, io.EOF
+		}
+
+		seq++
+		return []byte(s.messages[i]), seq - 1, nil
+	}, nil
+}
@@ -0,0 +1,191 @@
+// Package kafka implements a mapreduce.FileSystem over the partitions of
+// Kafka topics. Each partition is a file and each message within it is a
+// record, so a bounded reprocessing job can run straight off the log without
+// dumping it to files first.
+package kafka
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+)
+
+// Client is the subset of the Kafka API that the FileSystem uses. It is
+// usually a thin wrapper around a Kafka client library.
+type Client interface {
+	// Partitions returns the partitions of the topic.
+	Partitions(ctx context.Context, topic string) ([]int32, error)
+
+	// Offsets returns the offset of the oldest message of the partition
+	// that is still available and the offset of the next message that will
+	// be written to it.
+	Offsets(ctx context.Context, topic string, partition int32) (oldest, next int64, err error)
+
+	// Read returns a reader for the messages of the partition, starting at
+	// the given offset. The reader returns each message with its offset. It
+	// has to return io.EOF once it has returned every message that was in
+	// the partition when Read was invoked, instead of waiting for new ones.
+	Read(ctx context.Context, topic string, partition int32, offset int64) (reader func() (value []byte, offset int64, err error), err error)
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithDiscovery reports the files to be available on the nodes that the
+// Discovery currently reports, instead of the nodes given to New. It picks up
+// nodes that start reading from the cluster without a restart.
+func WithDiscovery(d mapreduce.Discovery) Option {
+	return func(fs *FileSystem) {
+		fs.discovery = d
+	}
+}
+
+// FileSystem implements mapreduce.RangeFileSystem over the partitions of a
+// Kafka cluster. A file is named topic/partition. Its offsets are used as
+// the byte offsets of a split, so a partition can be calculated in ranges
+// of offsets with mapreduce.WithSplitSize. Partitions can be read from any
+// node, so each file is reported to be available on every configured node.
+//
+// It should be created with New().
+type FileSystem struct {
+	client    Client
+	discovery mapreduce.Discovery
+}
+
+// New returns a new FileSystem for the given client. The nodes are the ones
+// that are able to read from the cluster.
+func New(client Client, nodeIDs []string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		client:    client,
+		discovery: mapreduce.StaticNodes(nodeIDs...),
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route is either a topic, which
+// returns each of its partitions, or a single topic/partition.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	nodeIDs, err := fs.discovery.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := parseFile(route); err == nil {
+		return map[string][]string{route: nodeIDs}, nil
+	}
+
+	partitions, err := fs.client.Partitions(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, p := range partitions {
+		files[fmt.Sprintf("%s/%d", route, p)] = nodeIDs
+	}
+	return files, nil
+}
+
+// Stat implements mapreduce.StatFileSystem. The size of a partition is the
+// offset of its next message.
+func (fs *FileSystem) Stat(file string, ctx context.Context, meta []byte) (mapreduce.FileInfo, error) {
+	topic, partition, err := parseFile(file)
+	if err != nil {
+		return mapreduce.FileInfo{}, err
+	}
+
+	oldest, next, err := fs.client.Offsets(ctx, topic, partition)
+	if err != nil {
+		return mapreduce.FileInfo{}, err
+	}
+
+	return mapreduce.FileInfo{
+		Size:    next,
+		Records: next - oldest,
+	}, nil
+}
+
+// Reader implements mapreduce.FileSystem. It reads the messages that are in
+// the partition when it is invoked.
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	return fs.RangeReader(file, 0, 0, ctx, meta)
+}
+
+// RangeReader implements mapreduce.RangeFileSystem. It reads the messages
+// with an offset from start up to, but not including, end. An end of 0
+// reads the messages that are in the partition when it is invoked.
+func (fs *FileSystem) RangeReader(file string, start, end uint64, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	topic, partition, err := parseFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	oldest, next, err := fs.client.Offsets(ctx, topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(start) < oldest {
+		start = uint64(oldest)
+	}
+
+	if end == 0 || int64(end) > next {
+		end = uint64(next)
+	}
+
+	if start >= end {
+		return func() ([]byte, error) {
+			return nil, io.EOF
+		}, nil
+	}
+
+	read, err := fs.client.Read(ctx, topic, partition, int64(start))
+	if err != nil {
+		return nil, err
+	}
+
+	done := false
+	return func() ([]byte, error) {
+		if done {
+			return nil, io.EOF
+		}
+
+		value, offset, err := read()
+		if err != nil {
+			return nil, err
+		}
+
+		if uint64(offset) >= end {
+			done = true
+			return nil, io.EOF
+		}
+
+		if uint64(offset) == end-1 {
+			done = true
+		}
+		return value, nil
+	}, nil
+}
+
+// parseFile splits a file into its topic and partition.
+func parseFile(file string) (topic string, partition int32, err error) {
+	i := strings.LastIndex(file, "/")
+	if i < 0 {
+		return "", 0, fmt.Errorf("%s is not a topic/partition", file)
+	}
+
+	p, err := strconv.ParseInt(file[i+1:], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s is not a topic/partition", file)
+	}
+	return file[:i], int32(p), nil
+}
@@ -0,0 +1,135 @@
+package kafka_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/kafka"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TK struct {
+	*testing.T
+	fs *kafka.FileSystem
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TK {
+		client := fakeClient{
+			"events": {
+				{oldest: 0, messages: []string{"a", "b", "c", "d"}},
+				{oldest: 2, messages: []string{"c", "d"}},
+			},
+		}
+
+		return TK{
+			T:  t,
+			fs: kafka.New(client, []string{"id-a", "id-b"}),
+		}
+	})
+
+	o.Spec("it implements RangeFileSystem and StatFileSystem", func(t TK) {
+		var fs mapreduce.RangeFileSystem = t.fs
+		_ = fs
+
+		var statter mapreduce.StatFileSystem = t.fs
+		_ = statter
+	})
+
+	o.Spec("it reports each partition of the topic", func(t TK) {
+		files, err := t.fs.Files("events", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"events/0": {"id-a", "id-b"},
+			"events/1": {"id-a", "id-b"},
+		}))
+	})
+
+	o.Spec("it reports a single partition", func(t TK) {
+		files, err := t.fs.Files("events/1", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"events/1": {"id-a", "id-b"},
+		}))
+	})
+
+	o.Spec("it reports the offsets as the size", func(t TK) {
+		info, err := t.fs.Stat("events/1", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, info).To(Equal(mapreduce.FileInfo{Size: 4, Records: 2}))
+	})
+
+	o.Spec("it reads every available message", func(t TK) {
+		reader, err := t.fs.Reader("events/1", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(Equal([]string{"c", "d"}))
+	})
+
+	o.Spec("it reads a range of offsets", func(t TK) {
+		reader, err := t.fs.RangeReader("events/0", 1, 3, context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(Equal([]string{"b", "c"}))
+	})
+
+	o.Spec("it skips the offsets that are no longer available", func(t TK) {
+		reader, err := t.fs.RangeReader("events/1", 0, 3, context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, readAll(t, reader)).To(Equal([]string{"c"}))
+	})
+}
+
+func readAll(t TK, reader func() ([]byte, error)) []string {
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
+
+type fakePartition struct {
+	oldest   int64
+	messages []string
+}
+
+type fakeClient map[string][]fakePartition
+
+func (c fakeClient) Partitions(ctx context.Context, topic string) ([]int32, error) {
+	var partitions []int32
+	for i := range c[topic] {
+		partitions = append(partitions, int32(i))
+	}
+	return partitions, nil
+}
+
+func (c fakeClient) Offsets(ctx context.Context, topic string, partition int32) (int64, int64, error) {
+	p := c[topic][partition]
+	return p.oldest, p.oldest + int64(len(p.messages)), nil
+}
+
+func (c fakeClient) Read(ctx context.Context, topic string, partition int32, offset int64) (func() ([]byte, int64, error), error) {
+	p := c[topic][partition]
+	return func() ([]byte, int64, error) {
+		i := offset - p.oldest
+		if i >= int64(len(p.messages)) {
+			return nil, 0, io.EOF
+		}
+
+		offset++
+		return []byte(p.messages[i]), offset - 1, nil
+	}, nil
+}
@@ -0,0 +1,303 @@
+// Package local implements a mapreduce.FileSystem over files on the local
+// disk.
+package local
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/records"
+	"golang.org/x/net/context"
+)
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithFormat sets the format of the records. It defaults to records.Lines.
+func WithFormat(f records.Format) Option {
+	return func(fs *FileSystem) {
+		fs.format = f
+	}
+}
+
+// FileSystem implements mapreduce.WriteFileSystem over the files within a
+// root directory. Every file is reported to be available on a single node.
+//
+// It should be created with New().
+type FileSystem struct {
+	root   string
+	nodeID string
+	format records.Format
+}
+
+// New returns a new FileSystem for the files within root. The files are
+// reported to be available on the given node.
+func New(root, nodeID string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		root:   root,
+		nodeID: nodeID,
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route names either a file or a
+// directory relative to the root. For a directory, each file within it is
+// returned. The route may also be a glob pattern (see filepath.Match), in
+// which case every file or directory that matches is used.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	if !hasGlob(route) {
+		return fs.files(route)
+	}
+
+	matches, err := filepath.Glob(fs.path(route))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, match := range matches {
+		name, err := filepath.Rel(fs.root, match)
+		if err != nil {
+			return nil, err
+		}
+
+		matched, err := fs.files(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, ids := range matched {
+			files[name] = ids
+		}
+	}
+	return files, nil
+}
+
+// files returns the file or the files within the directory.
+func (fs *FileSystem) files(route string) (map[string][]string, error) {
+	info, err := os.Stat(fs.path(route))
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return map[string][]string{route: {fs.nodeID}}, nil
+	}
+
+	infos, err := ioutil.ReadDir(fs.path(route))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			files[filepath.Join(route, info.Name())] = []string{fs.nodeID}
+		}
+	}
+	return files, nil
+}
+
+// List implements mapreduce.ListFileSystem. The prefix names a file or a
+// directory relative to the root. For a directory, every file below it is
+// returned, including the ones within nested directories.
+func (fs *FileSystem) List(prefix string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	files := make(map[string][]string)
+	err := filepath.Walk(fs.path(prefix), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := filepath.Rel(fs.root, path)
+		if err != nil {
+			return err
+		}
+
+		files[name] = []string{fs.nodeID}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Stat implements mapreduce.StatFileSystem. The number of records is not
+// known without reading the file, so it is reported as -1.
+func (fs *FileSystem) Stat(file string, ctx context.Context, meta []byte) (mapreduce.FileInfo, error) {
+	info, err := os.Stat(fs.path(file))
+	if err != nil {
+		return mapreduce.FileInfo{}, err
+	}
+
+	return mapreduce.FileInfo{
+		Size:    info.Size(),
+		Records: -1,
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Reader implements mapreduce.FileSystem. The file is closed once the reader
+// returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	f, err := os.Open(fs.path(file))
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.closingReader(f, records.NewReader(f, fs.format), ctx), nil
+}
+
+// ChecksumReader implements mapreduce.ChecksumFileSystem. Only files of the
+// records.Checksummed format have checksums. The file is closed once the
+// reader returns an error (including io.EOF).
+func (fs *FileSystem) ChecksumReader(file string, ctx context.Context, meta []byte) (func() ([]byte, uint32, error), error) {
+	if fs.format != records.Checksummed {
+		return nil, nil
+	}
+
+	f, err := os.Open(fs.path(file))
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := records.NewChecksumReader(f, fs.format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() ([]byte, uint32, error) {
+		if err := ctx.Err(); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+
+		data, checksum, err := next()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return data, checksum, nil
+	}, nil
+}
+
+// RangeReader implements mapreduce.RangeFileSystem. Only files of the
+// records.Lines format can be read in ranges. The file is closed once the
+// reader returns an error (including io.EOF).
+func (fs *FileSystem) RangeReader(file string, start, end uint64, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	f, err := os.Open(fs.path(file))
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := records.NewRangeReader(f, fs.format, start, end)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return fs.closingReader(f, next, ctx), nil
+}
+
+// Seeker implements mapreduce.SeekFileSystem. Unlike Reader, the file is
+// only closed by close, so that it can be read again after seeking.
+func (fs *FileSystem) Seeker(file string, ctx context.Context, meta []byte) (func() ([]byte, error), func(record uint64) error, func() error, error) {
+	f, err := os.Open(fs.path(file))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	seeker, err := records.NewSeeker(f, fs.format)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+
+	reader := func() ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return seeker.Next()
+	}
+
+	return reader, seeker.Seek, f.Close, nil
+}
+
+// Writer implements mapreduce.WriteFileSystem. It replaces any existing
+// file.
+func (fs *FileSystem) Writer(file string, ctx context.Context, meta []byte) (func(data []byte) error, func() error, error) {
+	path := fs.path(file)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := bufio.NewWriter(f)
+	writer := func(data []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return records.Write(w, fs.format, data)
+	}
+
+	close := func() error {
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	return writer, close, nil
+}
+
+// closingReader wraps next so that the file is closed once it returns an
+// error other than an invalid record or the context is done.
+func (fs *FileSystem) closingReader(f *os.File, next func() ([]byte, error), ctx context.Context) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		data, err := next()
+		if err != nil {
+			if !records.IsInvalid(err) {
+				f.Close()
+			}
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// hasGlob reports whether the route contains any of the special characters
+// of a glob pattern.
+func hasGlob(route string) bool {
+	return strings.ContainsAny(route, "*?[")
+}
+
+// path returns the path on disk for the given name. The name can not
+// escape the root.
+func (fs *FileSystem) path(name string) string {
+	return filepath.Join(fs.root, filepath.Clean("/"+name))
+}
@@ -0,0 +1,351 @@
+package local_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/local"
+	"github.com/poy/mapreduce/fs/records"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	os.Exit(m.Run())
+}
+
+type TL struct {
+	*testing.T
+	dir string
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TL {
+		dir, err := ioutil.TempDir("", "local")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return TL{
+			T:   t,
+			dir: dir,
+		}
+	})
+
+	o.AfterEach(func(t TL) {
+		os.RemoveAll(t.dir)
+	})
+
+	o.Spec("it implements the optional FileSystem interfaces", func(t TL) {
+		var fs mapreduce.WriteFileSystem = local.New(t.dir, "some-id")
+		_ = fs
+
+		var lister mapreduce.ListFileSystem = local.New(t.dir, "some-id")
+		_ = lister
+
+		var statter mapreduce.StatFileSystem = local.New(t.dir, "some-id")
+		_ = statter
+
+		var ranger mapreduce.RangeFileSystem = local.New(t.dir, "some-id")
+		_ = ranger
+
+		var seeker mapreduce.SeekFileSystem = local.New(t.dir, "some-id")
+		_ = seeker
+
+		var checksums mapreduce.ChecksumFileSystem = local.New(t.dir, "some-id")
+		_ = checksums
+	})
+
+	o.Spec("it describes a file", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), []byte("first\nsecond\n"), 0644)
+
+		info, err := local.New(t.dir, "some-id").Stat("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, info.Size).To(Equal(int64(13)))
+		Expect(t, info.Records).To(Equal(int64(-1)))
+		Expect(t, info.ModTime.IsZero()).To(BeFalse())
+	})
+
+	o.Spec("it returns the files of a directory", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), nil, 0644)
+		ioutil.WriteFile(filepath.Join(t.dir, "b"), nil, 0644)
+
+		files, err := local.New(t.dir, "some-id").Files(".", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"a": {"some-id"},
+			"b": {"some-id"},
+		}))
+	})
+
+	o.Spec("it returns a single file", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), nil, 0644)
+
+		files, err := local.New(t.dir, "some-id").Files("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"a": {"some-id"},
+		}))
+	})
+
+	o.Spec("it returns the files that match a glob", func(t TL) {
+		os.Mkdir(filepath.Join(t.dir, "logs"), 0755)
+		ioutil.WriteFile(filepath.Join(t.dir, "logs", "2024-05-01"), nil, 0644)
+		ioutil.WriteFile(filepath.Join(t.dir, "logs", "2024-05-02"), nil, 0644)
+		ioutil.WriteFile(filepath.Join(t.dir, "logs", "2024-06-01"), nil, 0644)
+
+		files, err := local.New(t.dir, "some-id").Files("logs/2024-05-*", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/2024-05-01": {"some-id"},
+			"logs/2024-05-02": {"some-id"},
+		}))
+	})
+
+	o.Spec("it lists the files below a directory", func(t TL) {
+		os.MkdirAll(filepath.Join(t.dir, "logs", "2024", "05"), 0755)
+		ioutil.WriteFile(filepath.Join(t.dir, "logs", "a"), nil, 0644)
+		ioutil.WriteFile(filepath.Join(t.dir, "logs", "2024", "05", "b"), nil, 0644)
+		ioutil.WriteFile(filepath.Join(t.dir, "other"), nil, 0644)
+
+		files, err := local.New(t.dir, "some-id").List("logs", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/a":         {"some-id"},
+			"logs/2024/05/b": {"some-id"},
+		}))
+	})
+
+	o.Spec("it reads lines", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), []byte("a\nb\nc"), 0644)
+
+		records := readAll(t, local.New(t.dir, "some-id"), "a")
+		Expect(t, records).To(Equal([]string{"a", "b", "c"}))
+	})
+
+	o.Spec("it reads the records that start within a range", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), []byte("first\nsecond\nthird\n"), 0644)
+		fs := local.New(t.dir, "some-id")
+
+		var splits [][]string
+		for _, r := range [][2]uint64{{0, 8}, {8, 16}, {16, 19}, {6, 13}} {
+			reader, err := fs.RangeReader("a", r[0], r[1], context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			splits = append(splits, drain(t, reader))
+		}
+
+		Expect(t, splits).To(Equal([][]string{
+			{"first", "second"},
+			{"third"},
+			nil,
+			{"second"},
+		}))
+	})
+
+	o.Spec("it does not read ranges of length prefixed records", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), nil, 0644)
+
+		_, err := local.New(t.dir, "some-id", local.WithFormat(records.LengthPrefixed)).RangeReader("a", 0, 1, context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it seeks to a record", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), []byte("first\nsecond\nthird\n"), 0644)
+		reader, seek, close, err := local.New(t.dir, "some-id").Seeker("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		defer close()
+
+		Expect(t, seek(2) == nil).To(BeTrue())
+		Expect(t, drain(t, reader)).To(Equal([]string{"third"}))
+
+		Expect(t, seek(1) == nil).To(BeTrue())
+		Expect(t, drain(t, reader)).To(Equal([]string{"second", "third"}))
+
+		Expect(t, seek(3) == nil).To(BeTrue())
+		Expect(t, drain(t, reader)).To(HaveLen(0))
+	})
+
+	o.Spec("it seeks to length prefixed records", func(t TL) {
+		fs := local.New(t.dir, "some-id", local.WithFormat(records.LengthPrefixed))
+		writer, close, _ := fs.Writer("a", context.Background(), nil)
+		writer([]byte("first"))
+		writer([]byte("second\nline"))
+		writer([]byte("third"))
+		close()
+
+		reader, seek, close, err := fs.Seeker("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		defer close()
+		Expect(t, drain(t, reader)).To(HaveLen(3))
+
+		Expect(t, seek(1) == nil).To(BeTrue())
+		Expect(t, drain(t, reader)).To(Equal([]string{"second\nline", "third"}))
+	})
+
+	o.Spec("it closes the file of a seeker", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), []byte("first\n"), 0644)
+
+		reader, _, close, err := local.New(t.dir, "some-id").Seeker("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, close() == nil).To(BeTrue())
+
+		_, err = reader()
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it reads compressed files", func(t TL) {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write([]byte("a\nb\n"))
+		w.Close()
+		ioutil.WriteFile(filepath.Join(t.dir, "a.gz"), gz.Bytes(), 0644)
+
+		enc, _ := zstd.NewWriter(nil)
+		ioutil.WriteFile(filepath.Join(t.dir, "b.zst"), enc.EncodeAll([]byte("c\n"), nil), 0644)
+		ioutil.WriteFile(filepath.Join(t.dir, "c"), []byte("d\n"), 0644)
+
+		fs := local.New(t.dir, "some-id", local.WithFormat(records.Lines|records.Compressed))
+		Expect(t, readAll(t, fs, "a.gz")).To(Equal([]string{"a", "b"}))
+		Expect(t, readAll(t, fs, "b.zst")).To(Equal([]string{"c"}))
+		Expect(t, readAll(t, fs, "c")).To(Equal([]string{"d"}))
+	})
+
+	o.Spec("it does not seek or write compressed files", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a"), []byte("first\n"), 0644)
+		fs := local.New(t.dir, "some-id", local.WithFormat(records.Lines|records.Compressed))
+
+		_, _, _, err := fs.Seeker("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+
+		writer, close, err := fs.Writer("b", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, writer([]byte("a")) == nil).To(BeFalse())
+		close()
+	})
+
+	o.Spec("it reads CSV rows", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a.csv"), []byte("name;note\r\na;\"first\nline\"\r\nb;\"say \"\"hi\"\"\"\r\n"), 0644)
+
+		rows := readAll(t, local.New(t.dir, "some-id", local.WithFormat(records.CSV|records.Header)), "a.csv")
+		Expect(t, rows).To(HaveLen(2))
+
+		fields, err := records.ParseCSV([]byte(rows[0]), ';')
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, fields).To(Equal([]string{"a", "first\nline"}))
+
+		fields, err = records.ParseCSV([]byte(rows[1]), ';')
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, fields).To(Equal([]string{"b", `say "hi"`}))
+	})
+
+	o.Spec("it reads JSON objects", func(t TL) {
+		ioutil.WriteFile(filepath.Join(t.dir, "a.json"), []byte("{\"user\":{\"id\":\"a\"}}\n\n{\"user\":\n{\"id\":7}\n"), 0644)
+		reader, err := local.New(t.dir, "some-id", local.WithFormat(records.JSONLines)).Reader("a.json", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		object, err := reader()
+		Expect(t, err == nil).To(BeTrue())
+		key, err := records.JSONKey(object, "user", "id")
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, key).To(Equal("a"))
+
+		_, err = reader()
+		invalid, ok := err.(*records.InvalidRecordError)
+		Expect(t, ok).To(BeTrue())
+		Expect(t, invalid.Data).To(Equal([]byte(`{"user":`)))
+
+		object, err = reader()
+		Expect(t, err == nil).To(BeTrue())
+		key, err = records.JSONKey(object, "id")
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, key).To(Equal("7"))
+
+		_, err = reader()
+		Expect(t, err).To(Equal(io.EOF))
+	})
+
+	o.Spec("it reads the checksums of checksummed records", func(t TL) {
+		fs := local.New(t.dir, "some-id", local.WithFormat(records.Checksummed))
+		writer, close, _ := fs.Writer("a", context.Background(), nil)
+		writer([]byte("first"))
+		close()
+
+		Expect(t, readAll(t, fs, "a")).To(Equal([]string{"first"}))
+
+		reader, err := fs.ChecksumReader("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		data, checksum, err := reader()
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, data).To(Equal([]byte("first")))
+		Expect(t, checksum).To(Equal(crc32.Checksum([]byte("first"), crc32.MakeTable(crc32.Castagnoli))))
+	})
+
+	o.Spec("it does not return checksums for other formats", func(t TL) {
+		reader, err := local.New(t.dir, "some-id").ChecksumReader("a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, reader == nil).To(BeTrue())
+	})
+
+	o.Spec("it reads what it writes", func(t TL) {
+		for _, format := range []records.Format{records.Lines, records.LengthPrefixed} {
+			fs := local.New(t.dir, "some-id", local.WithFormat(format))
+			writer, close, err := fs.Writer("sub/a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+
+			writer([]byte("a"))
+			writer([]byte("b"))
+			Expect(t, close() == nil).To(BeTrue())
+
+			Expect(t, readAll(t, fs, "sub/a")).To(Equal([]string{"a", "b"}))
+		}
+	})
+
+	o.Spec("it does not read files outside of the root", func(t TL) {
+		_, err := local.New(filepath.Join(t.dir, "root"), "some-id").Reader("../../etc/passwd", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+func readAll(t TL, fs *local.FileSystem, file string) []string {
+	reader, err := fs.Reader(file, context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return drain(t, reader)
+}
+
+func drain(t TL, reader func() ([]byte, error)) []string {
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
@@ -0,0 +1,52 @@
+package parquet
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/poy/mapreduce/fs/local"
+	"golang.org/x/net/context"
+)
+
+// Dir returns a Source for the Parquet files below the root directory. The
+// routes are resolved like they are by local.FileSystem and the files are
+// reported to be available on the given node.
+func Dir(root, nodeID string) Source {
+	return dir{
+		root:  root,
+		local: local.New(root, nodeID),
+	}
+}
+
+type dir struct {
+	root  string
+	local *local.FileSystem
+}
+
+func (d dir) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return d.local.Files(route, ctx, meta)
+}
+
+func (d dir) Open(file string, ctx context.Context) (File, error) {
+	f, err := os.Open(filepath.Join(d.root, filepath.Clean("/"+file)))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return osFile{File: f, size: info.Size()}, nil
+}
+
+type osFile struct {
+	*os.File
+	size int64
+}
+
+func (f osFile) Size() int64 {
+	return f.size
+}
@@ -0,0 +1,280 @@
+// Package parquet implements a mapreduce.FileSystem over Parquet files. Each
+// row is a record, encoded as a JSON object that maps the path of each
+// column to its value. Only the projected columns are read.
+package parquet
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"golang.org/x/net/context"
+)
+
+// File is a Parquet file that can be read at any offset.
+type File interface {
+	io.ReaderAt
+	io.Closer
+
+	// Size returns the size of the file in bytes.
+	Size() int64
+}
+
+// Source provides the Parquet files. Use Dir for files on the local disk.
+type Source interface {
+	// Files behaves like mapreduce.FileSystem.Files.
+	Files(route string, ctx context.Context, meta []byte) (map[string][]string, error)
+
+	// Open opens the file.
+	Open(file string, ctx context.Context) (File, error)
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithColumns projects the rows onto the given columns, so that no other
+// column is read. Nested columns are named by their path joined with dots
+// (e.g., "user.id"). By default every column is read.
+func WithColumns(columns ...string) Option {
+	return func(fs *FileSystem) {
+		fs.columns = columns
+	}
+}
+
+// FileSystem implements mapreduce.FileSystem over Parquet files. The row
+// groups of a file are read one after another. Each record is a row encoded
+// as a JSON object with the column paths as keys. The keys are sorted, so
+// equal rows are encoded the same way. Strings are JSON strings, other byte
+// arrays are base64 encoded and repeated columns are JSON arrays.
+//
+// It should be created with New().
+type FileSystem struct {
+	source  Source
+	columns []string
+}
+
+// New returns a new FileSystem for the Parquet files of the given source.
+func New(source Source, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		source: source,
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return fs.source.Files(route, ctx, meta)
+}
+
+// Reader implements mapreduce.FileSystem. The file is closed once the reader
+// returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	f, err := fs.source.Open(file, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pf, err := parquet.OpenFile(f, f.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	columns, err := fs.project(pf.Schema())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	groups := pf.RowGroups()
+	var rows []map[string]interface{}
+	next := func() ([]byte, error) {
+		for len(rows) == 0 {
+			if len(groups) == 0 {
+				return nil, io.EOF
+			}
+
+			var err error
+			rows, err = readRowGroup(groups[0], columns)
+			if err != nil {
+				return nil, err
+			}
+			groups = groups[1:]
+		}
+
+		row := rows[0]
+		rows = rows[1:]
+		return json.Marshal(row)
+	}
+
+	return func() ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		data, err := next()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return data, nil
+	}, nil
+}
+
+// column is a leaf column that is read.
+type column struct {
+	name     string
+	index    int
+	repeated bool
+	utf8     bool
+}
+
+// project returns the columns that are read.
+func (fs *FileSystem) project(schema *parquet.Schema) ([]column, error) {
+	paths := schema.Columns()
+	if len(fs.columns) > 0 {
+		paths = nil
+		for _, c := range fs.columns {
+			paths = append(paths, strings.Split(c, "."))
+		}
+	}
+
+	var columns []column
+	for _, path := range paths {
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			return nil, &MissingColumnError{Column: strings.Join(path, ".")}
+		}
+
+		var utf8 bool
+		if logical := leaf.Node.Type().LogicalType(); logical != nil {
+			_, utf8 = logical.Value.(*format.StringType)
+		}
+
+		columns = append(columns, column{
+			name:     strings.Join(path, "."),
+			index:    leaf.ColumnIndex,
+			repeated: leaf.MaxRepetitionLevel > 0,
+			utf8:     utf8,
+		})
+	}
+	return columns, nil
+}
+
+// MissingColumnError is returned when a projected column is not part of
+// the schema of a file.
+type MissingColumnError struct {
+	Column string
+}
+
+// Error implements error.
+func (e *MissingColumnError) Error() string {
+	return "parquet file does not have a column " + e.Column
+}
+
+// readRowGroup reads the columns of each row of the row group.
+func readRowGroup(group parquet.RowGroup, columns []column) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, group.NumRows())
+	for i := range rows {
+		rows[i] = make(map[string]interface{}, len(columns))
+	}
+
+	chunks := group.ColumnChunks()
+	for _, c := range columns {
+		values, err := readColumn(chunks[c.index], c)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, v := range values {
+			if i < len(rows) {
+				rows[i][c.name] = v
+			}
+		}
+	}
+	return rows, nil
+}
+
+// readColumn returns the value of the column for each row. The values of a
+// repeated column are collected in a slice.
+func readColumn(chunk parquet.ColumnChunk, c column) ([]interface{}, error) {
+	pages := chunk.Pages()
+	defer pages.Close()
+
+	var values []interface{}
+	buf := make([]parquet.Value, 256)
+	for {
+		page, err := pages.ReadPage()
+		if err == io.EOF {
+			return values, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader := page.Values()
+		for {
+			n, err := reader.ReadValues(buf)
+			for _, v := range buf[:n] {
+				if !c.repeated {
+					values = append(values, c.decode(v))
+					continue
+				}
+
+				if v.RepetitionLevel() == 0 {
+					values = append(values, []interface{}{})
+				}
+
+				// An empty list is stored as a single null.
+				if !v.IsNull() {
+					values[len(values)-1] = append(values[len(values)-1].([]interface{}), c.decode(v))
+				}
+			}
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// decode returns the value as it is encoded to JSON.
+func (c column) decode(v parquet.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return v.Int32()
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Int96:
+		return v.Int96().String()
+	case parquet.Float:
+		return v.Float()
+	case parquet.Double:
+		return v.Double()
+	default:
+		data := append([]byte(nil), v.ByteArray()...)
+		if c.utf8 {
+			return string(data)
+		}
+		return data
+	}
+}
@@ -0,0 +1,118 @@
+package parquet_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/parquet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TP struct {
+	*testing.T
+	dir string
+}
+
+type user struct {
+	ID   int64  `parquet:"id"`
+	Name string `parquet:"name"`
+}
+
+type event struct {
+	User user     `parquet:"user"`
+	Tags []string `parquet:"tags,list"`
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TP {
+		dir, err := ioutil.TempDir("", "parquet")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = pq.WriteFile(filepath.Join(dir, "events.parquet"), []event{
+			{User: user{ID: 1, Name: "a"}, Tags: []string{"x", "y"}},
+			{User: user{ID: 2, Name: "b"}},
+		}, pq.MaxRowsPerRowGroup(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return TP{
+			T:   t,
+			dir: dir,
+		}
+	})
+
+	o.AfterEach(func(t TP) {
+		os.RemoveAll(t.dir)
+	})
+
+	o.Spec("it implements FileSystem", func(t TP) {
+		var fs mapreduce.FileSystem = parquet.New(parquet.Dir(t.dir, "some-id"))
+		_ = fs
+	})
+
+	o.Spec("it returns the files of the directory", func(t TP) {
+		files, err := parquet.New(parquet.Dir(t.dir, "some-id")).Files("", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"events.parquet": {"some-id"},
+		}))
+	})
+
+	o.Spec("it reads each row of each row group", func(t TP) {
+		fs := parquet.New(parquet.Dir(t.dir, "some-id"))
+		Expect(t, readAll(t, fs)).To(Equal([]string{
+			`{"tags.list.element":["x","y"],"user.id":1,"user.name":"a"}`,
+			`{"tags.list.element":[],"user.id":2,"user.name":"b"}`,
+		}))
+	})
+
+	o.Spec("it projects the rows onto the columns", func(t TP) {
+		fs := parquet.New(parquet.Dir(t.dir, "some-id"), parquet.WithColumns("user.name"))
+		Expect(t, readAll(t, fs)).To(Equal([]string{
+			`{"user.name":"a"}`,
+			`{"user.name":"b"}`,
+		}))
+	})
+
+	o.Spec("it returns an error for a missing column", func(t TP) {
+		fs := parquet.New(parquet.Dir(t.dir, "some-id"), parquet.WithColumns("unknown"))
+		_, err := fs.Reader("events.parquet", context.Background(), nil)
+		_, ok := err.(*parquet.MissingColumnError)
+		Expect(t, ok).To(BeTrue())
+	})
+}
+
+func readAll(t TP, fs *parquet.FileSystem) []string {
+	reader, err := fs.Reader("events.parquet", context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
@@ -0,0 +1,89 @@
+// Package fs holds mapreduce.FileSystem implementations that do not need a
+// storage backend of their own.
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// LocalNode is the node ID that a ReaderFileSystem reports its file on. The
+// stream can only be read where it was created, so the Network has to
+// execute the calculations for LocalNode in process.
+const LocalNode = "local"
+
+// SplitFunc splits a stream into records. It is a bufio.SplitFunc, so
+// bufio.ScanLines, bufio.ScanWords and the like can be used.
+type SplitFunc = bufio.SplitFunc
+
+// ReaderFileSystem implements mapreduce.FileSystem over a single stream,
+// such as os.Stdin. The stream can only be read once.
+//
+// It should be created with FromReader().
+type ReaderFileSystem struct {
+	name  string
+	r     io.Reader
+	split SplitFunc
+
+	mu   sync.Mutex
+	read bool
+}
+
+// FromReader returns a FileSystem with a single file of the given name that
+// reads its records from r. The split function defaults to bufio.ScanLines.
+func FromReader(name string, r io.Reader, split SplitFunc) *ReaderFileSystem {
+	if split == nil {
+		split = bufio.ScanLines
+	}
+
+	return &ReaderFileSystem{
+		name:  name,
+		r:     r,
+		split: split,
+	}
+}
+
+// Files implements mapreduce.FileSystem. The route is used as a prefix of
+// the name of the file.
+func (fs *ReaderFileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	files := make(map[string][]string)
+	if strings.HasPrefix(fs.name, route) {
+		files[fs.name] = []string{LocalNode}
+	}
+	return files, nil
+}
+
+// Reader implements mapreduce.FileSystem. It returns an error if the stream
+// was already read.
+func (fs *ReaderFileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	if file != fs.name {
+		return nil, fmt.Errorf("unknown file %s", file)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.read {
+		return nil, fmt.Errorf("%s was already read", file)
+	}
+	fs.read = true
+
+	scanner := bufio.NewScanner(fs.r)
+	scanner.Split(fs.split)
+	return func() ([]byte, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+
+		data := make([]byte, len(scanner.Bytes()))
+		copy(data, scanner.Bytes())
+		return data, nil
+	}, nil
+}
@@ -0,0 +1,72 @@
+package fs_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestReaderFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Spec("it implements FileSystem", func(t *testing.T) {
+		var f mapreduce.FileSystem = fs.FromReader("stdin", strings.NewReader(""), nil)
+		_ = f
+	})
+
+	o.Spec("it reports the file on the local node", func(t *testing.T) {
+		files, err := fs.FromReader("stdin", strings.NewReader(""), nil).Files("", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"stdin": {fs.LocalNode},
+		}))
+	})
+
+	o.Spec("it reads a line per record by default", func(t *testing.T) {
+		f := fs.FromReader("stdin", strings.NewReader("a\nb\n"), nil)
+		Expect(t, readAll(t, f)).To(Equal([]string{"a", "b"}))
+	})
+
+	o.Spec("it uses the split function", func(t *testing.T) {
+		f := fs.FromReader("stdin", strings.NewReader("a b  c"), bufio.ScanWords)
+		Expect(t, readAll(t, f)).To(Equal([]string{"a", "b", "c"}))
+	})
+
+	o.Spec("it returns an error when the stream is read twice", func(t *testing.T) {
+		f := fs.FromReader("stdin", strings.NewReader("a\n"), nil)
+		readAll(t, f)
+
+		_, err := f.Reader("stdin", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+func readAll(t *testing.T, f *fs.ReaderFileSystem) []string {
+	reader, err := f.Reader("stdin", context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []string
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+	}
+}
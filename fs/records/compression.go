@@ -0,0 +1,77 @@
+package records
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressed may be combined with a Format (e.g., Lines|Compressed) so that
+// NewReader transparently decompresses gzip or zstd input. Input that is not
+// compressed is read as is. Compressed input cannot be read in ranges, and
+// neither NewSeeker nor Write support the flag.
+const Compressed Format = 1 << 8
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Decompress detects whether r is compressed with gzip or zstd and returns
+// a reader for the decompressed data. Any other data is returned as is. The
+// returned reader should be closed once it is no longer needed. It does not
+// close r.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// newDecompressingReader returns a reader like NewReader that decompresses
+// r first. The decompression is set up with the first record, so that an
+// error can be returned.
+func newDecompressingReader(r io.Reader, f Format) func() ([]byte, error) {
+	var (
+		next func() ([]byte, error)
+		rc   io.ReadCloser
+	)
+
+	return func() ([]byte, error) {
+		if next == nil {
+			var err error
+			rc, err = Decompress(r)
+			if err != nil {
+				return nil, err
+			}
+			next = NewReader(rc, f)
+		}
+
+		data, err := next()
+		if err != nil && !IsInvalid(err) {
+			rc.Close()
+			next = func() ([]byte, error) {
+				return nil, err
+			}
+			return nil, err
+		}
+		return data, err
+	}
+}
@@ -0,0 +1,48 @@
+package records
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+)
+
+// Header may be combined with a Format (e.g., CSV|Header) so that the first
+// record of each file is skipped by NewReader and NewSeeker. Files with a
+// header cannot be read in ranges.
+const Header Format = 1 << 9
+
+// ParseCSV returns the fields of a record that was read with the CSV
+// format. The delimiter separates the fields, e.g. ',' or '\t'.
+func ParseCSV(record []byte, delimiter rune) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(record))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	return r.Read()
+}
+
+// readCSVRow returns the next CSV row without its line ending along with
+// the number of bytes it took up. A quoted field may contain newlines, so
+// lines are joined until every quote is closed.
+func readCSVRow(br *bufio.Reader) ([]byte, int, error) {
+	var (
+		row []byte
+		n   int
+	)
+
+	for {
+		line, err := br.ReadBytes('\n')
+		row = append(row, line...)
+		n += len(line)
+
+		if err != nil {
+			if len(row) == 0 {
+				return nil, 0, err
+			}
+			return bytes.TrimSuffix(row, []byte{'\r'}), n, nil
+		}
+
+		if bytes.Count(row, []byte{'"'})%2 == 0 {
+			return bytes.TrimSuffix(row[:len(row)-1], []byte{'\r'}), n, nil
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package records
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// InvalidRecordError is returned by a reader for a record that is not valid
+// in its format. The reader may be invoked again to read the next record, so
+// the mapreduce.Executor treats it like any other bad record (see
+// mapreduce.WithBadRecords).
+type InvalidRecordError struct {
+	// Data holds the invalid record.
+	Data []byte
+
+	// Reason describes what is wrong with the record.
+	Reason string
+}
+
+// Error implements error.
+func (e *InvalidRecordError) Error() string {
+	return fmt.Sprintf("invalid record: %s", e.Reason)
+}
+
+// BadRecord returns the invalid record.
+func (e *InvalidRecordError) BadRecord() []byte {
+	return e.Data
+}
+
+// IsInvalid reports whether err is an InvalidRecordError. Unlike any other
+// error, it does not end the records of a reader.
+func IsInvalid(err error) bool {
+	_, ok := err.(*InvalidRecordError)
+	return ok
+}
+
+// JSONField returns the raw value of a field of a JSON object without
+// unmarshaling the rest of it. Nested fields are found by their path, e.g.
+// JSONField(record, "user", "id").
+func JSONField(record []byte, path ...string) (json.RawMessage, error) {
+	value := json.RawMessage(record)
+	for _, name := range path {
+		d := json.NewDecoder(bytes.NewReader(value))
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if t != json.Delim('{') {
+			return nil, fmt.Errorf("field %s is not within an object", name)
+		}
+
+		found := false
+		for !found && d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			var raw json.RawMessage
+			if err := d.Decode(&raw); err != nil {
+				return nil, err
+			}
+
+			if key == name {
+				value = raw
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("field %s not found", name)
+		}
+	}
+	return value, nil
+}
+
+// JSONKey returns a field of a JSON object like JSONField, but as a string
+// that can be used as the key of a mapreduce.Mapper. A JSON string is
+// unquoted, any other value is returned as it is encoded.
+func JSONKey(record []byte, path ...string) (string, error) {
+	value, err := JSONField(record, path...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(value) > 0 && value[0] == '"' {
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	}
+	return string(value), nil
+}
+
+// readJSONLine returns the next JSON object along with the number of bytes
+// it took up. Blank lines are skipped. A line that is not a complete JSON
+// object is returned with an InvalidRecordError.
+func readJSONLine(br *bufio.Reader) ([]byte, int, error) {
+	var skipped int
+	for {
+		line, n, err := readLine(br)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			skipped += n
+			continue
+		}
+
+		if trimmed[0] != '{' || !json.Valid(trimmed) {
+			return line, skipped + n, &InvalidRecordError{
+				Data:   line,
+				Reason: "not a complete JSON object",
+			}
+		}
+		return trimmed, skipped + n, nil
+	}
+}
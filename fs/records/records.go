@@ -0,0 +1,305 @@
+// Package records splits a stream of bytes into the records that are handed
+// to a mapreduce.Mapper. It is shared by the FileSystem implementations.
+package records
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Format describes how records are stored within a file.
+type Format int
+
+const (
+	// Lines stores each record on its own line.
+	Lines Format = iota
+
+	// LengthPrefixed stores each record after its length encoded as a
+	// uvarint. Unlike Lines, records may contain newlines. It is the format
+	// of varint length-delimited protobuf streams, so each record is an
+	// encoded message (see mapreduce.ProtoMapper).
+	LengthPrefixed
+
+	// Checksummed stores each record like LengthPrefixed, but with the
+	// CRC-32 (Castagnoli) of the record between its length and its data.
+	// NewChecksumReader returns the stored checksums so that they can be
+	// verified.
+	Checksummed
+
+	// CSV stores each record as a row of comma-separated (or otherwise
+	// delimited) values. Quoted fields may contain newlines. A record is
+	// the row without its line ending and ParseCSV returns its fields.
+	CSV
+
+	// JSONLines stores each record as a JSON object on its own line
+	// (NDJSON). Blank lines are skipped and a line that is not a complete
+	// JSON object is returned with an InvalidRecordError. JSONField and
+	// JSONKey read single fields of a record.
+	JSONLines
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// NewReader returns a function that returns the next record from r each
+// time it is invoked. It returns io.EOF once there are no more records.
+func NewReader(r io.Reader, f Format) func() ([]byte, error) {
+	if f&Compressed != 0 {
+		return newDecompressingReader(r, f&^Compressed)
+	}
+
+	if f&Header != 0 {
+		next := NewReader(r, f&^Header)
+		skipped := false
+		return func() ([]byte, error) {
+			if !skipped {
+				skipped = true
+				if _, err := next(); err != nil {
+					return nil, err
+				}
+			}
+			return next()
+		}
+	}
+
+	br := bufio.NewReader(r)
+	return func() ([]byte, error) {
+		data, _, err := readRecord(br, f)
+		return data, err
+	}
+}
+
+// NewChecksumReader returns a function like NewReader that also returns the
+// checksum that was stored with each record. Only the Checksummed format
+// stores checksums, and it may not be combined with Compressed.
+func NewChecksumReader(r io.Reader, f Format) (func() ([]byte, uint32, error), error) {
+	if f != Checksummed {
+		return nil, fmt.Errorf("records of format %d do not have checksums", f)
+	}
+
+	br := bufio.NewReader(r)
+	return func() ([]byte, uint32, error) {
+		data, checksum, _, err := readChecksummed(br, f)
+		return data, checksum, err
+	}, nil
+}
+
+// Seeker reads the records of a file and can jump to any of them by its
+// index. It remembers where each record it has read starts, so seeking back
+// does not read the file again.
+//
+// It should be created with NewSeeker().
+type Seeker struct {
+	r       io.ReadSeeker
+	br      *bufio.Reader
+	f       Format
+	pos     uint64
+	index   uint64
+	offsets []uint64
+}
+
+// NewSeeker returns a new Seeker that starts with the first record of r.
+// Compressed input cannot be seeked, so it returns an error for a Format
+// that includes Compressed.
+func NewSeeker(r io.ReadSeeker, f Format) (*Seeker, error) {
+	if f&Compressed != 0 {
+		return nil, fmt.Errorf("records of format %d cannot be seeked, as they are compressed", f)
+	}
+
+	s := &Seeker{
+		r:  r,
+		br: bufio.NewReader(r),
+		f:  f &^ Header,
+	}
+
+	if f&Header != 0 {
+		// The header is not a record, so the first record starts after it.
+		// An error is returned by the next call to Next.
+		s.Next()
+		s.index = 0
+		s.offsets = nil
+	}
+	return s, nil
+}
+
+// Next returns the next record. It returns io.EOF once there are no more
+// records.
+func (s *Seeker) Next() ([]byte, error) {
+	if s.index == uint64(len(s.offsets)) {
+		s.offsets = append(s.offsets, s.pos)
+	}
+
+	// An invalid record is still read, so the Seeker moves past it.
+	data, n, err := readRecord(s.br, s.f)
+	if n > 0 {
+		s.pos += uint64(n)
+		s.index++
+	}
+	return data, err
+}
+
+// Seek makes Next return the record with the given index. Seeking past the
+// last record returns io.EOF.
+func (s *Seeker) Seek(record uint64) error {
+	if record < uint64(len(s.offsets)) {
+		if _, err := s.r.Seek(int64(s.offsets[record]), io.SeekStart); err != nil {
+			return err
+		}
+
+		s.br.Reset(s.r)
+		s.pos = s.offsets[record]
+		s.index = record
+		return nil
+	}
+
+	for s.index < record {
+		if _, err := s.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewRangeReader returns a function like NewReader, but it only returns the
+// records that start within the bytes of r from start up to end. If start is
+// in the middle of a record, it skips ahead to the next one. The record that
+// straddles end is returned whole. Only Lines can be split, as the
+// boundaries of LengthPrefixed records cannot be detected.
+func NewRangeReader(r io.ReadSeeker, f Format, start, end uint64) (func() ([]byte, error), error) {
+	if f != Lines {
+		return nil, fmt.Errorf("records of format %d cannot be split", f)
+	}
+
+	// A record starts at start if the byte before it ends a line, so the
+	// skipping starts there.
+	pos := start
+	if start > 0 {
+		pos--
+	}
+
+	if _, err := r.Seek(int64(pos), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	if start > 0 {
+		skipped, err := br.ReadBytes('\n')
+		pos += uint64(len(skipped))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+
+	return func() ([]byte, error) {
+		if pos >= end {
+			return nil, io.EOF
+		}
+
+		line, n, err := readLine(br)
+		pos += uint64(n)
+		return line, err
+	}, nil
+}
+
+// readRecord returns the next record along with the number of bytes it
+// took up.
+func readRecord(br *bufio.Reader, f Format) ([]byte, int, error) {
+	data, _, n, err := readChecksummed(br, f)
+	return data, n, err
+}
+
+// readChecksummed returns the next record along with its stored checksum
+// and the number of bytes it took up. The checksum is 0 unless the format is
+// Checksummed.
+func readChecksummed(br *bufio.Reader, f Format) ([]byte, uint32, int, error) {
+	if f == Lines {
+		line, n, err := readLine(br)
+		return line, 0, n, err
+	}
+
+	if f == CSV {
+		row, n, err := readCSVRow(br)
+		return row, 0, n, err
+	}
+
+	if f == JSONLines {
+		object, n, err := readJSONLine(br)
+		return object, 0, n, err
+	}
+
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], size)
+
+	var checksum uint32
+	if f == Checksummed {
+		var sum [4]byte
+		if _, err := io.ReadFull(br, sum[:]); err != nil {
+			return nil, 0, 0, fmt.Errorf("truncated record: %s", err)
+		}
+		checksum = binary.BigEndian.Uint32(sum[:])
+		n += len(sum)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, 0, 0, fmt.Errorf("truncated record: %s", err)
+	}
+
+	return data, checksum, n + len(data), nil
+}
+
+// readLine returns the next line without its newline along with the number
+// of bytes it took up.
+func readLine(br *bufio.Reader) ([]byte, int, error) {
+	line, err := br.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		return line, len(line), nil
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return line[:len(line)-1], len(line), nil
+}
+
+// Write writes a single record to w. It does not write a Header. Records
+// cannot be written compressed, so it returns an error for a Format that
+// includes Compressed.
+func Write(w io.Writer, f Format, data []byte) error {
+	if f&Compressed != 0 {
+		return fmt.Errorf("records of format %d cannot be written, as they are compressed", f)
+	}
+
+	if f == LengthPrefixed || f == Checksummed {
+		var size [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(size[:], uint64(len(data)))
+		if _, err := w.Write(size[:n]); err != nil {
+			return err
+		}
+
+		if f == Checksummed {
+			var sum [4]byte
+			binary.BigEndian.PutUint32(sum[:], crc32.Checksum(data, castagnoli))
+			if _, err := w.Write(sum[:]); err != nil {
+				return err
+			}
+		}
+
+		_, err := w.Write(data)
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
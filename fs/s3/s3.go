@@ -0,0 +1,148 @@
+// Package s3 implements a mapreduce.FileSystem over the objects of an S3
+// bucket.
+package s3
+
+import (
+	"bytes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3api "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/records"
+	"golang.org/x/net/context"
+)
+
+// Client is the subset of the S3 API that the FileSystem uses. It is
+// implemented by *s3.Client from github.com/aws/aws-sdk-go-v2/service/s3.
+type Client interface {
+	ListObjectsV2(ctx context.Context, params *s3api.ListObjectsV2Input, optFns ...func(*s3api.Options)) (*s3api.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3api.GetObjectInput, optFns ...func(*s3api.Options)) (*s3api.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3api.PutObjectInput, optFns ...func(*s3api.Options)) (*s3api.PutObjectOutput, error)
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithDiscovery reports the files to be available on the nodes that the
+// Discovery currently reports, instead of the nodes given to New. It picks up
+// nodes that start reading from the bucket without a restart.
+func WithDiscovery(d mapreduce.Discovery) Option {
+	return func(fs *FileSystem) {
+		fs.discovery = d
+	}
+}
+
+// WithFormat sets the format of the records. It defaults to records.Lines.
+func WithFormat(f records.Format) Option {
+	return func(fs *FileSystem) {
+		fs.format = f
+	}
+}
+
+// FileSystem implements mapreduce.WriteFileSystem over the objects of a
+// bucket. Objects can be read from any node, so each file is reported to be
+// available on every configured node.
+//
+// It should be created with New().
+type FileSystem struct {
+	client    Client
+	bucket    string
+	discovery mapreduce.Discovery
+	format    records.Format
+}
+
+// New returns a new FileSystem for the given bucket. The nodes are the ones
+// that are able to read from the bucket.
+func New(client Client, bucket string, nodeIDs []string, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		client:    client,
+		bucket:    bucket,
+		discovery: mapreduce.StaticNodes(nodeIDs...),
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route is used as a key prefix.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	nodeIDs, err := fs.discovery.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	var token *string
+	for {
+		resp, err := fs.client.ListObjectsV2(ctx, &s3api.ListObjectsV2Input{
+			Bucket:            aws.String(fs.bucket),
+			Prefix:            aws.String(route),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range resp.Contents {
+			files[aws.ToString(object.Key)] = nodeIDs
+		}
+
+		if !aws.ToBool(resp.IsTruncated) {
+			return files, nil
+		}
+		token = resp.NextContinuationToken
+	}
+}
+
+// List implements mapreduce.ListFileSystem. The keys are flat, so it
+// returns the same files as Files.
+func (fs *FileSystem) List(prefix string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	return fs.Files(prefix, ctx, meta)
+}
+
+// Reader implements mapreduce.FileSystem. The object is streamed and closed
+// once the reader returns an error (including io.EOF).
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	resp, err := fs.client.GetObject(ctx, &s3api.GetObjectInput{
+		Bucket: aws.String(fs.bucket),
+		Key:    aws.String(file),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	next := records.NewReader(resp.Body, fs.format)
+	return func() ([]byte, error) {
+		data, err := next()
+		if err != nil {
+			if !records.IsInvalid(err) {
+				resp.Body.Close()
+			}
+			return nil, err
+		}
+		return data, nil
+	}, nil
+}
+
+// Writer implements mapreduce.WriteFileSystem. The records are buffered in
+// memory and uploaded as a single object by close.
+func (fs *FileSystem) Writer(file string, ctx context.Context, meta []byte) (func(data []byte) error, func() error, error) {
+	buf := &bytes.Buffer{}
+	writer := func(data []byte) error {
+		return records.Write(buf, fs.format, data)
+	}
+
+	close := func() error {
+		_, err := fs.client.PutObject(ctx, &s3api.PutObjectInput{
+			Bucket: aws.String(fs.bucket),
+			Key:    aws.String(file),
+			Body:   bytes.NewReader(buf.Bytes()),
+		})
+		return err
+	}
+
+	return writer, close, nil
+}
@@ -0,0 +1,159 @@
+package s3_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3api "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/s3"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TS struct {
+	*testing.T
+	client *fakeClient
+	fs     *s3.FileSystem
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TS {
+		client := &fakeClient{
+			objects: map[string]string{
+				"logs/a": "a\nb\n",
+				"logs/b": "c\n",
+				"other":  "d\n",
+			},
+		}
+
+		return TS{
+			T:      t,
+			client: client,
+			fs:     s3.New(client, "some-bucket", []string{"id-a", "id-b"}),
+		}
+	})
+
+	o.Spec("it implements WriteFileSystem and ListFileSystem", func(t TS) {
+		var fs mapreduce.WriteFileSystem = t.fs
+		_ = fs
+
+		var lister mapreduce.ListFileSystem = t.fs
+		_ = lister
+	})
+
+	o.Spec("it lists the objects with the prefix across pages", func(t TS) {
+		files, err := t.fs.Files("logs/", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/a": {"id-a", "id-b"},
+			"logs/b": {"id-a", "id-b"},
+		}))
+		Expect(t, t.client.lists).To(Equal(2))
+	})
+
+	o.Spec("it reports the objects on the discovered nodes", func(t TS) {
+		fs := s3.New(t.client, "some-bucket", []string{"id-a"}, s3.WithDiscovery(mapreduce.StaticNodes("id-c")))
+		files, err := fs.Files("logs/", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs/a": {"id-c"},
+			"logs/b": {"id-c"},
+		}))
+	})
+
+	o.Spec("it returns the error of the discovery", func(t TS) {
+		fs := s3.New(t.client, "some-bucket", nil, s3.WithDiscovery(mapreduce.DiscoveryFunc(func(context.Context) ([]string, error) {
+			return nil, errors.New("some-error")
+		})))
+		_, err := fs.Files("logs/", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it reads the records of an object", func(t TS) {
+		reader, err := t.fs.Reader("logs/a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		var records []string
+		for {
+			data, err := reader()
+			if err == io.EOF {
+				break
+			}
+			Expect(t, err == nil).To(BeTrue())
+			records = append(records, string(data))
+		}
+		Expect(t, records).To(Equal([]string{"a", "b"}))
+	})
+
+	o.Spec("it uploads the records on close", func(t TS) {
+		writer, close, err := t.fs.Writer("out", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		writer([]byte("a"))
+		writer([]byte("b"))
+		Expect(t, t.client.objects).To(Not(HaveKey("out")))
+
+		Expect(t, close() == nil).To(BeTrue())
+		Expect(t, t.client.objects["out"]).To(Equal("a\nb\n"))
+	})
+}
+
+// fakeClient stores objects in memory and returns a single object per page.
+type fakeClient struct {
+	objects map[string]string
+	lists   int
+}
+
+func (c *fakeClient) ListObjectsV2(ctx context.Context, params *s3api.ListObjectsV2Input, optFns ...func(*s3api.Options)) (*s3api.ListObjectsV2Output, error) {
+	c.lists++
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return &s3api.ListObjectsV2Output{}, nil
+	}
+
+	first := keys[0]
+	for _, key := range keys {
+		if key < first {
+			first = key
+		}
+	}
+
+	return &s3api.ListObjectsV2Output{
+		Contents:              []types.Object{{Key: aws.String(first)}},
+		IsTruncated:           aws.Bool(len(keys) > 1),
+		NextContinuationToken: aws.String(first),
+	}, nil
+}
+
+func (c *fakeClient) GetObject(ctx context.Context, params *s3api.GetObjectInput, optFns ...func(*s3api.Options)) (*s3api.GetObjectOutput, error) {
+	return &s3api.GetObjectOutput{
+		Body: ioutil.NopCloser(strings.NewReader(c.objects[aws.ToString(params.Key)])),
+	}, nil
+}
+
+func (c *fakeClient) PutObject(ctx context.Context, params *s3api.PutObjectInput, optFns ...func(*s3api.Options)) (*s3api.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.objects[aws.ToString(params.Key)] = string(data)
+	return &s3api.PutObjectOutput{}, nil
+}
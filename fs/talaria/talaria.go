@@ -0,0 +1,98 @@
+// Package talaria implements a mapreduce.FileSystem over talaria buffers.
+// Each buffer is a file and each message within it is a record, so data
+// written to talaria can be calculated on without copying it elsewhere first.
+//
+// The package does not depend on the talaria client, so the caller has to
+// supply the Cluster that New is given. It is usually a thin wrapper around
+// the client of the talaria cluster: Buffers lists the buffers along with the
+// addresses of the talaria nodes that host them, and Read reads a buffer from
+// its first message. As talaria buffers are unbounded, Read has to stop with
+// io.EOF at the last message that was written when the read began, instead of
+// following the buffer. The addresses are mapped to the IDs of the
+// mapreduce nodes that run next to the talaria nodes with WithAddrMapping.
+package talaria
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Cluster is the subset of the talaria API that the FileSystem uses. It is
+// usually a thin wrapper around the talaria client.
+type Cluster interface {
+	// Buffers returns the name of each buffer with the addresses of the
+	// talaria nodes that host it.
+	Buffers(ctx context.Context) (map[string][]string, error)
+
+	// Read returns a reader for the messages of the buffer. The reader has
+	// to return io.EOF once it has returned every message that was in the
+	// buffer when Read was invoked, instead of waiting for new ones.
+	Read(ctx context.Context, name string) (reader func() ([]byte, error), err error)
+}
+
+// Option is used to configure a new FileSystem.
+type Option func(*FileSystem)
+
+// WithAddrMapping sets how the address of a talaria node is mapped to a node
+// ID. It defaults to using the address as the node ID.
+func WithAddrMapping(f func(addr string) (nodeID string)) Option {
+	return func(fs *FileSystem) {
+		fs.nodeID = f
+	}
+}
+
+// FileSystem implements mapreduce.FileSystem over the buffers of a talaria
+// cluster. Each buffer is reported to be available on the nodes that host
+// it.
+//
+// It should be created with New().
+type FileSystem struct {
+	cluster Cluster
+	nodeID  func(addr string) string
+}
+
+// New returns a new FileSystem for the given cluster.
+func New(cluster Cluster, opts ...Option) *FileSystem {
+	fs := &FileSystem{
+		cluster: cluster,
+		nodeID: func(addr string) string {
+			return addr
+		},
+	}
+
+	for _, o := range opts {
+		o(fs)
+	}
+
+	return fs
+}
+
+// Files implements mapreduce.FileSystem. The route is used as a buffer name
+// prefix.
+func (fs *FileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	buffers, err := fs.cluster.Buffers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for name, addrs := range buffers {
+		if !strings.HasPrefix(name, route) {
+			continue
+		}
+
+		var ids []string
+		for _, addr := range addrs {
+			ids = append(ids, fs.nodeID(addr))
+		}
+		files[name] = ids
+	}
+	return files, nil
+}
+
+// Reader implements mapreduce.FileSystem. Each message of the buffer is
+// returned as a record.
+func (fs *FileSystem) Reader(file string, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	return fs.cluster.Read(ctx, file)
+}
@@ -0,0 +1,99 @@
+package talaria_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/talaria"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TT struct {
+	*testing.T
+	cluster fakeCluster
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TT {
+		return TT{
+			T: t,
+			cluster: fakeCluster{
+				"logs-a": {
+					addrs:    []string{"10.0.0.1:8080", "10.0.0.2:8080"},
+					messages: [][]byte{[]byte("first"), []byte("second")},
+				},
+				"other": {
+					addrs: []string{"10.0.0.3:8080"},
+				},
+			},
+		}
+	})
+
+	o.Spec("it implements FileSystem", func(t TT) {
+		var fs mapreduce.FileSystem = talaria.New(t.cluster)
+		_ = fs
+	})
+
+	o.Spec("it reports the buffers with the prefix on their nodes", func(t TT) {
+		fs := talaria.New(t.cluster, talaria.WithAddrMapping(func(addr string) string {
+			return "node-" + addr
+		}))
+		files, err := fs.Files("logs-", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, files).To(Equal(map[string][]string{
+			"logs-a": {"node-10.0.0.1:8080", "node-10.0.0.2:8080"},
+		}))
+	})
+
+	o.Spec("it reads each message as a record", func(t TT) {
+		reader, err := talaria.New(t.cluster).Reader("logs-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		var records []string
+		for {
+			data, err := reader()
+			if err == io.EOF {
+				break
+			}
+			Expect(t, err == nil).To(BeTrue())
+			records = append(records, string(data))
+		}
+		Expect(t, records).To(Equal([]string{"first", "second"}))
+	})
+}
+
+type fakeBuffer struct {
+	addrs    []string
+	messages [][]byte
+}
+
+type fakeCluster map[string]fakeBuffer
+
+func (c fakeCluster) Buffers(ctx context.Context) (map[string][]string, error) {
+	buffers := make(map[string][]string)
+	for name, b := range c {
+		buffers[name] = b.addrs
+	}
+	return buffers, nil
+}
+
+func (c fakeCluster) Read(ctx context.Context, name string) (func() ([]byte, error), error) {
+	messages := c[name].messages
+	return func() ([]byte, error) {
+		if len(messages) == 0 {
+			return nil, io.EOF
+		}
+
+		data := messages[0]
+		messages = messages[1:]
+		return data, nil
+	}, nil
+}
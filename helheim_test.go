@@ -64,6 +64,85 @@ func (m *mockFileSystem) Reader(file string, ctx context.Context, meta []byte) (
 	return <-m.ReaderOutput.Reader, <-m.ReaderOutput.Err
 }
 
+type mockWriteFileSystem struct {
+	FilesCalled chan bool
+	FilesInput  struct {
+		Route chan string
+		Ctx   chan context.Context
+		Meta  chan []byte
+	}
+	FilesOutput struct {
+		Files chan map[string][]string
+		Err   chan error
+	}
+	ReaderCalled chan bool
+	ReaderInput  struct {
+		File chan string
+		Ctx  chan context.Context
+		Meta chan []byte
+	}
+	ReaderOutput struct {
+		Reader chan func() (data []byte, err error)
+		Err    chan error
+	}
+	WriterCalled chan bool
+	WriterInput  struct {
+		File chan string
+		Ctx  chan context.Context
+		Meta chan []byte
+	}
+	WriterOutput struct {
+		Writer chan func(data []byte) error
+		Close  chan func() error
+		Err    chan error
+	}
+}
+
+func newMockWriteFileSystem() *mockWriteFileSystem {
+	m := &mockWriteFileSystem{}
+	m.FilesCalled = make(chan bool, 100)
+	m.FilesInput.Route = make(chan string, 100)
+	m.FilesInput.Ctx = make(chan context.Context, 100)
+	m.FilesInput.Meta = make(chan []byte, 100)
+	m.FilesOutput.Files = make(chan map[string][]string, 100)
+	m.FilesOutput.Err = make(chan error, 100)
+	m.ReaderCalled = make(chan bool, 100)
+	m.ReaderInput.File = make(chan string, 100)
+	m.ReaderInput.Ctx = make(chan context.Context, 100)
+	m.ReaderInput.Meta = make(chan []byte, 100)
+	m.ReaderOutput.Reader = make(chan func() (data []byte, err error), 100)
+	m.ReaderOutput.Err = make(chan error, 100)
+	m.WriterCalled = make(chan bool, 100)
+	m.WriterInput.File = make(chan string, 100)
+	m.WriterInput.Ctx = make(chan context.Context, 100)
+	m.WriterInput.Meta = make(chan []byte, 100)
+	m.WriterOutput.Writer = make(chan func(data []byte) error, 100)
+	m.WriterOutput.Close = make(chan func() error, 100)
+	m.WriterOutput.Err = make(chan error, 100)
+	return m
+}
+func (m *mockWriteFileSystem) Files(route string, ctx context.Context, meta []byte) (files map[string][]string, err error) {
+	m.FilesCalled <- true
+	m.FilesInput.Route <- route
+	m.FilesInput.Ctx <- ctx
+	m.FilesInput.Meta <- meta
+	return <-m.FilesOutput.Files, <-m.FilesOutput.Err
+}
+func (m *mockWriteFileSystem) Reader(file string, ctx context.Context, meta []byte) (reader func() (data []byte, err error), err error) {
+	m.ReaderCalled <- true
+	m.ReaderInput.File <- file
+	m.ReaderInput.Ctx <- ctx
+	m.ReaderInput.Meta <- meta
+	return <-m.ReaderOutput.Reader, <-m.ReaderOutput.Err
+}
+func (m *mockWriteFileSystem) Writer(file string, ctx context.Context, meta []byte) (writer func(data []byte) error, close func() error, err error) {
+	m.WriterCalled <- true
+	m.WriterInput.File <- file
+	m.WriterInput.Ctx <- ctx
+	m.WriterInput.Meta <- meta
+	return <-m.WriterOutput.Writer, <-m.WriterOutput.Close, <-m.WriterOutput.Err
+}
+
 type mockMapper struct {
 	MapCalled chan bool
 	MapInput  struct {
@@ -0,0 +1,46 @@
+package mapreduce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+type idempotencyKey struct{}
+
+// IdempotencyKeyFrom returns the key that identifies the file (or split) of
+// a calculation. It stays the same when the file is retried, re-dispatched
+// to another node or duplicated (see WithSpeculation), but differs between
+// calculations. MapReduce merges a single result per key, so overlapping
+// attempts are never counted twice. A Network implementation ships it, so
+// that the remote node can recognize a repeated request as well.
+func IdempotencyKeyFrom(ctx context.Context) (key string, ok bool) {
+	key, ok = ctx.Value(idempotencyKey{}).(string)
+	return key, ok
+}
+
+// WithIdempotencyKey returns a context that stores the given key. A Network
+// implementation uses it on the remote node before invoking the Executor.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// newCalculationID returns a random ID that prefixes the idempotency keys
+// of a calculation.
+func newCalculationID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// task identifies the file, or the split of it, that is calculated.
+func task(fileName string, split *Split) string {
+	if split == nil {
+		return fileName
+	}
+	return fmt.Sprintf("%s:%d-%d", fileName, split.Start, split.End)
+}
@@ -0,0 +1,126 @@
+package mapreduce
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// MapStage is the stage name given to Interceptors for Map invocations.
+	MapStage = "map"
+
+	// ReduceStage is the stage name given to Interceptors for Reduce
+	// invocations.
+	ReduceStage = "reduce"
+)
+
+// StageFunc is a single invocation of a Mapper or Reducer.
+type StageFunc func() error
+
+// Interceptor wraps each invocation of a stage. It is used for cross-cutting
+// concerns (e.g., logging, metrics or panic recovery) and has to invoke next
+// to run the stage. The stage is either the name given via NamedMapper or
+// NamedReducer, or MapStage or ReduceStage.
+type Interceptor func(stage string, next StageFunc) StageFunc
+
+// Intercept returns an Algorithm that runs each Map and Reduce invocation of
+// the given Algorithm through the interceptors. The first interceptor is the
+// outermost one. A missing Mapper or Reducer stays missing.
+func Intercept(alg Algorithm, interceptors ...Interceptor) Algorithm {
+	if alg.Mapper != nil {
+		alg.Mapper = interceptedMapper{
+			mapper:       alg.Mapper,
+			interceptors: interceptors,
+		}
+	}
+
+	if alg.Reducer != nil {
+		alg.Reducer = interceptedReducer{
+			reducer:      alg.Reducer,
+			interceptors: interceptors,
+		}
+	}
+
+	return alg
+}
+
+// Recover is an Interceptor that turns a panic within a stage into an error.
+func Recover(stage string, next StageFunc) StageFunc {
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s stage panicked: %v", stage, r)
+			}
+		}()
+
+		return next()
+	}
+}
+
+func intercept(stage string, f StageFunc, interceptors []Interceptor) error {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		f = interceptors[i](stage, f)
+	}
+	return f()
+}
+
+type interceptedMapper struct {
+	mapper       Mapper
+	interceptors []Interceptor
+}
+
+func (m interceptedMapper) StageName() string {
+	return stageName(m.mapper, MapStage)
+}
+
+func (m interceptedMapper) RecordFilter() (RecordFilter, bool) {
+	return recordFilter(m.mapper)
+}
+
+func (m interceptedMapper) Map(value []byte) (key string, output []byte, err error) {
+	return m.MapContext(context.Background(), value)
+}
+
+func (m interceptedMapper) MapContext(ctx context.Context, value []byte) (key string, output []byte, err error) {
+	err = intercept(stageName(m.mapper, MapStage), func() error {
+		var err error
+		if contextMapper, ok := m.mapper.(ContextMapper); ok {
+			key, output, err = contextMapper.MapContext(ctx, value)
+		} else {
+			key, output, err = m.mapper.Map(value)
+		}
+		return err
+	}, m.interceptors)
+	return key, output, err
+}
+
+type interceptedReducer struct {
+	reducer      Reducer
+	interceptors []Interceptor
+}
+
+func (r interceptedReducer) StageName() string {
+	return stageName(r.reducer, ReduceStage)
+}
+
+func (r interceptedReducer) emitsOutputs() bool {
+	return emitsOutputs(r.reducer)
+}
+
+func (r interceptedReducer) Reduce(value [][]byte) (reduced [][]byte, err error) {
+	return r.ReduceOutputs(value, func(string, []byte) {})
+}
+
+func (r interceptedReducer) ReduceOutputs(value [][]byte, emit Emit) (reduced [][]byte, err error) {
+	err = intercept(stageName(r.reducer, ReduceStage), func() error {
+		var err error
+		if outputReducer, ok := r.reducer.(OutputReducer); ok {
+			reduced, err = outputReducer.ReduceOutputs(value, emit)
+		} else {
+			reduced, err = r.reducer.Reduce(value)
+		}
+		return err
+	}, r.interceptors)
+	return reduced, err
+}
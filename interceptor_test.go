@@ -0,0 +1,85 @@
+package mapreduce_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TI struct {
+	*testing.T
+	stages []string
+	alg    mapreduce.Algorithm
+}
+
+func TestIntercept(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) *TI {
+		ti := &TI{T: t}
+		record := func(name string) mapreduce.Interceptor {
+			return func(stage string, next mapreduce.StageFunc) mapreduce.StageFunc {
+				return func() error {
+					ti.stages = append(ti.stages, name+":"+stage)
+					return next()
+				}
+			}
+		}
+
+		ti.alg = mapreduce.Intercept(mapreduce.Algorithm{
+			Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+				if string(value) == "panic" {
+					panic("some-panic")
+				}
+				return "key", value, nil
+			}),
+			Reducer: mapreduce.ReduceFunc(func(value [][]byte) ([][]byte, error) {
+				return value[:1], nil
+			}),
+		}, mapreduce.Recover, record("a"), record("b"))
+
+		return ti
+	})
+
+	o.Spec("it runs map invocations through the interceptors in order", func(t *TI) {
+		key, output, err := t.alg.Map([]byte("value"))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, key).To(Equal("key"))
+		Expect(t, output).To(Equal([]byte("value")))
+		Expect(t, t.stages).To(Equal([]string{"a:map", "b:map"}))
+	})
+
+	o.Spec("it runs reduce invocations through the interceptors", func(t *TI) {
+		reduced, err := t.alg.Reduce([][]byte{[]byte("a"), []byte("b")})
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, reduced).To(Equal([][]byte{[]byte("a")}))
+		Expect(t, t.stages).To(Equal([]string{"a:reduce", "b:reduce"}))
+	})
+
+	o.Spec("it gives the interceptors the names of named stages", func(t *TI) {
+		var stages []string
+		alg := mapreduce.Intercept(mapreduce.Algorithm{
+			Mapper: mapreduce.NamedMapper("extract-host", mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+				return "", nil, fmt.Errorf("some-error")
+			})),
+		}, func(stage string, next mapreduce.StageFunc) mapreduce.StageFunc {
+			stages = append(stages, stage)
+			return next
+		})
+
+		_, _, err := alg.Map([]byte("value"))
+		Expect(t, err.Error()).To(Equal("extract-host: some-error"))
+		Expect(t, stages).To(Equal([]string{"extract-host"}))
+	})
+
+	o.Spec("it recovers from panics", func(t *TI) {
+		_, _, err := t.alg.Map([]byte("panic"))
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
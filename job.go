@@ -0,0 +1,233 @@
+package mapreduce
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// JobStatus describes the state of a Job.
+type JobStatus int
+
+const (
+	// JobRunning is the status of a Job that has not finished yet.
+	JobRunning JobStatus = iota
+
+	// JobSucceeded is the status of a Job that finished with a result.
+	JobSucceeded
+
+	// JobFailed is the status of a Job that finished with an error.
+	JobFailed
+
+	// JobCanceled is the status of a Job that was stopped via Cancel().
+	JobCanceled
+)
+
+// ResultMeta describes where the value of a key came from.
+type ResultMeta struct {
+	// Files holds each file that produced a value for the key.
+	Files []string
+
+	// Nodes holds the node that calculated each of the Files.
+	//
+	// Both are empty if the calculation shuffled (see WithShuffle), as the
+	// values of the files are combined on the nodes.
+	Nodes []string
+
+	// ReduceIterations is the number of times MapReduce invoked the Reducer
+	// for the key.
+	ReduceIterations int
+
+	// Records is the number of records that were mapped to the key. The
+	// nodes report it along with their results (see WithRecordCounts).
+	Records int64
+}
+
+// Job is a handle for a calculation that was started with Submit(). It is
+// safe to use from several goroutines.
+type Job struct {
+	id           string
+	cancel       context.CancelFunc
+	done         chan struct{}
+	total        int
+	counters     *Counters
+	accumulators *Accumulators
+	records      *Counters
+
+	mu        sync.Mutex
+	completed int
+	canceled  bool
+	result    Results
+	meta      map[string]*ResultMeta
+	outputs   map[string]map[string][][]byte
+	err       error
+
+	divergences []Divergence
+}
+
+func newJob(cancel context.CancelFunc, total int) *Job {
+	return &Job{
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		total:        total,
+		counters:     NewCounters(),
+		accumulators: NewAccumulators(),
+		records:      NewCounters(),
+		outputs:      make(map[string]map[string][][]byte),
+		meta:         make(map[string]*ResultMeta),
+	}
+}
+
+// ID identifies the calculation of the Job. It is used to Resume() the
+// calculation from its checkpoint (see WithCheckpoints).
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Wait blocks until the Job has finished and returns its result. Each call
+// returns a copy of the result.
+func (j *Job) Wait() (result Results, err error) {
+	<-j.done
+	return j.result.clone(), j.err
+}
+
+// Done returns a channel that is closed once the Job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Cancel stops the Job. It does not wait for the Job to finish.
+func (j *Job) Cancel() {
+	j.mu.Lock()
+	j.canceled = true
+	j.mu.Unlock()
+
+	j.cancel()
+}
+
+// Status returns the current state of the Job.
+func (j *Job) Status() JobStatus {
+	select {
+	case <-j.done:
+	default:
+		return JobRunning
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case j.err == nil:
+		return JobSucceeded
+	case j.canceled:
+		return JobCanceled
+	default:
+		return JobFailed
+	}
+}
+
+// Progress returns how many of the Job's files have been calculated on the
+// remote nodes.
+func (j *Job) Progress() (completed, total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.completed, j.total
+}
+
+// Values returns a copy of every value the key converged to (see
+// WithConvergence and Results.Values). It is only complete once the Job has
+// finished.
+func (j *Job) Values(key string) [][]byte {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result.Values(key)
+}
+
+// Meta returns where the value of the key came from. It returns false for
+// unknown keys.
+func (j *Job) Meta(key string) (ResultMeta, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	meta, ok := j.meta[key]
+	if !ok {
+		return ResultMeta{}, false
+	}
+
+	m := *meta
+	m.Records = j.records.value(key)
+	return m, true
+}
+
+func (j *Job) keyMeta(key string) *ResultMeta {
+	meta, ok := j.meta[key]
+	if !ok {
+		meta = &ResultMeta{}
+		j.meta[key] = meta
+	}
+	return meta
+}
+
+func (j *Job) addSource(key, file, nodeID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	meta := j.keyMeta(key)
+	meta.Files = append(meta.Files, file)
+	meta.Nodes = append(meta.Nodes, nodeID)
+}
+
+func (j *Job) reduced(key string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keyMeta(key).ReduceIterations++
+}
+
+// Counters returns the current value of each counter that was updated during
+// the Job (see IncCounter).
+func (j *Job) Counters() map[string]int64 {
+	return j.counters.Values()
+}
+
+// Accumulators returns the accumulators of the Job (see AccumulateSum,
+// AccumulateMax and AccumulateSet).
+func (j *Job) Accumulators() *Accumulators {
+	return j.accumulators
+}
+
+// Output returns the values that were emitted to the named side output for
+// each key. It is only complete once the Job has finished.
+func (j *Job) Output(name string) map[string][][]byte {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	output := make(map[string][][]byte)
+	for key, values := range j.outputs[name] {
+		output[key] = values
+	}
+	return output
+}
+
+func (j *Job) emit(output, key string, value []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.outputs[output] == nil {
+		j.outputs[output] = make(map[string][][]byte)
+	}
+	j.outputs[output][key] = append(j.outputs[output][key], value)
+}
+
+func (j *Job) fileCompleted() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.completed++
+}
+
+func (j *Job) finish(result Results, err error) {
+	j.mu.Lock()
+	j.result, j.err = result, err
+	j.mu.Unlock()
+
+	close(j.done)
+}
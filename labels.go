@@ -0,0 +1,95 @@
+package mapreduce
+
+import "golang.org/x/net/context"
+
+// Labels reports the labels of the nodes (e.g., "ssd", "gpu" or "prod"). It
+// has to be safe for concurrent use.
+type Labels interface {
+	// Labels returns the labels of each node ID. A node that is missing has
+	// no labels.
+	Labels(ctx context.Context) (map[string][]string, error)
+}
+
+// LabelsFunc wraps a function into a Labels.
+type LabelsFunc func(ctx context.Context) (map[string][]string, error)
+
+// Labels implements Labels.
+func (f LabelsFunc) Labels(ctx context.Context) (map[string][]string, error) {
+	return f(ctx)
+}
+
+// StaticLabels returns a Labels that always reports the given labels.
+func StaticLabels(labels map[string][]string) Labels {
+	return LabelsFunc(func(ctx context.Context) (map[string][]string, error) {
+		return labels, nil
+	})
+}
+
+// WithLabels looks up the labels of the nodes via l when a calculation is
+// started, so that the calculation can require or avoid them (see
+// WithAffinity and WithAntiAffinity).
+func WithLabels(l Labels) MapReduceOption {
+	return func(r *MapReduce) {
+		r.labels = l
+	}
+}
+
+// WithAffinity only assigns the files (or splits) of a calculation to nodes
+// that have every one of the given labels (see WithLabels). A file that is
+// not available on such a node fails the calculation. The nodes that reduce
+// shuffled keys (see WithShuffle) are not affected.
+func WithAffinity(labels ...string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.affinity = labels
+	}
+}
+
+// WithAntiAffinity does not assign the files (or splits) of a calculation to
+// nodes that have any of the given labels (see WithLabels). A file that is
+// only available on such nodes fails the calculation. The nodes that reduce
+// shuffled keys (see WithShuffle) are not affected.
+func WithAntiAffinity(labels ...string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.antiAffinity = labels
+	}
+}
+
+// resolveLabels looks up the labels of the nodes. It returns nil if there is
+// no Labels.
+func (r MapReduce) resolveLabels(ctx context.Context) (map[string]map[string]bool, error) {
+	if r.labels == nil {
+		return nil, nil
+	}
+
+	labels, err := r.labels.Labels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeLabels := make(map[string]map[string]bool)
+	for id, ls := range labels {
+		nodeLabels[id] = make(map[string]bool)
+		for _, l := range ls {
+			nodeLabels[id][l] = true
+		}
+	}
+	return nodeLabels, nil
+}
+
+// matchesAffinity reports whether the node has the labels that the
+// calculation requires and none of the ones it avoids.
+func (r MapReduce) matchesAffinity(nodeID string) bool {
+	labels := r.nodeLabels[nodeID]
+	for _, l := range r.affinity {
+		if !labels[l] {
+			return false
+		}
+	}
+
+	for _, l := range r.antiAffinity {
+		if labels[l] {
+			return false
+		}
+	}
+	return true
+}
@@ -3,9 +3,12 @@
 package mapreduce
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -14,6 +17,26 @@ import (
 type Algorithm struct {
 	Mapper
 	Reducer
+
+	// Version identifies the implementation of the algorithm (e.g., a
+	// release or commit). If it is set, nodes that have a different version
+	// of the algorithm reject the calculation with a VersionMismatchError
+	// instead of computing results that do not fit together.
+	Version string
+}
+
+// Validate returns an error if the Algorithm is missing its Mapper or
+// Reducer.
+func (a Algorithm) Validate() error {
+	if a.Mapper == nil {
+		return fmt.Errorf("algorithm is missing a Mapper")
+	}
+
+	if a.Reducer == nil {
+		return fmt.Errorf("algorithm is missing a Reducer")
+	}
+
+	return nil
 }
 
 // MapReduceOption is used to configure a new MapReduce.
@@ -31,14 +54,129 @@ func WithLogger(l Log) MapReduceOption {
 	}
 }
 
+// WithMaxReduceIterations bounds the number of times the Reducer is invoked
+// for a single key, both while a node combines the values of a file (see
+// ReducePlan) and while combining the results from the remote nodes. A
+// Calculate that exceeds the limit returns an error instead of hanging. A
+// value of 0 (the default) means there is no limit.
+func WithMaxReduceIterations(n int) MapReduceOption {
+	return func(r *MapReduce) {
+		r.maxReduceIterations = n
+	}
+}
+
+// WithConvergence sets the predicate used to decide when the Reducer has
+// finished combining the values for a key. By default a key has converged
+// once a single value is left. When the predicate accepts several values,
+// they are all stored in the Results (see Results.Values). As the predicate
+// cannot be shipped to the nodes, the nodes return every value they mapped
+// and only the coordinator reduces them (see ReducePlan). It cannot be
+// combined with WithRemoteReduce.
+func WithConvergence(f func(values [][]byte) bool) MapReduceOption {
+	return func(r *MapReduce) {
+		r.converged = f
+	}
+}
+
+// WithParallelism bounds the number of files that are calculated on the
+// remote nodes at the same time. A value of 0 (the default) starts every file
+// at once.
+func WithParallelism(n int) MapReduceOption {
+	return func(r *MapReduce) {
+		r.parallelism = n
+	}
+}
+
+// WithTimeout bounds how long a Calculate may take. A value of 0 (the
+// default) relies solely on the given context.
+func WithTimeout(d time.Duration) MapReduceOption {
+	return func(r *MapReduce) {
+		r.timeout = d
+	}
+}
+
+// WithNodes restricts the calculations to the given node IDs. Files that are
+// not available on any of the given nodes fail the Calculate.
+func WithNodes(nodeIDs ...string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.nodes = make(map[string]bool)
+		for _, id := range nodeIDs {
+			r.nodes[id] = true
+		}
+	}
+}
+
+// WithRecursive treats each route as a prefix and calculates every file
+// below it, including the ones within nested directories. The FileSystem has
+// to implement ListFileSystem.
+func WithRecursive() MapReduceOption {
+	return func(r *MapReduce) {
+		r.recursive = true
+	}
+}
+
 // MapReduce is used to invoke a Map/Reduce algorithm across data on various remote nodes.
 //
+// A MapReduce may be used by several goroutines at once. Concurrent calculations share the FileSystem, Network and
+// AlgorithmFetcher, so those have to be safe for concurrent use as well.
+//
+// Each call configures its own copy of the MapReduce with the options it is given, so every option is safe to pass
+// to a single call: it does not affect the calls that run at the same time. The values some options hand over are
+// shared by every call they are passed to, namely the Cache (WithCache), Blacklist (WithBlacklist), NodePool
+// (WithNodePool), Discovery (WithDiscovery), Capacity (WithCapacity), Zones (WithZones), Labels (WithLabels) and Log
+// (WithLogger). The ones of this package are safe for concurrent use. The map given to WithRoles must not be modified
+// while a calculation uses it.
+//
 // It should be created with New().
 type MapReduce struct {
 	fs         FileSystem
 	network    Network
 	algFetcher AlgorithmFetcher
 	log        Log
+
+	maxReduceIterations int
+	converged           func(values [][]byte) bool
+	parallelism         int
+	timeout             time.Duration
+	nodes               map[string]bool
+	discovery           Discovery
+	capacity            Capacity
+	stealing            int
+	minNodes            int
+	minNodesWait        time.Duration
+	roles               map[string]Role
+	crossCheck          bool
+	partialResults      float64
+	checkpointPrefix    string
+	checkpointInterval  time.Duration
+	resumeID            string
+	resumed             *checkpoint
+	zones               Zones
+	zone                string
+	nodeZones           map[string]string
+	crossRegionLimit    int64
+	labels              Labels
+	nodeLabels          map[string]map[string]bool
+	affinity            []string
+	antiAffinity        []string
+	pool                *NodePool
+	priority            int
+	tenant              string
+	countNodeTime       bool
+	recursive           bool
+	partitionFilter     func(partitions map[string]string) bool
+	splitSize           uint64
+	badRecords          BadRecordPolicy
+	quarantinePrefix    string
+	speculation         float64
+	blacklist           *Blacklist
+	shuffle             bool
+	shuffleReplication  bool
+	remoteReduce        bool
+	unreduced           bool
+	sideInputs          map[string][]byte
+	cache               Cache
+	outputFile          string
 }
 
 // New returns a new MapReduce.
@@ -58,61 +196,821 @@ func New(fs FileSystem, network Network, algFetcher AlgorithmFetcher, opts ...Ma
 }
 
 // Calculate runs the given algorithm for the files returned from FileSystem for the given route and meta information.
-// It uses the Network to run the calculations across the remote nodes that report having the given data.
-func (r MapReduce) Calculate(route, algName string, ctx context.Context, meta []byte) (finalResult map[string][]byte, err error) {
-	files, err := r.fs.Files(route, ctx, meta)
+// It uses the Network to run the calculations across the remote nodes that report having the given data. If a node
+// fails, its files are re-dispatched to the other nodes that have them. Any given options only apply to this
+// calculation.
+func (r MapReduce) Calculate(route, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) (finalResult Results, err error) {
+	return r.CalculateMulti([]string{route}, algName, ctx, meta, opts...)
+}
+
+// CalculateMulti runs the same calculation as Calculate over the files of several routes at once. A file that is
+// returned for more than one route is only calculated once.
+func (r MapReduce) CalculateMulti(routes []string, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) (finalResult Results, err error) {
+	job, err := r.submit(routes, algName, ctx, meta, nil, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	finalResult, err = job.Wait()
+	if _, ok := err.(*PartialResultsError); ok {
+		return finalResult, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return finalResult, nil
+}
+
+// KeyedResult is a single reduced key delivered by CalculateStream. If the calculation fails, the last KeyedResult
+// only holds the error.
+type KeyedResult struct {
+	Key   string
+	Value []byte
+
+	// Values holds every converged value (see WithConvergence). Value is the first of them.
+	Values [][]byte
+
+	Err error
+}
+
+// CalculateStream runs the same calculation as Calculate, but delivers each key on the returned channel as soon as
+// its reduction has converged. The channel is closed once the calculation has finished. The calculation waits for
+// each KeyedResult to be received, so the channel has to be drained unless the context is canceled.
+func (r MapReduce) CalculateStream(route, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) (<-chan KeyedResult, error) {
+	stream := make(chan KeyedResult)
+	if _, err := r.submit([]string{route}, algName, ctx, meta, stream, opts, false); err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// Submit starts the same calculation as Calculate without waiting for it to finish. The returned Job is used to
+// wait for, cancel or monitor the calculation.
+func (r MapReduce) Submit(route, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) (*Job, error) {
+	return r.submit([]string{route}, algName, ctx, meta, nil, opts, false)
+}
+
+// SubmitMulti starts the same calculation as CalculateMulti without waiting for it to finish.
+func (r MapReduce) SubmitMulti(routes []string, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) (*Job, error) {
+	return r.submit(routes, algName, ctx, meta, nil, opts, false)
+}
+
+// submit starts the calculation. Each reduced key is also sent to the stream if it is non-nil. The Cache is only used
+// if cached is true (see WithCache).
+func (r MapReduce) submit(routes []string, algName string, ctx context.Context, meta []byte, stream chan KeyedResult, opts []MapReduceOption, cached bool) (*Job, error) {
+	for _, o := range opts {
+		o(&r)
+	}
+
+	var cancel context.CancelFunc
+	if r.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	if r.sideInputs != nil {
+		ctx = WithSideInputs(ctx, r.sideInputs)
+	}
+
+	if r.badRecords != FailOnBadRecords {
+		ctx = WithBadRecordPolicy(ctx, r.badRecords)
+	}
+
+	if r.badRecords == QuarantineBadRecords {
+		ctx = WithQuarantinePrefix(ctx, r.quarantinePrefix)
+	}
+
+	nodeLabels, err := r.resolveLabels(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.nodeLabels = nodeLabels
+
+	files, discovered, err := r.awaitNodes(routes, ctx, meta)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	balancer, err := r.balance(ctx)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	errs := make(chan error, len(files))
-	results := make(chan map[string][]byte, len(files))
+	r.nodeZones, err = r.resolveZones(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
 
+	if r.checkpointPrefix != "" && r.shuffle {
+		cancel()
+		return nil, fmt.Errorf("checkpoints do not support shuffling")
+	}
+
+	calculationID := r.resumeID
+	if calculationID == "" {
+		calculationID, err = newCalculationID()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	var cp *checkpoint
+	if r.checkpointPrefix != "" {
+		cp = r.newCheckpoint(routes, algName, meta, files)
+		if r.resumed != nil {
+			cp = r.resumed
+		}
+	}
+
+	completed := make(map[string]bool)
+	if cp != nil {
+		for _, key := range cp.Completed {
+			completed[key] = true
+		}
+	}
+
+	var assignments []assignment
 	for fileName, ids := range files {
-		// TODO: Balance load across nodes
-		id := ids[rand.Intn(len(ids))]
-		r.log.Printf("Start calculation for file %s on %s with algorithm %s", fileName, id, algName)
-		go func(fileName, id string) {
-			result, err := r.network.Execute(fileName, algName, id, ctx, meta)
-			if err != nil {
-				errs <- err
-				return
+		ids = r.eligibleNodes(ids, discovered)
+		if len(ids) == 0 {
+			cancel()
+			return nil, fmt.Errorf("no eligible node for file %s", fileName)
+		}
+
+		if r.blacklist != nil {
+			ids = r.blacklist.available(ids)
+		}
+
+		splits, err := r.splits(fileName, ctx, meta)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		for _, split := range splits {
+			var start, end uint64
+			if split != nil {
+				start, end = split.Start, split.End
+			}
+			local := r.nearestNodes(r.localNodes(fileName, start, end, ids))
+
+			// TODO: Balance load across nodes without a Capacity
+			nodeID := local[rand.Intn(len(local))]
+			if balancer != nil {
+				nodeID = balancer.assign(local, weight(split))
 			}
 
-			results <- result
-		}(fileName, id)
+			key := calculationID + "/" + task(fileName, split)
+			if completed[key] {
+				continue
+			}
+
+			assignments = append(assignments, assignment{
+				file:   fileName,
+				split:  split,
+				key:    key,
+				nodeID: nodeID,
+				nodes:  ids,
+			})
+		}
 	}
 
-	m := make(map[string][][]byte)
-	for i := 0; i < len(files); i++ {
-		select {
-		case err := <-errs:
+	if r.remoteReduce && r.converged != nil {
+		cancel()
+		return nil, fmt.Errorf("WithConvergence cannot be combined with WithRemoteReduce")
+	}
+
+	if r.shuffle {
+		if _, ok := r.network.(ShuffleNetwork); !ok {
+			cancel()
+			return nil, fmt.Errorf("Network does not support shuffling")
+		}
+
+		plan, err := r.shufflePlan(assignments, discovered)
+		if err != nil {
+			cancel()
 			return nil, err
-		case result := <-results:
-			for key, value := range result {
-				m[key] = append(m[key], value)
+		}
+		ctx = WithShufflePlan(ctx, plan)
+	}
+
+	alg, err := r.algFetcher.Alg(algName, meta)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err := alg.Validate(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: %s", algName, err)
+	}
+
+	if r.remoteReduce && emitsOutputs(alg.Reducer) {
+		cancel()
+		return nil, fmt.Errorf("%s: an OutputReducer cannot be combined with WithRemoteReduce", algName)
+	}
+
+	if alg.Version != "" {
+		ctx = WithAlgorithmVersion(ctx, alg.Version)
+	}
+
+	r.unreduced = r.converged != nil || emitsOutputs(alg.Reducer)
+	if r.maxReduceIterations > 0 || r.unreduced {
+		ctx = WithReducePlan(ctx, ReducePlan{
+			MaxIterations: r.maxReduceIterations,
+			Unreduced:     r.unreduced,
+		})
+	}
+
+	var cacheKey string
+	if cached && r.cache != nil && !r.unreduced {
+		cacheKey, err = r.cacheKey(routes, algName, alg, files, ctx, meta)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		if results, ok := r.cache.Get(cacheKey); ok {
+			r.log.Printf("Using cached results for %v with algorithm %s", routes, algName)
+			job := newJob(cancel, 0)
+			job.id = calculationID
+			go func() {
+				defer cancel()
+				var err error
+				if r.outputFile != "" {
+					err = r.Store(r.outputFile, results, ctx, meta)
+				}
+				job.finish(results, err)
+			}()
+			return job, nil
+		}
+	}
+
+	job := newJob(cancel, len(assignments))
+	job.id = calculationID
+	ctx = WithCounters(ctx, job.counters)
+	ctx = WithAccumulators(ctx, job.accumulators)
+	ctx = WithRecordCounts(ctx, job.records)
+	go func() {
+		defer cancel()
+		result, err := r.calculate(job, assignments, alg, algName, ctx, meta, stream, cp)
+		if err == nil && r.outputFile != "" {
+			err = r.Store(r.outputFile, result, ctx, meta)
+		}
+		if err == nil && cacheKey != "" {
+			r.cache.Set(cacheKey, result)
+		}
+		job.finish(result, err)
+
+		if stream == nil {
+			return
+		}
+
+		if err != nil {
+			select {
+			case stream <- KeyedResult{Err: err}:
+			case <-ctx.Done():
 			}
-		case <-ctx.Done():
-			break
 		}
+		close(stream)
+	}()
+
+	return job, nil
+}
+
+// files returns the files of every route.
+func (r MapReduce) files(routes []string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	list := r.fs.Files
+	if r.recursive {
+		lister, ok := r.fs.(ListFileSystem)
+		if !ok {
+			return nil, fmt.Errorf("FileSystem does not support listing files recursively")
+		}
+		list = lister.List
+	}
+
+	all := make(map[string][]string)
+	for _, route := range routes {
+		files, err := list(route, ctx, meta)
+		if err != nil {
+			return nil, err
+		}
+
+		for fileName, ids := range files {
+			if r.partitionFilter != nil && !r.partitionFilter(Partitions(fileName)) {
+				continue
+			}
+
+			if r.resumed != nil && !r.resumed.selected(fileName) {
+				continue
+			}
+			all[fileName] = ids
+		}
+	}
+	return all, nil
+}
+
+// splits returns the splits of the file. A nil split stands for the whole
+// file.
+func (r MapReduce) splits(file string, ctx context.Context, meta []byte) ([]*Split, error) {
+	if r.splitSize == 0 {
+		return []*Split{nil}, nil
+	}
+
+	statter, ok := r.fs.(StatFileSystem)
+	if !ok {
+		return nil, fmt.Errorf("FileSystem does not support splitting files")
+	}
+
+	if _, ok := r.fs.(RangeFileSystem); !ok {
+		return nil, fmt.Errorf("FileSystem does not support splitting files")
 	}
 
-	finalResult = make(map[string][]byte)
-	reducer, err := r.algFetcher.Alg(algName, meta)
+	info, err := statter.Stat(file, ctx, meta)
 	if err != nil {
 		return nil, err
 	}
 
-	for key, results := range m {
-		// TODO: Circuit break?
-		for len(results) > 1 {
-			results, err = reducer.Reduce(results)
-			if err != nil {
+	size := uint64(info.Size)
+	if size <= r.splitSize {
+		return []*Split{nil}, nil
+	}
+
+	var splits []*Split
+	for start := uint64(0); start < size; start += r.splitSize {
+		end := start + r.splitSize
+		if end > size {
+			end = size
+		}
+		splits = append(splits, &Split{Start: start, End: end})
+	}
+	return splits, nil
+}
+
+// assignment is a file, or a split of it, that is calculated on a node.
+// The other nodes that have the file take over if the node fails.
+type assignment struct {
+	file   string
+	split  *Split
+	key    string
+	nodeID string
+	nodes  []string
+}
+
+// fileError is the error of a file that failed on every node.
+type fileError struct {
+	a   assignment
+	err error
+}
+
+// fileResult is a file that was calculated on a remote node. Its result was
+// emitted to the sink.
+type fileResult struct {
+	file, key, nodeID string
+	sink              *fileSink
+}
+
+// calculate executes each file on its assigned node and reduces the results.
+// The batches of each file are merged as they arrive and discarded again if
+// the attempt fails (see fileSink). The checkpoint (cp) is nil unless
+// WithCheckpoints is used. It holds the values of the files that were
+// calculated before the calculation was resumed.
+func (r MapReduce) calculate(job *Job, assignments []assignment, alg Algorithm, algName string, ctx context.Context, meta []byte, stream chan<- KeyedResult, cp *checkpoint) (Results, error) {
+	errs := make(chan fileError, len(assignments))
+	results := make(chan fileResult, len(assignments))
+	events := make(chan sinkEvent)
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopMerging := func() {
+		stopOnce.Do(func() { close(stop) })
+	}
+	defer stopMerging()
+
+	crossCheck := r.crossCheck && !r.shuffle
+	newSink := func(a assignment) func() *fileSink {
+		return func() *fileSink {
+			sink := &fileSink{a: a, events: events, stop: stop}
+			if crossCheck {
+				sink.hashes = make(map[string][]byte)
+			}
+			return sink
+		}
+	}
+
+	parallelism := r.parallelism
+	if parallelism <= 0 {
+		parallelism = len(assignments)
+	}
+	sem := make(chan struct{}, parallelism)
+	failed := newNodeSet()
+	stragglers := newStragglers(r.speculation)
+	var checks sync.WaitGroup
+
+	run := func(a assignment) {
+		ctx := WithIdempotencyKey(ctx, a.key)
+		if a.split != nil {
+			r.log.Printf("Start calculation for file %s (bytes %d-%d) on %s with algorithm %s", a.file, a.split.Start, a.split.End, a.nodeID, algName)
+			ctx = WithSplit(ctx, *a.split)
+		} else {
+			r.log.Printf("Start calculation for file %s on %s with algorithm %s", a.file, a.nodeID, algName)
+		}
+
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-ctx.Done():
+			errs <- fileError{a: a, err: ctx.Err()}
+			return
+		}
+
+		sink, nodeID, err := r.speculate(a, algName, ctx, meta, failed, stragglers, newSink(a))
+		if err != nil {
+			errs <- fileError{a: a, err: err}
+			return
+		}
+
+		if crossCheck {
+			resultDigest := sink.digest()
+			checks.Add(1)
+			go func() {
+				defer checks.Done()
+				r.checkReplica(job, a, resultDigest, nodeID, algName, ctx, meta)
+			}()
+		}
+
+		results <- fileResult{file: a.file, key: a.key, nodeID: nodeID, sink: sink}
+	}
+
+	if r.stealing > 0 {
+		queues := newWorkQueues(assignments, r.log)
+		for _, nodeID := range queues.nodes() {
+			for i := 0; i < r.stealing; i++ {
+				go func(nodeID string) {
+					for {
+						a, ok := queues.next(nodeID)
+						if !ok {
+							return
+						}
+						run(a)
+					}
+				}(nodeID)
+			}
+		}
+	} else {
+		for _, a := range assignments {
+			go run(a)
+		}
+	}
+
+	var resumed map[string][][]byte
+	if cp != nil {
+		resumed = cp.Values
+	}
+	merger := newMerger(resumed)
+
+	var crossRegion int64
+	var tick <-chan time.Time
+	if cp != nil {
+		if r.checkpointInterval > 0 {
+			ticker := time.NewTicker(r.checkpointInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+	}
+
+	merged := make(map[string]bool)
+	var partial *PartialResultsError
+	for len(merged) < len(assignments) {
+		select {
+		case <-tick:
+			cp.Values = merger.committed()
+			r.writeCheckpoint(job.ID(), cp, ctx)
+		case ev := <-events:
+			if merged[ev.sink.a.key] {
+				continue
+			}
+
+			if ev.discard {
+				merger.discard(ev.sink)
+				continue
+			}
+
+			if err := r.transferred(job, ev.nodeID, ev.batch, &crossRegion); err != nil {
 				return nil, err
 			}
+
+			for key, value := range ev.batch {
+				merger.add(ev.sink, key, r.nodeValues(value))
+			}
+		case f := <-errs:
+			merger.abandon(f.a.key)
+			if ctx.Err() != nil || r.partialResults <= 0 {
+				return nil, f.err
+			}
+
+			if partial == nil {
+				partial = &PartialResultsError{Total: len(assignments)}
+			}
+			partial.Missing = append(partial.Missing, MissingFile{File: f.a.file, Split: f.a.split, Err: f.err})
+			merged[f.a.key] = true
+			job.fileCompleted()
+			r.log.Printf("Calculation for file %s failed on every node: %s", f.a.file, f.err)
+
+			if !r.tolerates(len(partial.Missing), len(assignments)) {
+				return nil, partial
+			}
+		case result := <-results:
+			if merged[result.key] {
+				r.log.Printf("Discarding duplicate result for file %s from %s", result.file, result.nodeID)
+				continue
+			}
+			merged[result.key] = true
+			if cp != nil {
+				cp.Completed = append(cp.Completed, result.key)
+			}
+
+			for key := range merger.commit(result.sink) {
+				job.addSource(key, result.file, result.nodeID)
+			}
+			job.fileCompleted()
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-		finalResult[key] = results[0]
+	}
+
+	stopMerging()
+	m := merger.values
+
+	if cp != nil {
+		cp.Values = m
+		r.writeCheckpoint(job.ID(), cp, ctx)
+	}
+
+	if plan, ok := ShufflePlanFrom(ctx); ok {
+		if r.remoteReduce {
+			return r.collectReduced(plan, algName, ctx, meta, stream)
+		}
+
+		err := r.collect(plan, algName, ctx, meta, func(result map[string][]byte) error {
+			for key, value := range result {
+				m[key] = append(m[key], r.nodeValues(value)...)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	finalResult := make(Results)
+
+	for key, results := range m {
+		results, err := r.reduce(job, alg.Reducer, key, results)
+		if err != nil {
+			return nil, err
+		}
+
+		finalResult[key] = joinValues(results)
+
+		if stream == nil {
+			continue
+		}
+
+		var value []byte
+		if len(results) > 0 {
+			value = results[0]
+		}
+
+		select {
+		case stream <- KeyedResult{Key: key, Value: value, Values: results}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	checks.Wait()
+	if partial != nil {
+		return finalResult, partial
 	}
 
 	return finalResult, nil
 }
+
+// execute executes the assignment on its node and emits its result to the
+// sink. If the node fails (see NodeFailure), its batches are discarded and
+// the assignment is re-dispatched to the other nodes that have the file,
+// preferring the ones that have not failed during the calculation yet. The
+// error of the last node is returned if all of them fail. Any other error is
+// returned right away. It returns the node that calculated the assignment.
+func (r MapReduce) execute(a assignment, algName string, ctx context.Context, meta []byte, failed *nodeSet, sink *fileSink) (string, error) {
+	tried := make(map[string]bool)
+	nodeID := a.nodeID
+	for {
+		err := r.executePooled(a.file, algName, nodeID, ctx, meta, sink)
+		if err == nil {
+			return nodeID, nil
+		}
+
+		if ctx.Err() != nil || !isNodeFailure(err) {
+			return "", err
+		}
+
+		sink.discard()
+		tried[nodeID] = true
+		failed.add(nodeID)
+		if r.blacklist != nil {
+			r.blacklist.Failed(nodeID)
+		}
+
+		next, ok := failed.pick(a.nodes, tried)
+		if !ok {
+			return "", err
+		}
+
+		r.log.Printf("Calculation for file %s failed on %s (%s), re-dispatching to %s", a.file, nodeID, err, next)
+		nodeID = next
+	}
+}
+
+// executeOn executes the file on the node and invokes emit for each batch
+// of a StreamNetwork as it arrives. A Network that does not stream emits its
+// result as a single batch. The batches of a call that returns an error are
+// incomplete.
+func (r MapReduce) executeOn(file, algName, nodeID string, ctx context.Context, meta []byte, emit func(batch map[string][]byte)) error {
+	network, ok := r.network.(StreamNetwork)
+	if ok {
+		return network.ExecuteStream(file, algName, nodeID, ctx, meta, emit)
+	}
+
+	result, err := r.network.Execute(file, algName, nodeID, ctx, meta)
+	if err != nil {
+		return err
+	}
+	emit(result)
+	return nil
+}
+
+// nodeSet is a set of node IDs that is safe for concurrent use.
+type nodeSet struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func newNodeSet() *nodeSet {
+	return &nodeSet{ids: make(map[string]bool)}
+}
+
+func (s *nodeSet) add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = true
+}
+
+func (s *nodeSet) has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[id]
+}
+
+// pick returns a node that was not tried yet, preferring the ones that are
+// not in the set.
+func (s *nodeSet) pick(ids []string, tried map[string]bool) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var fallback []string
+	var candidates []string
+	for _, id := range ids {
+		if tried[id] {
+			continue
+		}
+
+		if s.ids[id] {
+			fallback = append(fallback, id)
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+
+	if len(candidates) == 0 {
+		candidates = fallback
+	}
+
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return candidates[rand.Intn(len(candidates))], true
+}
+
+// eligibleNodes filters the node IDs down to the ones the calculation is
+// allowed to map the files on.
+func (r MapReduce) eligibleNodes(ids []string, discovered map[string]bool) []string {
+	if r.nodes == nil && discovered == nil && r.roles == nil && r.affinity == nil && r.antiAffinity == nil {
+		return ids
+	}
+
+	var eligible []string
+	for _, id := range ids {
+		if r.nodes != nil && !r.nodes[id] {
+			continue
+		}
+
+		if !r.maps(id) {
+			continue
+		}
+
+		if discovered != nil && !discovered[id] {
+			continue
+		}
+
+		if !r.matchesAffinity(id) {
+			continue
+		}
+		eligible = append(eligible, id)
+	}
+	return eligible
+}
+
+// localNodes narrows the node IDs down to the ones that hold the range of
+// the file locally. If the FileSystem does not know or none of them do, the
+// node IDs are returned as is.
+func (r MapReduce) localNodes(file string, start, end uint64, ids []string) []string {
+	fs, ok := r.fs.(LocalityFileSystem)
+	if !ok {
+		return ids
+	}
+
+	local := make(map[string]bool)
+	for _, id := range fs.NodesFor(file, start, end) {
+		local[id] = true
+	}
+
+	var preferred []string
+	for _, id := range ids {
+		if local[id] {
+			preferred = append(preferred, id)
+		}
+	}
+
+	if len(preferred) == 0 {
+		return ids
+	}
+	return preferred
+}
+
+// hasConverged applies the predicate of WithConvergence to the values of a
+// key.
+func (r MapReduce) hasConverged(values [][]byte) bool {
+	if r.converged == nil {
+		return len(values) <= 1
+	}
+	return r.converged(values)
+}
+
+// nodeValues returns the values that a node returned for a key. The nodes of
+// a calculation with WithConvergence or an OutputReducer do not reduce, and
+// join the values of each key instead (see ReducePlan).
+func (r MapReduce) nodeValues(value []byte) [][]byte {
+	if !r.unreduced {
+		return [][]byte{value}
+	}
+	return splitValues(value)
+}
+
+// reduce invokes the reducer until the values for the key have converged.
+func (r MapReduce) reduce(job *Job, reducer Reducer, key string, values [][]byte) ([][]byte, error) {
+	emit := func(output string, value []byte) {
+		job.emit(output, key, value)
+	}
+
+	for i := 0; !r.hasConverged(values); i++ {
+		if r.maxReduceIterations > 0 && i >= r.maxReduceIterations {
+			return nil, fmt.Errorf("%s: key %s did not converge after %d iterations", stageName(reducer, ReduceStage), key, r.maxReduceIterations)
+		}
+
+		job.reduced(key)
+
+		var err error
+		if outputReducer, ok := reducer.(OutputReducer); ok {
+			values, err = outputReducer.ReduceOutputs(values, emit)
+		} else {
+			values, err = reducer.Reduce(values)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
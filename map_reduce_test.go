@@ -4,16 +4,22 @@ package mapreduce_test
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/poy/eachers/testhelpers"
 	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
 	"github.com/poy/onpar"
 	. "github.com/poy/onpar/expect"
 	. "github.com/poy/onpar/matchers"
@@ -31,7 +37,7 @@ func TestMain(m *testing.M) {
 type TMR struct {
 	*testing.T
 
-	mockFileSystem *mockFileSystem
+	fs             *fsfakes.InMemory
 	mockNetwork    *mockNetwork
 	mockAlgorithm  *mockReducer
 	mockAlgFetcher *mockAlgorithmFetcher
@@ -45,12 +51,12 @@ func TestMapReduce(t *testing.T) {
 	defer o.Run(t)
 
 	o.BeforeEach(func(t *testing.T) TMR {
-		mockFileSystem := newMockFileSystem()
+		fs := fsfakes.NewInMemory()
 		mockNetwork := newMockNetwork()
 		mockReducer := newMockReducer()
 		mockAlgFetcher := newMockAlgorithmFetcher()
 
-		mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Reducer: mockReducer}
+		mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Mapper: newMockMapper(), Reducer: mockReducer}
 		close(mockAlgFetcher.AlgOutput.Err)
 
 		var opts []mapreduce.MapReduceOption
@@ -61,20 +67,17 @@ func TestMapReduce(t *testing.T) {
 		return TMR{
 			T:              t,
 			mockNetwork:    mockNetwork,
-			mockFileSystem: mockFileSystem,
+			fs:             fs,
 			mockAlgorithm:  mockReducer,
 			mockAlgFetcher: mockAlgFetcher,
-			mr:             mapreduce.New(mockFileSystem, mockNetwork, mockAlgFetcher, opts...),
+			mr:             mapreduce.New(fs, mockNetwork, mockAlgFetcher, opts...),
 		}
 	})
 
 	o.Group("when the FileSystem does not return an error", func() {
 		o.BeforeEach(func(t TMR) TMR {
-			testhelpers.AlwaysReturn(t.mockFileSystem.FilesOutput.Files, map[string][]string{
-				"some-name-a": []string{"id-a", "id-b"},
-				"some-name-b": []string{"id-b", "id-c"},
-			})
-			close(t.mockFileSystem.FilesOutput.Err)
+			t.fs.SetNodes("some-file-a", "id-a", "id-b")
+			t.fs.SetNodes("some-file-b", "id-b", "id-c")
 			return t
 		})
 
@@ -96,11 +99,44 @@ func TestMapReduce(t *testing.T) {
 					return t
 				})
 
+				o.Spec("it reports a finished job", func(t TMR) {
+					job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					job.Wait()
+
+					Expect(t, job.Status()).To(Equal(mapreduce.JobSucceeded))
+					completed, total := job.Progress()
+					Expect(t, completed).To(Equal(2))
+					Expect(t, total).To(Equal(2))
+				})
+
 				o.Spec("it does not return an error", func(t TMR) {
 					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
 					Expect(t, err == nil).To(BeTrue())
 				})
 
+				o.Spec("it can calculate concurrently", func(t TMR) {
+					for i := 0; i < 4; i++ {
+						t.mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Mapper: newMockMapper(), Reducer: t.mockAlgorithm}
+					}
+
+					errs := make(chan error, 5)
+					for i := 0; i < 5; i++ {
+						go func() {
+							_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+							errs <- err
+						}()
+					}
+
+					for i := 0; i < 5; i++ {
+						select {
+						case err := <-errs:
+							Expect(t, err == nil).To(BeTrue())
+						case <-time.NewTimer(time.Second).C:
+							t.Fatalf("expected to receive (i=%d)", i)
+						}
+					}
+				})
+
 				o.Spec("it uses the correct chain name", func(t TMR) {
 					t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
 
@@ -114,15 +150,167 @@ func TestMapReduce(t *testing.T) {
 					m := toMap(t.mockNetwork.ExecuteInput.File, t.mockNetwork.ExecuteInput.NodeID, 2)
 					Expect(t, m).To(HaveLen(2))
 
-					id, ok := m["some-name-a"]
+					id, ok := m["some-file-a"]
 					Expect(t, ok).To(BeTrue())
 					Expect(t, id).To(Or(Equal("id-a"), Equal("id-b")))
 
-					id, ok = m["some-name-b"]
+					id, ok = m["some-file-b"]
 					Expect(t, ok).To(BeTrue())
 					Expect(t, id).To(Or(Equal("id-b"), Equal("id-c")))
 				})
 
+				o.Spec("it executes the files of every route once", func(t TMR) {
+					t.fs.SetNodes("other-file", "id-c")
+					t.mr.CalculateMulti([]string{"some-file-a", "some-file", "other-file"}, "some-alg", context.Background(), nil)
+
+					m := toMap(t.mockNetwork.ExecuteInput.File, t.mockNetwork.ExecuteInput.NodeID, 3)
+					Expect(t, m).To(HaveLen(3))
+					Expect(t, m).To(HaveKey("other-file"))
+					Expect(t, t.mockNetwork.ExecuteInput.File).To(Always(Not(Receive())))
+				})
+
+				o.Spec("it lists the files of the route when recursive", func(t TMR) {
+					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithRecursive())
+					Expect(t, err == nil).To(BeTrue())
+				})
+
+				o.Spec("it prunes the partitions the filter rejects", func(t TMR) {
+					t.fs.SetNodes("some-file/dt=1/a", "id-a")
+					t.fs.SetNodes("some-file/dt=2/a", "id-a")
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithPartitionFilter(func(partitions map[string]string) bool {
+						return partitions["dt"] != "1"
+					}))
+
+					files := toSlice(t.mockNetwork.ExecuteInput.File, 3)
+					Expect(t, files).To(Not(Contain("some-file/dt=1/a")))
+					Expect(t, files).To(Contain("some-file/dt=2/a"))
+				})
+
+				o.Spec("it returns an error when recursive but the FileSystem cannot list", func(t TMR) {
+					mr := mapreduce.New(struct{ mapreduce.FileSystem }{t.fs}, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithRecursive())
+					_, err := mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it prefers the nodes that hold the file locally", func(t TMR) {
+					fs := localityFileSystem{
+						InMemory: t.fs,
+						nodes:    map[string][]string{"some-file-a": {"id-b"}},
+					}
+					mr := mapreduce.New(fs, t.mockNetwork, t.mockAlgFetcher)
+					mr.Calculate("some-file", "some-alg", context.Background(), nil)
+
+					m := toMap(t.mockNetwork.ExecuteInput.File, t.mockNetwork.ExecuteInput.NodeID, 2)
+					Expect(t, m["some-file-a"]).To(Equal("id-b"))
+				})
+
+				o.Spec("it tags each file with an idempotency key", func(t TMR) {
+					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					keys := make(map[string]bool)
+					for i := 0; i < 2; i++ {
+						key, ok := mapreduce.IdempotencyKeyFrom(<-t.mockNetwork.ExecuteInput.Ctx)
+						Expect(t, ok).To(BeTrue())
+						keys[key] = true
+					}
+					Expect(t, keys).To(HaveLen(2))
+				})
+
+				o.Spec("it calculates large files in splits", func(t TMR) {
+					t.fs.Write("some-file-a", []byte("0123456789"))
+					mr := mapreduce.New(rangeFileSystem{t.fs}, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithSplitSize(4))
+					_, err := mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					var splits []mapreduce.Split
+					for i := 0; i < 4; i++ {
+						if split, ok := mapreduce.SplitFrom(<-t.mockNetwork.ExecuteInput.Ctx); ok {
+							splits = append(splits, split)
+						}
+					}
+					Expect(t, splits).To(HaveLen(3))
+					Expect(t, splits).To(Contain(
+						mapreduce.Split{Start: 0, End: 4},
+						mapreduce.Split{Start: 4, End: 8},
+						mapreduce.Split{Start: 8, End: 10},
+					))
+				})
+
+				o.Spec("it returns an error when the FileSystem cannot split files", func(t TMR) {
+					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithSplitSize(4))
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it passes the bad record policy to the Network", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithBadRecords(mapreduce.SkipBadRecords))
+
+					ctx := <-t.mockNetwork.ExecuteInput.Ctx
+					Expect(t, mapreduce.BadRecordPolicyFrom(ctx)).To(Equal(mapreduce.SkipBadRecords))
+				})
+
+				o.Spec("it passes the quarantine to the Network", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithQuarantine("some-prefix"))
+
+					ctx := <-t.mockNetwork.ExecuteInput.Ctx
+					Expect(t, mapreduce.BadRecordPolicyFrom(ctx)).To(Equal(mapreduce.QuarantineBadRecords))
+					Expect(t, mapreduce.QuarantinePrefixFrom(ctx)).To(Equal("some-prefix"))
+				})
+
+				o.Spec("it only uses the nodes given to the call", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithNodes("id-b"))
+
+					m := toMap(t.mockNetwork.ExecuteInput.File, t.mockNetwork.ExecuteInput.NodeID, 2)
+					Expect(t, m).To(Equal(map[string]string{
+						"some-file-a": "id-b",
+						"some-file-b": "id-b",
+					}))
+				})
+
+				o.Spec("it returns an error when a file is not on the given nodes", func(t TMR) {
+					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithNodes("id-a"))
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it does not use blacklisted nodes", func(t TMR) {
+					blacklist := mapreduce.NewBlacklist(1, time.Minute)
+					blacklist.Failed("id-b")
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithBlacklist(blacklist))
+
+					m := toMap(t.mockNetwork.ExecuteInput.File, t.mockNetwork.ExecuteInput.NodeID, 2)
+					Expect(t, m).To(Equal(map[string]string{
+						"some-file-a": "id-a",
+						"some-file-b": "id-c",
+					}))
+				})
+
+				o.Spec("it only uses the discovered nodes", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithDiscovery(mapreduce.StaticNodes("id-b", "id-d")))
+
+					m := toMap(t.mockNetwork.ExecuteInput.File, t.mockNetwork.ExecuteInput.NodeID, 2)
+					Expect(t, m).To(Equal(map[string]string{
+						"some-file-a": "id-b",
+						"some-file-b": "id-b",
+					}))
+				})
+
+				o.Spec("it returns an error when the nodes cannot be discovered", func(t TMR) {
+					discovery := mapreduce.DiscoveryFunc(func(ctx context.Context) ([]string, error) {
+						return nil, fmt.Errorf("some-error")
+					})
+					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithDiscovery(discovery))
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it passes the side inputs to the Network", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithSideInput("some-input", []byte("some-data")))
+
+					ctx := <-t.mockNetwork.ExecuteInput.Ctx
+					Expect(t, mapreduce.SideInputs(ctx)).To(Equal(map[string][]byte{
+						"some-input": []byte("some-data"),
+					}))
+				})
+
 				o.Spec("it returns the results", func(t TMR) {
 					result, _ := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
 
@@ -131,6 +319,37 @@ func TestMapReduce(t *testing.T) {
 					Expect(t, result["key-1"]).To(Equal([]byte("some-value-1")))
 				})
 
+				o.Spec("it streams each result", func(t TMR) {
+					stream, err := t.mr.CalculateStream("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					var results []mapreduce.KeyedResult
+					for result := range stream {
+						results = append(results, result)
+					}
+					Expect(t, results).To(HaveLen(2))
+					Expect(t, results).To(Contain(mapreduce.KeyedResult{
+						Key:    "key-0",
+						Value:  []byte("some-value-0"),
+						Values: [][]byte{[]byte("some-value-0")},
+					}))
+				})
+
+				o.Spec("it returns cached results for repeated calculations", func(t TMR) {
+					for i := 0; i < 2; i++ {
+						t.mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Mapper: newMockMapper(), Reducer: t.mockAlgorithm}
+					}
+
+					mr := mapreduce.New(t.fs, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithCache(mapreduce.NewMemoryCache(time.Minute)))
+					first, err := mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					second, err := mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, second).To(Equal(first))
+					Expect(t, t.mockNetwork.ExecuteCalled).To(Always(HaveLen(2)))
+				})
+
 				o.Spec("it does not need the reducer", func(t TMR) {
 					t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
 
@@ -186,6 +405,18 @@ func TestMapReduce(t *testing.T) {
 						))
 					})
 
+					o.Spec("it reports where the result came from", func(t TMR) {
+						job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+						job.Wait()
+
+						meta, ok := job.Meta("same-key")
+						Expect(t, ok).To(BeTrue())
+						Expect(t, meta.Files).To(HaveLen(2))
+						Expect(t, meta.Files).To(Contain("some-file-a", "some-file-b"))
+						Expect(t, meta.Nodes).To(HaveLen(2))
+						Expect(t, meta.ReduceIterations).To(Equal(5))
+					})
+
 					o.Spec("it combines until there is a single result for the key", func(t TMR) {
 						t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
 
@@ -205,6 +436,938 @@ func TestMapReduce(t *testing.T) {
 					})
 				})
 			})
+
+			o.Group("when the reducer writes to side outputs", func() {
+				o.BeforeEach(func(t TMR) TMR {
+					testhelpers.AlwaysReturn(t.mockNetwork.ExecuteOutput.Result, map[string][]byte{
+						"same-key": []byte("some-value"),
+					})
+
+					mockAlgFetcher := newMockAlgorithmFetcher()
+					mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{
+						Mapper: newMockMapper(),
+						Reducer: mapreduce.OutputReduceFunc(func(value [][]byte, emit mapreduce.Emit) ([][]byte, error) {
+							emit("metrics", []byte(fmt.Sprint(len(value))))
+							return value[:1], nil
+						}),
+					}
+					close(mockAlgFetcher.AlgOutput.Err)
+
+					t.mr = mapreduce.New(t.fs, t.mockNetwork, mockAlgFetcher)
+					return t
+				})
+
+				o.Spec("it makes the side outputs available on the job", func(t TMR) {
+					job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					result, err := job.Wait()
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, result["same-key"]).To(Equal([]byte("some-value")))
+
+					Expect(t, job.Output("metrics")).To(Equal(map[string][][]byte{
+						"same-key": {[]byte("2")},
+					}))
+					Expect(t, job.Output("errors")).To(HaveLen(0))
+				})
+			})
+
+			o.Group("when the reducer never converges", func() {
+				o.BeforeEach(func(t TMR) TMR {
+					testhelpers.AlwaysReturn(t.mockNetwork.ExecuteOutput.Result, map[string][]byte{
+						"same-key": []byte("some-value"),
+					})
+					testhelpers.AlwaysReturn(t.mockAlgorithm.ReduceOutput.Reduced, [][]byte{
+						[]byte("a"),
+						[]byte("b"),
+					})
+					close(t.mockAlgorithm.ReduceOutput.Err)
+
+					t.mr = mapreduce.New(t.fs, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithMaxReduceIterations(3))
+					return t
+				})
+
+				o.Spec("it returns an error", func(t TMR) {
+					_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeFalse())
+				})
+
+				o.Spec("it stops invoking the reducer after the limit", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, t.mockAlgorithm.ReduceCalled).To(Always(HaveLen(3)))
+				})
+			})
+			o.Group("when a convergence predicate is given", func() {
+				o.BeforeEach(func(t TMR) TMR {
+					testhelpers.AlwaysReturn(t.mockNetwork.ExecuteOutput.Result, map[string][]byte{
+						"same-key": []byte("some-value"),
+					})
+					testhelpers.AlwaysReturn(t.mockAlgorithm.ReduceOutput.Reduced, [][]byte{
+						[]byte("a"),
+						[]byte("b"),
+					})
+					close(t.mockAlgorithm.ReduceOutput.Err)
+
+					t.mr = mapreduce.New(t.fs, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithConvergence(func(values [][]byte) bool {
+						return len(values) <= 1 || string(values[0]) == "a"
+					}))
+					return t
+				})
+
+				o.Spec("it stops reducing once the predicate is satisfied", func(t TMR) {
+					result, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, result.Values("same-key")).To(Equal([][]byte{
+						[]byte("a"),
+						[]byte("b"),
+					}))
+					Expect(t, t.mockAlgorithm.ReduceCalled).To(Always(HaveLen(1)))
+				})
+
+				o.Spec("it looks up the first converged value", func(t TMR) {
+					result, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					value, ok := result.Lookup("same-key")
+					Expect(t, ok).To(BeTrue())
+					Expect(t, value).To(Equal([]byte("a")))
+				})
+
+				o.Spec("it keeps every converged value when the Results are encoded", func(t TMR) {
+					result, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+
+					decoded, err := mapreduce.ResultsFromProto(result.ToProto())
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, decoded.Values("same-key")).To(Equal([][]byte{
+						[]byte("a"),
+						[]byte("b"),
+					}))
+				})
+
+				o.Spec("it leaves the reduction to the coordinator", func(t TMR) {
+					t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+
+					ctx := <-t.mockNetwork.ExecuteInput.Ctx
+					plan, ok := mapreduce.ReducePlanFrom(ctx)
+					Expect(t, ok).To(BeTrue())
+					Expect(t, plan.Unreduced).To(BeTrue())
+				})
+
+				o.Spec("it makes a copy of every converged value available on the job", func(t TMR) {
+					job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					job.Wait()
+
+					job.Values("same-key")[0][0] = 'x'
+					Expect(t, job.Values("same-key")).To(Equal([][]byte{
+						[]byte("a"),
+						[]byte("b"),
+					}))
+				})
+			})
+			o.Group("when the Network is slow", func() {
+				o.Spec("it does not exceed the parallelism", func(t TMR) {
+					mr := mapreduce.New(t.fs, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithParallelism(1))
+					go mr.Calculate("some-file", "some-alg", context.Background(), nil)
+
+					Expect(t, t.mockNetwork.ExecuteCalled).To(ViaPolling(HaveLen(1)))
+					Expect(t, t.mockNetwork.ExecuteCalled).To(Always(HaveLen(1)))
+				})
+
+				o.Spec("it reports a submitted job as running", func(t TMR) {
+					job, err := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeTrue())
+					Expect(t, job.Status()).To(Equal(mapreduce.JobRunning))
+
+					completed, total := job.Progress()
+					Expect(t, completed).To(Equal(0))
+					Expect(t, total).To(Equal(2))
+				})
+
+				o.Spec("it makes the counters available on the job", func(t TMR) {
+					job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					ctx := <-t.mockNetwork.ExecuteInput.Ctx
+					mapreduce.IncCounter(ctx, "bad-records")
+					mapreduce.AddCounter(ctx, "bad-records", 2)
+
+					Expect(t, job.Counters()).To(Equal(map[string]int64{
+						"bad-records": 3,
+					}))
+				})
+
+				o.Spec("it makes the accumulators available on the job", func(t TMR) {
+					job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					ctx := <-t.mockNetwork.ExecuteInput.Ctx
+					mapreduce.AccumulateMax(ctx, "some-max", 5)
+					mapreduce.AccumulateMax(ctx, "some-max", 3)
+					mapreduce.AccumulateSet(ctx, "some-set", "b", "a", "b")
+
+					max, ok := job.Accumulators().Max("some-max")
+					Expect(t, ok).To(BeTrue())
+					Expect(t, max).To(Equal(int64(5)))
+					Expect(t, job.Accumulators().Set("some-set")).To(Equal([]string{"a", "b"}))
+				})
+
+				o.Spec("it stops a canceled job", func(t TMR) {
+					job, _ := t.mr.Submit("some-file", "some-alg", context.Background(), nil)
+					job.Cancel()
+
+					_, err := job.Wait()
+					Expect(t, err == nil).To(BeFalse())
+					Expect(t, job.Status()).To(Equal(mapreduce.JobCanceled))
+				})
+
+				o.Spec("it returns an error after the timeout", func(t TMR) {
+					mr := mapreduce.New(t.fs, t.mockNetwork, t.mockAlgFetcher, mapreduce.WithTimeout(time.Millisecond))
+					_, err := mr.Calculate("some-file", "some-alg", context.Background(), nil)
+					Expect(t, err == nil).To(BeFalse())
+				})
+			})
+		})
+
+		o.Spec("it returns a copy of the result from each Wait", func(t TMR) {
+			job, err := mapreduce.New(t.fs, echoNetwork{}, mapreduce.AlgFetcherMap{
+				"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				})},
+			}).Submit("some-file", "some-alg", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+
+			results, err := job.Wait()
+			Expect(t, err == nil).To(BeTrue())
+			results["some-file-a"][0] = 'x'
+			delete(results, "some-file-b")
+
+			results, _ = job.Wait()
+			Expect(t, results).To(Equal(mapreduce.Results{
+				"some-file-a": []byte("some-file-a"),
+				"some-file-b": []byte("some-file-b"),
+			}))
+		})
+
+		o.Group("when a node is a straggler", func() {
+			o.Spec("it takes the result of a duplicate on an idle node", func(t TMR) {
+				t.fs.SetNodes("some-file-b", "id-b", "id-c")
+				fs := localityFileSystem{
+					InMemory: t.fs,
+					nodes: map[string][]string{
+						"some-file-a": {"id-a"},
+						"some-file-b": {"id-c"},
+					},
+				}
+				network := stragglerNetwork{straggler: "id-c"}
+				mr := mapreduce.New(fs, network, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+
+				results, err := mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithSpeculation(2), mapreduce.WithTimeout(5*time.Second))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("id-a"),
+					"some-file-b": []byte("id-b"),
+				}))
+			})
+		})
+
+		o.Group("when the Network streams the results", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				fs := localityFileSystem{
+					InMemory: t.fs,
+					nodes: map[string][]string{
+						"some-file-a": {"id-a"},
+						"some-file-b": {"id-c"},
+					},
+				}
+				t.mr = mapreduce.New(fs, streamingNetwork{failing: "id-a", straggler: "id-c"}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+				return t
+			})
+
+			o.Spec("it discards the batches of a node that fails halfway", func(t TMR) {
+				results, err := t.mr.Calculate("some-file-a", "some-alg", context.Background(), nil, mapreduce.WithTimeout(5*time.Second))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a-id-b":   []byte("id-b"),
+					"some-file-a-second": []byte("id-b"),
+				}))
+			})
+
+			o.Spec("it discards the batches of a straggler once its duplicate finished", func(t TMR) {
+				results, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithSpeculation(2), mapreduce.WithTimeout(5*time.Second))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a-id-b":   []byte("id-b"),
+					"some-file-a-second": []byte("id-b"),
+					"some-file-b-id-b":   []byte("id-b"),
+					"some-file-b-second": []byte("id-b"),
+				}))
+			})
+		})
+
+		o.Group("when the nodes report their capacity", func() {
+			o.Spec("it assigns the files in proportion to the capacity", func(t TMR) {
+				fs := fsfakes.NewInMemory()
+				for i := 0; i < 8; i++ {
+					fs.SetNodes(fmt.Sprintf("some-file-%d", i), "id-a", "id-b")
+				}
+				mr := mapreduce.New(fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+
+				results, err := mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithCapacity(mapreduce.StaticCapacity(map[string]float64{
+					"id-a": 3,
+				})))
+				Expect(t, err == nil).To(BeTrue())
+
+				counts := make(map[string]int)
+				for _, nodeID := range results {
+					counts[string(nodeID)]++
+				}
+				Expect(t, counts).To(Equal(map[string]int{
+					"id-a": 6,
+					"id-b": 2,
+				}))
+			})
+		})
+
+		o.Group("when the work is uneven", func() {
+			o.Spec("it lets idle nodes steal unstarted files", func(t TMR) {
+				fs := localityFileSystem{
+					InMemory: fsfakes.NewInMemory(),
+					nodes:    make(map[string][]string),
+				}
+				for i := 0; i < 6; i++ {
+					file := fmt.Sprintf("some-file-%d", i)
+					fs.SetNodes(file, "id-a", "id-b")
+					fs.nodes[file] = []string{"id-a"}
+				}
+				mr := mapreduce.New(fs, slowNetwork{slow: "id-a", delay: 50 * time.Millisecond}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+
+				results, err := mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithWorkStealing(1))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(HaveLen(6))
+
+				counts := make(map[string]int)
+				for _, nodeID := range results {
+					counts[string(nodeID)]++
+				}
+				Expect(t, counts["id-b"] >= 4).To(BeTrue())
+			})
+		})
+
+		o.Group("when the results are cross-checked", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				t.mr = mapreduce.New(t.fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+				return t
+			})
+
+			o.Spec("it flags the files whose results diverge", func(t TMR) {
+				job, err := t.mr.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithCrossCheck())
+				Expect(t, err == nil).To(BeTrue())
+
+				results, err := job.Wait()
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(HaveLen(2))
+				Expect(t, job.Divergences()).To(HaveLen(2))
+				Expect(t, job.Divergences()[0].Nodes).To(HaveLen(2))
+				Expect(t, job.Counters()[mapreduce.DivergedFilesCounter]).To(Equal(int64(2)))
+			})
+
+			o.Spec("it does not flag matching results", func(t TMR) {
+				mr := mapreduce.New(t.fs, echoNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+				job, err := mr.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithCrossCheck())
+				Expect(t, err == nil).To(BeTrue())
+
+				_, err = job.Wait()
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, job.Divergences()).To(HaveLen(0))
+			})
+
+			o.Spec("it does not count the replica in the counters", func(t TMR) {
+				fs := fsfakes.NewInMemory()
+				fs.Write("some-file", []byte("x"), []byte("y"))
+				fs.SetNodes("some-file", "id-a", "id-b")
+
+				algs := mapreduce.AlgFetcherMap{
+					"some-alg": {
+						Mapper: mapreduce.MapContextFunc(func(ctx context.Context, value []byte) (string, []byte, error) {
+							mapreduce.IncCounter(ctx, "mapped")
+							mapreduce.AccumulateSum(ctx, "mapped", 1)
+							return string(value), value, nil
+						}),
+						Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+							return values[:1], nil
+						}),
+					},
+				}
+				counters := func(opts ...mapreduce.MapReduceOption) (map[string]int64, int64) {
+					network := &executorNetwork{e: mapreduce.NewExecutor(algs, fs)}
+					job, err := mapreduce.New(fs, network, algs).Submit("some-file", "some-alg", context.Background(), nil, opts...)
+					Expect(t, err == nil).To(BeTrue())
+
+					_, err = job.Wait()
+					Expect(t, err == nil).To(BeTrue())
+					return job.Counters(), job.Accumulators().Sum("mapped")
+				}
+
+				checked, checkedSum := counters(mapreduce.WithCrossCheck())
+				unchecked, uncheckedSum := counters()
+				Expect(t, checked).To(Equal(unchecked))
+				Expect(t, checkedSum).To(Equal(uncheckedSum))
+			})
+		})
+
+		o.Spec("it applies the options of concurrent calculations to each call", func(t TMR) {
+			mr := mapreduce.New(t.fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+				"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				})},
+			}, mapreduce.WithParallelism(1))
+
+			calls := []struct {
+				opts     []mapreduce.MapReduceOption
+				expected mapreduce.Results
+			}{
+				{
+					opts: []mapreduce.MapReduceOption{mapreduce.WithNodes("id-b"), mapreduce.WithSideInput("some-input", []byte("b"))},
+					expected: mapreduce.Results{
+						"some-file-a": []byte("id-b"),
+						"some-file-b": []byte("id-b"),
+					},
+				},
+				{
+					opts: []mapreduce.MapReduceOption{mapreduce.WithNodes("id-a", "id-c"), mapreduce.WithParallelism(2), mapreduce.WithTimeout(time.Minute)},
+					expected: mapreduce.Results{
+						"some-file-a": []byte("id-a"),
+						"some-file-b": []byte("id-c"),
+					},
+				},
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				for _, call := range calls {
+					wg.Add(1)
+					go func(opts []mapreduce.MapReduceOption, expected mapreduce.Results) {
+						defer wg.Done()
+						results, err := mr.Calculate("some-file", "some-alg", context.Background(), nil, opts...)
+						Expect(t, err == nil).To(BeTrue())
+						Expect(t, results).To(Equal(expected))
+					}(call.opts, call.expected)
+				}
+			}
+			wg.Wait()
+		})
+
+		o.Spec("it counts the records of each key", func(t TMR) {
+			fs := fsfakes.NewInMemory()
+			fs.Write("some-file-a", []byte("x"), []byte("y"), []byte("x"))
+			fs.Write("some-file-b", []byte("x"))
+			fs.SetNodes("some-file-a", "id-a")
+			fs.SetNodes("some-file-b", "id-b")
+
+			algs := mapreduce.AlgFetcherMap{
+				"some-alg": {
+					Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+						return string(value), value, nil
+					}),
+					Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					}),
+				},
+			}
+			network := &executorNetwork{e: mapreduce.NewExecutor(algs, fs)}
+			job, err := mapreduce.New(fs, network, algs).Submit("some-file", "some-alg", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			job.Wait()
+
+			meta, ok := job.Meta("x")
+			Expect(t, ok).To(BeTrue())
+			Expect(t, meta.Records).To(Equal(int64(3)))
+
+			meta, _ = job.Meta("y")
+			Expect(t, meta.Records).To(Equal(int64(1)))
+		})
+
+		o.Spec("it rejects an incomplete algorithm before dispatching it", func(t TMR) {
+			network := &countingNetwork{}
+			_, err := mapreduce.New(t.fs, network, mapreduce.AlgFetcherMap{
+				"some-alg": {Mapper: newMockMapper()},
+			}).Submit("some-file", "some-alg", context.Background(), nil)
+			Expect(t, err == nil).To(BeFalse())
+			Expect(t, network.files).To(HaveLen(0))
+		})
+
+		o.Group("when the results are cached", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				t.fs.Write("some-file-a", []byte("x"))
+				return t
+			})
+
+			calculate := func(t TMR, network *countingNetwork, opts ...mapreduce.MapReduceOption) {
+				_, err := mapreduce.New(t.fs, network, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				}).Calculate("some-file", "some-alg", context.Background(), nil, opts...)
+				Expect(t, err == nil).To(BeTrue())
+			}
+
+			o.Spec("it calculates again with different options", func(t TMR) {
+				cache := mapreduce.WithCache(mapreduce.NewMemoryCache(time.Minute))
+				network := &countingNetwork{}
+				calculate(t, network, cache)
+				calculate(t, network, cache)
+				Expect(t, network.files).To(HaveLen(2))
+
+				calculate(t, network, cache, mapreduce.WithSideInput("some-input", []byte("x")))
+				Expect(t, network.files).To(HaveLen(4))
+
+				calculate(t, network, cache, mapreduce.WithNodes("id-b"))
+				Expect(t, network.files).To(HaveLen(6))
+			})
+
+			o.Spec("it calculates again once a file changed", func(t TMR) {
+				cache := mapreduce.WithCache(mapreduce.NewMemoryCache(time.Minute))
+				network := &countingNetwork{}
+				calculate(t, network, cache)
+
+				t.fs.Write("some-file-a", []byte("x"), []byte("y"))
+				calculate(t, network, cache)
+				Expect(t, network.files).To(HaveLen(4))
+			})
+
+			o.Spec("it calculates again with a different reduce limit", func(t TMR) {
+				cache := mapreduce.WithCache(mapreduce.NewMemoryCache(time.Minute))
+				network := &countingNetwork{}
+				calculate(t, network, cache)
+				calculate(t, network, cache, mapreduce.WithMaxReduceIterations(5))
+				Expect(t, network.files).To(HaveLen(4))
+			})
+
+			o.Spec("it does not cache a calculation with a convergence predicate", func(t TMR) {
+				cache := mapreduce.WithCache(mapreduce.NewMemoryCache(time.Minute))
+				converged := mapreduce.WithConvergence(func(values [][]byte) bool {
+					return len(values) <= 1
+				})
+				network := &countingNetwork{}
+				calculate(t, network, cache, converged)
+				calculate(t, network, cache, converged)
+				Expect(t, network.files).To(HaveLen(4))
+			})
+
+			o.Spec("it stores cached results in the output file", func(t TMR) {
+				cache := mapreduce.WithCache(mapreduce.NewMemoryCache(time.Minute))
+				network := &countingNetwork{}
+				calculate(t, network, cache)
+				calculate(t, network, cache, mapreduce.WithOutputFile("some-output"))
+				Expect(t, network.files).To(HaveLen(2))
+
+				_, err := mapreduce.New(t.fs, network, nil).Load("some-output", context.Background(), nil)
+				Expect(t, err == nil).To(BeTrue())
+			})
+		})
+
+		o.Group("when partial results are allowed", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				t.mr = mapreduce.New(t.fs, failingNetwork{file: "some-file-b"}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+				return t
+			})
+
+			o.Spec("it returns the results of the files that succeeded", func(t TMR) {
+				results, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithPartialResults(0.5))
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("some-file-a"),
+				}))
+
+				partialErr, ok := err.(*mapreduce.PartialResultsError)
+				Expect(t, ok).To(BeTrue())
+				Expect(t, partialErr.Total).To(Equal(2))
+				Expect(t, partialErr.Missing).To(HaveLen(1))
+				Expect(t, partialErr.Missing[0].File).To(Equal("some-file-b"))
+			})
+
+			o.Spec("it fails when too many files failed", func(t TMR) {
+				results, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithPartialResults(0.75))
+				Expect(t, results == nil).To(BeTrue())
+
+				_, ok := err.(*mapreduce.PartialResultsError)
+				Expect(t, ok).To(BeTrue())
+			})
+
+			o.Spec("it fails on any failed file by default", func(t TMR) {
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
+				Expect(t, err == nil).To(BeFalse())
+
+				_, ok := err.(*mapreduce.PartialResultsError)
+				Expect(t, ok).To(BeFalse())
+			})
+		})
+
+		o.Group("when checkpoints are written", func() {
+			o.Spec("it resumes the calculation with the remaining files", func(t TMR) {
+				algs := mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				}
+				checkpoints := mapreduce.WithCheckpoints("checkpoints", time.Millisecond)
+
+				mr := mapreduce.New(t.fs, stragglerNetwork{straggler: "id-c"}, algs, checkpoints, mapreduce.WithRoles(map[string]mapreduce.Role{
+					"id-b": mapreduce.ReduceOnly,
+				}))
+				job, err := mr.Submit("some-file", "some-alg", context.Background(), nil)
+				Expect(t, err == nil).To(BeTrue())
+
+				Expect(t, func() bool {
+					records, ok := t.fs.Records("checkpoints/" + job.ID())
+					return ok && strings.Contains(string(records[0]), "some-file-a")
+				}).To(ViaPolling(BeTrue()))
+				job.Cancel()
+				job.Wait()
+
+				network := &countingNetwork{}
+				mr = mapreduce.New(t.fs, network, algs, checkpoints)
+				job, err = mr.Resume(job.ID(), context.Background())
+				Expect(t, err == nil).To(BeTrue())
+
+				results, err := job.Wait()
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("id-a"),
+					"some-file-b": []byte("some-file-b"),
+				}))
+				Expect(t, network.files).To(Equal([]string{"some-file-b"}))
+			})
+
+			o.Spec("it resumes with the files and options of the checkpoint", func(t TMR) {
+				t.fs.Write("some-file/dt=2/c", []byte("some-data"))
+				t.fs.SetNodes("some-file/dt=2/c", "id-a")
+				algs := mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				}
+				checkpoints := mapreduce.WithCheckpoints("checkpoints", time.Millisecond)
+
+				mr := mapreduce.New(t.fs, stragglerNetwork{straggler: "id-c"}, algs, checkpoints, mapreduce.WithRoles(map[string]mapreduce.Role{
+					"id-b": mapreduce.ReduceOnly,
+				}))
+				job, err := mr.Submit("some-file", "some-alg", context.Background(), nil,
+					mapreduce.WithSideInput("some-input", []byte("some-value")),
+					mapreduce.WithPartitionFilter(func(partitions map[string]string) bool {
+						return partitions["dt"] == ""
+					}),
+				)
+				Expect(t, err == nil).To(BeTrue())
+
+				Expect(t, func() bool {
+					records, ok := t.fs.Records("checkpoints/" + job.ID())
+					return ok && strings.Contains(string(records[0]), "some-file-a")
+				}).To(ViaPolling(BeTrue()))
+				job.Cancel()
+				job.Wait()
+
+				network := &countingNetwork{}
+				mr = mapreduce.New(t.fs, network, algs, checkpoints)
+				job, err = mr.Resume(job.ID(), context.Background())
+				Expect(t, err == nil).To(BeTrue())
+
+				_, err = job.Wait()
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, network.files).To(Equal([]string{"some-file-b"}))
+				Expect(t, network.sideInputs).To(Equal([]map[string][]byte{
+					{"some-input": []byte("some-value")},
+				}))
+			})
+
+			o.Spec("it returns an error for an unknown job", func(t TMR) {
+				_, err := t.mr.Resume("unknown", context.Background(), mapreduce.WithCheckpoints("checkpoints", time.Second))
+				Expect(t, err == nil).To(BeFalse())
+			})
+		})
+
+		o.Group("when the zones of the nodes are known", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				t.mr = mapreduce.New(t.fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+				return t
+			})
+
+			zones := mapreduce.StaticZones(map[string]string{
+				"id-a": "region-a/zone-a",
+				"id-b": "region-a/zone-b",
+				"id-c": "region-b/zone-a",
+			})
+
+			o.Spec("it prefers the nodes in the zone of the coordinator", func(t TMR) {
+				job, err := t.mr.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithZones(zones, "region-a/zone-b"))
+				Expect(t, err == nil).To(BeTrue())
+
+				results, err := job.Wait()
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("id-b"),
+					"some-file-b": []byte("id-b"),
+				}))
+				Expect(t, job.Counters()).To(Equal(map[string]int64{
+					mapreduce.TransferBytesCounter("region-a/zone-b"): 30,
+				}))
+			})
+
+			o.Spec("it prefers the nodes in the region of the coordinator", func(t TMR) {
+				results, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithZones(zones, "region-b/zone-b"))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results["some-file-b"]).To(Equal([]byte("id-c")))
+			})
+
+			o.Spec("it fails once too many bytes crossed regions", func(t TMR) {
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithZones(zones, "region-b/zone-a"), mapreduce.WithCrossRegionLimit(1))
+
+				limitErr, ok := err.(*mapreduce.CrossRegionLimitError)
+				Expect(t, ok).To(BeTrue())
+				Expect(t, limitErr.Transferred).To(Equal(int64(15)))
+			})
+		})
+
+		o.Group("when the nodes have labels", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				t.mr = mapreduce.New(t.fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				}, mapreduce.WithLabels(mapreduce.StaticLabels(map[string][]string{
+					"id-a": {"ssd"},
+					"id-b": {"ssd", "prod"},
+					"id-c": {"ssd"},
+				})))
+				return t
+			})
+
+			o.Spec("it only assigns the files to nodes with the required labels", func(t TMR) {
+				results, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithAffinity("ssd", "prod"))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("id-b"),
+					"some-file-b": []byte("id-b"),
+				}))
+			})
+
+			o.Spec("it does not assign the files to nodes with the avoided labels", func(t TMR) {
+				results, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithAntiAffinity("prod"))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("id-a"),
+					"some-file-b": []byte("id-c"),
+				}))
+			})
+
+			o.Spec("it returns an error if no node matches", func(t TMR) {
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithAffinity("gpu"))
+				Expect(t, err == nil).To(BeFalse())
+			})
+		})
+
+		o.Group("when the calculations share a NodePool", func() {
+			o.Spec("it preempts the files of a lower priority", func(t TMR) {
+				fs := fsfakes.NewInMemory()
+				fs.SetNodes("some-file", "id-a")
+				algs := mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				}
+				pool := mapreduce.WithNodePool(mapreduce.NewNodePool(1, time.Minute))
+
+				network := &blockingNetwork{release: make(chan struct{})}
+				low, err := mapreduce.New(fs, network, algs, pool).Submit("some-file", "some-alg", context.Background(), nil)
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, func() int64 { return atomic.LoadInt64(&network.calls) }).To(ViaPolling(Equal(int64(1))))
+
+				results, err := mapreduce.New(fs, echoNetwork{}, algs, pool).Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithPriority(1))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(HaveLen(1))
+
+				Expect(t, func() int64 { return atomic.LoadInt64(&network.calls) }).To(ViaPolling(Equal(int64(2))))
+				close(network.release)
+
+				_, err = low.Wait()
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, low.Counters()[mapreduce.PreemptedFilesCounter]).To(Equal(int64(1)))
+			})
+
+			o.Spec("it does not preempt the files of the same priority", func(t TMR) {
+				fs := fsfakes.NewInMemory()
+				fs.SetNodes("some-file", "id-a")
+				algs := mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				}
+				pool := mapreduce.WithNodePool(mapreduce.NewNodePool(1, 0))
+
+				network := &blockingNetwork{release: make(chan struct{})}
+				defer close(network.release)
+				_, err := mapreduce.New(fs, network, algs, pool).Submit("some-file", "some-alg", context.Background(), nil)
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, func() int64 { return atomic.LoadInt64(&network.calls) }).To(ViaPolling(Equal(int64(1))))
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				_, err = mapreduce.New(fs, echoNetwork{}, algs, pool).Calculate("some-file", "some-alg", ctx, nil)
+				Expect(t, err == context.DeadlineExceeded).To(BeTrue())
+			})
+		})
+
+		o.Group("when the nodes have roles", func() {
+			o.Spec("it does not map files on the nodes that only reduce", func(t TMR) {
+				mr := mapreduce.New(t.fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+
+				results, err := mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithRoles(map[string]mapreduce.Role{
+					"id-b": mapreduce.ReduceOnly,
+				}))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(Equal(mapreduce.Results{
+					"some-file-a": []byte("id-a"),
+					"some-file-b": []byte("id-c"),
+				}))
+			})
+		})
+
+		o.Group("when fewer nodes are available than required", func() {
+			o.Spec("it returns a NotEnoughNodesError", func(t TMR) {
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithMinNodes(4))
+				notEnough, ok := err.(*mapreduce.NotEnoughNodesError)
+				Expect(t, ok).To(BeTrue())
+				Expect(t, notEnough.Min).To(Equal(4))
+				Expect(t, notEnough.Available).To(Equal(3))
+			})
+
+			o.Spec("it does not count the blacklisted nodes", func(t TMR) {
+				blacklist := mapreduce.NewBlacklist(1, time.Minute)
+				blacklist.Failed("id-a")
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithMinNodes(3), mapreduce.WithBlacklist(blacklist))
+				_, ok := err.(*mapreduce.NotEnoughNodesError)
+				Expect(t, ok).To(BeTrue())
+			})
+
+			o.Spec("it waits for the nodes", func(t TMR) {
+				var calls int32
+				discovery := mapreduce.DiscoveryFunc(func(ctx context.Context) ([]string, error) {
+					if atomic.AddInt32(&calls, 1) < 3 {
+						return []string{"id-b"}, nil
+					}
+					return []string{"id-a", "id-b", "id-c"}, nil
+				})
+				mr := mapreduce.New(t.fs, stragglerNetwork{}, mapreduce.AlgFetcherMap{
+					"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+						return values[:1], nil
+					})},
+				})
+
+				results, err := mr.Calculate("some-file", "some-alg", context.Background(), nil,
+					mapreduce.WithDiscovery(discovery),
+					mapreduce.WithMinNodes(2),
+					mapreduce.WithMinNodesWait(time.Millisecond),
+				)
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, results).To(HaveLen(2))
+				Expect(t, atomic.LoadInt32(&calls)).To(Equal(int32(3)))
+			})
+
+			o.Spec("it stops waiting once the context is done", func(t TMR) {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				_, err := t.mr.Calculate("some-file", "some-alg", ctx, nil, mapreduce.WithMinNodes(4), mapreduce.WithMinNodesWait(time.Millisecond))
+				_, ok := err.(*mapreduce.NotEnoughNodesError)
+				Expect(t, ok).To(BeTrue())
+			})
+		})
+
+		o.Group("when a node fails", func() {
+			o.BeforeEach(func(t TMR) TMR {
+				t.mockNetwork.ExecuteOutput.Err <- &mapreduce.NodeError{NodeID: "some-id", Err: fmt.Errorf("some-error")}
+				t.mockNetwork.ExecuteOutput.Result <- nil
+				close(t.mockNetwork.ExecuteOutput.Err)
+				testhelpers.AlwaysReturn(t.mockNetwork.ExecuteOutput.Result, map[string][]byte{
+					"some-key": []byte("some-value"),
+				})
+				t.mockAlgorithm.ReduceOutput.Err <- nil
+				t.mockAlgorithm.ReduceOutput.Reduced <- [][]byte{[]byte("some-value")}
+				return t
+			})
+
+			o.Spec("it reports the failed node to the blacklist", func(t TMR) {
+				blacklist := mapreduce.NewBlacklist(1, time.Minute)
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithBlacklist(blacklist))
+				Expect(t, err == nil).To(BeTrue())
+				Expect(t, blacklist.Nodes()).To(HaveLen(1))
+			})
+
+			o.Spec("it re-dispatches the file to another node", func(t TMR) {
+				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithParallelism(1))
+				Expect(t, err == nil).To(BeTrue())
+
+				files := toSlice(t.mockNetwork.ExecuteInput.File, 3)
+				nodeIDs := toSlice(t.mockNetwork.ExecuteInput.NodeID, 3)
+				Expect(t, files[0]).To(Equal(files[1]))
+				Expect(t, nodeIDs[0]).To(Not(Equal(nodeIDs[1])))
+				Expect(t, files[2]).To(Not(Equal(files[0])))
+			})
+		})
+
+		o.Group("when the Mapper fails on the node", func() {
+			o.Spec("it does not re-dispatch the file", func(t TMR) {
+				fs := fsfakes.NewInMemory()
+				fs.Write("some-file", []byte("x"))
+				fs.SetNodes("some-file", "id-a", "id-b", "id-c")
+
+				algs := mapreduce.AlgFetcherMap{
+					"some-alg": {
+						Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+							return "", nil, errors.New("some-error")
+						}),
+						Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+							return values[:1], nil
+						}),
+					},
+				}
+				network := &executorNetwork{e: mapreduce.NewExecutor(algs, fs)}
+				blacklist := mapreduce.NewBlacklist(1, time.Minute)
+
+				_, err := mapreduce.New(fs, network, algs).Calculate("some-file", "some-alg", context.Background(), nil, mapreduce.WithBlacklist(blacklist))
+				Expect(t, err == nil).To(BeFalse())
+				Expect(t, network.nodes).To(HaveLen(1))
+				Expect(t, blacklist.Nodes()).To(HaveLen(0))
+			})
 		})
 
 		o.Group("when the Network returns an error", func() {
@@ -214,8 +1377,18 @@ func TestMapReduce(t *testing.T) {
 				return t
 			})
 
-			// TODO: We should retry with different nodes
-			o.Spec("it returns an error", func(t TMR) {
+			o.Spec("it streams the error", func(t TMR) {
+				stream, _ := t.mr.CalculateStream("some-file", "some-alg", context.Background(), nil)
+
+				var results []mapreduce.KeyedResult
+				for result := range stream {
+					results = append(results, result)
+				}
+				Expect(t, results).To(HaveLen(1))
+				Expect(t, results[0].Err == nil).To(BeFalse())
+			})
+
+			o.Spec("it returns an error when every node fails", func(t TMR) {
 				_, err := t.mr.Calculate("some-file", "some-alg", context.Background(), nil)
 				Expect(t, err == nil).To(BeFalse())
 			})
@@ -224,8 +1397,10 @@ func TestMapReduce(t *testing.T) {
 
 	o.Group("when the FileSystem returns an error", func() {
 		o.BeforeEach(func(t TMR) TMR {
-			t.mockFileSystem.FilesOutput.Err <- fmt.Errorf("some-error")
-			close(t.mockFileSystem.FilesOutput.Files)
+			mockFileSystem := newMockFileSystem()
+			mockFileSystem.FilesOutput.Err <- fmt.Errorf("some-error")
+			close(mockFileSystem.FilesOutput.Files)
+			t.mr = mapreduce.New(mockFileSystem, t.mockNetwork, t.mockAlgFetcher)
 			return t
 		})
 
@@ -237,6 +1412,161 @@ func TestMapReduce(t *testing.T) {
 
 }
 
+// stragglerNetwork returns the node ID for each file. The straggler does not
+// return until the calculation is canceled.
+type stragglerNetwork struct {
+	straggler string
+}
+
+func (n stragglerNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	if nodeID == n.straggler {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return map[string][]byte{file: []byte(nodeID)}, nil
+}
+
+// executorNetwork runs every node's calculation on the same Executor and
+// records the nodes.
+type executorNetwork struct {
+	e *mapreduce.Executor
+
+	mu    sync.Mutex
+	nodes []string
+}
+
+func (n *executorNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	n.mu.Lock()
+	n.nodes = append(n.nodes, nodeID)
+	n.mu.Unlock()
+	return n.e.Execute(file, algName, ctx, meta)
+}
+
+// blockingNetwork returns the file name for each file once it is released.
+type blockingNetwork struct {
+	calls   int64
+	release chan struct{}
+}
+
+func (n *blockingNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	atomic.AddInt64(&n.calls, 1)
+	select {
+	case <-n.release:
+		return map[string][]byte{file: []byte(file)}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// echoNetwork returns the file name for each file, regardless of the node.
+type echoNetwork struct{}
+
+func (echoNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	return map[string][]byte{file: []byte(file)}, nil
+}
+
+// failingNetwork returns the file name for each file, except for the failing
+// file which fails on every node.
+type failingNetwork struct {
+	file string
+}
+
+func (n failingNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	if file == n.file {
+		return nil, errors.New("some-error")
+	}
+	return map[string][]byte{file: []byte(file)}, nil
+}
+
+// countingNetwork returns the file name for each file and records the
+// calculated files.
+type countingNetwork struct {
+	mu         sync.Mutex
+	files      []string
+	sideInputs []map[string][]byte
+}
+
+func (n *countingNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.files = append(n.files, file)
+	n.sideInputs = append(n.sideInputs, mapreduce.SideInputs(ctx))
+	return map[string][]byte{file: []byte(file)}, nil
+}
+
+// slowNetwork returns the node ID for each file. The slow node takes the
+// delay for each file.
+type slowNetwork struct {
+	slow  string
+	delay time.Duration
+}
+
+func (n slowNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	if nodeID == n.slow {
+		time.Sleep(n.delay)
+	}
+	return map[string][]byte{file: []byte(nodeID)}, nil
+}
+
+// streamingNetwork streams the node ID for each file in two batches, the
+// first of which is keyed by the node as well. The failing node fails after
+// its first batch, and the straggler waits for the context after it.
+type streamingNetwork struct {
+	failing   string
+	straggler string
+}
+
+func (n streamingNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	err := n.ExecuteStream(file, algName, nodeID, ctx, meta, func(batch map[string][]byte) {
+		for key, value := range batch {
+			result[key] = value
+		}
+	})
+	return result, err
+}
+
+func (n streamingNetwork) ExecuteStream(file, algName, nodeID string, ctx context.Context, meta []byte, emit func(result map[string][]byte)) error {
+	emit(map[string][]byte{file + "-" + nodeID: []byte(nodeID)})
+
+	switch nodeID {
+	case n.failing:
+		return &mapreduce.NodeError{NodeID: nodeID, Err: fmt.Errorf("some-error")}
+	case n.straggler:
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	emit(map[string][]byte{file + "-second": []byte(nodeID)})
+	return nil
+}
+
+type localityFileSystem struct {
+	*fsfakes.InMemory
+	nodes map[string][]string
+}
+
+func (fs localityFileSystem) NodesFor(file string, start, end uint64) []string {
+	return fs.nodes[file]
+}
+
+// rangeFileSystem returns a single record that names the range for each
+// split.
+type rangeFileSystem struct {
+	*fsfakes.InMemory
+}
+
+func (fs rangeFileSystem) RangeReader(file string, start, end uint64, ctx context.Context, meta []byte) (func() ([]byte, error), error) {
+	records := [][]byte{[]byte(fmt.Sprintf("%s:%d-%d", file, start, end))}
+	return func() ([]byte, error) {
+		if len(records) == 0 {
+			return nil, io.EOF
+		}
+		defer func() { records = records[1:] }()
+		return records[0], nil
+	}, nil
+}
+
 func toSlice(c <-chan string, count int) (result []string) {
 	for i := 0; i < count; i++ {
 		select {
@@ -1,5 +1,7 @@
 package mapreduce
 
+import "golang.org/x/net/context"
+
 // Mapper maps data ([]byte) to key (string).
 type Mapper interface {
 	// Map maps data to keys. It filters out the value if the
@@ -15,3 +17,50 @@ type MapFunc func(value []byte) (key string, output []byte, err error)
 func (f MapFunc) Map(value []byte) (key string, output []byte, err error) {
 	return f(value)
 }
+
+// ContextMapper is a Mapper that also has access to the calculation's
+// context (e.g., to read side inputs via SideInput()). The Executor invokes
+// MapContext instead of Map when it is available.
+type ContextMapper interface {
+	Mapper
+
+	// MapContext behaves like Map.
+	MapContext(ctx context.Context, value []byte) (key string, output []byte, err error)
+}
+
+// MapContextFunc wraps a function into a ContextMapper.
+type MapContextFunc func(ctx context.Context, value []byte) (key string, output []byte, err error)
+
+// Map implements the Mapper interface. It uses an empty context.
+func (f MapContextFunc) Map(value []byte) (key string, output []byte, err error) {
+	return f(context.Background(), value)
+}
+
+// MapContext implements the ContextMapper interface.
+func (f MapContextFunc) MapContext(ctx context.Context, value []byte) (key string, output []byte, err error) {
+	return f(ctx, value)
+}
+
+// ChainMappers returns a Mapper that runs the given Mappers one after
+// another, each given the output of the previous one. It is used to share
+// common steps (e.g., parsing and cleaning) between algorithms. A value is
+// filtered out as soon as one of the Mappers returns an empty key, otherwise
+// the key of the last Mapper is used.
+func ChainMappers(mappers ...Mapper) Mapper {
+	return MapContextFunc(func(ctx context.Context, value []byte) (key string, output []byte, err error) {
+		output = value
+		for _, m := range mappers {
+			if contextMapper, ok := m.(ContextMapper); ok {
+				key, output, err = contextMapper.MapContext(ctx, output)
+			} else {
+				key, output, err = m.Map(output)
+			}
+
+			if err != nil || len(key) == 0 {
+				return "", nil, err
+			}
+		}
+
+		return key, output, nil
+	})
+}
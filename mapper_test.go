@@ -0,0 +1,93 @@
+package mapreduce_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type TM struct {
+	*testing.T
+	m mapreduce.Mapper
+}
+
+func TestChainMappers(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TM {
+		clean := mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+			if len(value) == 0 {
+				return "", nil, nil
+			}
+			return "clean", bytes.TrimSpace(value), nil
+		})
+
+		upper := mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+			if string(value) == "bad" {
+				return "", nil, fmt.Errorf("some-error")
+			}
+			return string(value), bytes.ToUpper(value), nil
+		})
+
+		return TM{
+			T: t,
+			m: mapreduce.ChainMappers(clean, upper),
+		}
+	})
+
+	o.Spec("it gives each mapper the output of the previous one", func(t TM) {
+		key, output, err := t.m.Map([]byte(" value "))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, key).To(Equal("value"))
+		Expect(t, output).To(Equal([]byte("VALUE")))
+	})
+
+	o.Spec("it filters out values that any mapper filters out", func(t TM) {
+		key, _, err := t.m.Map(nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, key).To(HaveLen(0))
+	})
+
+	o.Spec("it returns an error from any mapper", func(t TM) {
+		_, _, err := t.m.Map([]byte("bad"))
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+func TestProtoMapper(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TM {
+		return TM{
+			T: t,
+			m: mapreduce.ProtoMapper(&wrapperspb.StringValue{}, func(message proto.Message) (string, []byte, error) {
+				value := message.(*wrapperspb.StringValue).GetValue()
+				return value, []byte(value), nil
+			}),
+		}
+	})
+
+	o.Spec("it hands each record to the function as a message", func(t TM) {
+		data, _ := proto.Marshal(wrapperspb.String("some-value"))
+		key, output, err := t.m.Map(data)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, key).To(Equal("some-value"))
+		Expect(t, output).To(Equal([]byte("some-value")))
+	})
+
+	o.Spec("it returns an error for a record that is not a message", func(t TM) {
+		_, _, err := t.m.Map([]byte{0xff})
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
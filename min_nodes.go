@@ -0,0 +1,88 @@
+package mapreduce
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// WithMinNodes fails a calculation with a NotEnoughNodesError if fewer than n
+// healthy nodes have its files when it is started, instead of running the
+// whole calculation on whatever nodes happen to be up. A node is healthy if
+// it is eligible (see WithNodes and WithDiscovery) and not excluded by the
+// Blacklist.
+func WithMinNodes(n int) MapReduceOption {
+	return func(r *MapReduce) {
+		r.minNodes = n
+	}
+}
+
+// WithMinNodesWait waits for the nodes required by WithMinNodes instead of
+// failing right away. The files and nodes are looked up again every interval
+// until there are enough of them or the context is done.
+func WithMinNodesWait(interval time.Duration) MapReduceOption {
+	return func(r *MapReduce) {
+		r.minNodesWait = interval
+	}
+}
+
+// NotEnoughNodesError is returned when fewer nodes are available than
+// required (see WithMinNodes).
+type NotEnoughNodesError struct {
+	Min       int
+	Available int
+}
+
+// Error implements error.
+func (e *NotEnoughNodesError) Error() string {
+	return fmt.Sprintf("%d healthy nodes are available, %d are required", e.Available, e.Min)
+}
+
+// awaitNodes returns the files of the routes and the discovered nodes once
+// there are enough healthy nodes.
+func (r MapReduce) awaitNodes(routes []string, ctx context.Context, meta []byte) (map[string][]string, map[string]bool, error) {
+	for {
+		files, err := r.files(routes, ctx, meta)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		discovered, err := r.discover(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		healthy := r.healthyNodes(files, discovered)
+		if healthy >= r.minNodes {
+			return files, discovered, nil
+		}
+
+		notEnough := &NotEnoughNodesError{Min: r.minNodes, Available: healthy}
+		if r.minNodesWait <= 0 {
+			return nil, nil, notEnough
+		}
+
+		r.log.Printf("Waiting for nodes: %d of %d are available", healthy, r.minNodes)
+		select {
+		case <-time.After(r.minNodesWait):
+		case <-ctx.Done():
+			return nil, nil, notEnough
+		}
+	}
+}
+
+// healthyNodes returns the number of healthy nodes that have any of the
+// files.
+func (r MapReduce) healthyNodes(files map[string][]string, discovered map[string]bool) int {
+	healthy := make(map[string]bool)
+	for _, ids := range files {
+		for _, id := range r.eligibleNodes(ids, discovered) {
+			if r.blacklist != nil && r.blacklist.Excluded(id) {
+				continue
+			}
+			healthy[id] = true
+		}
+	}
+	return len(healthy)
+}
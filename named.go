@@ -0,0 +1,101 @@
+package mapreduce
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// StageNamer is implemented by Mappers and Reducers that have a
+// human-readable name. The name is used in errors and is given to
+// Interceptors instead of MapStage or ReduceStage.
+type StageNamer interface {
+	StageName() string
+}
+
+// NamedMapper gives the Mapper a human-readable name (e.g., "extract-host").
+// Errors returned from the Mapper are prefixed with the name.
+func NamedMapper(name string, m Mapper) Mapper {
+	return namedMapper{
+		name:   name,
+		mapper: m,
+	}
+}
+
+// NamedReducer gives the Reducer a human-readable name. Errors returned from
+// the Reducer are prefixed with the name.
+func NamedReducer(name string, r Reducer) Reducer {
+	return namedReducer{
+		name:    name,
+		reducer: r,
+	}
+}
+
+// stageName returns the name of the Mapper or Reducer if it has one and the
+// given default otherwise.
+func stageName(stage interface{}, def string) string {
+	if namer, ok := stage.(StageNamer); ok {
+		return namer.StageName()
+	}
+	return def
+}
+
+type namedMapper struct {
+	name   string
+	mapper Mapper
+}
+
+func (m namedMapper) StageName() string {
+	return m.name
+}
+
+func (m namedMapper) RecordFilter() (RecordFilter, bool) {
+	return recordFilter(m.mapper)
+}
+
+func (m namedMapper) Map(value []byte) (key string, output []byte, err error) {
+	return m.MapContext(context.Background(), value)
+}
+
+func (m namedMapper) MapContext(ctx context.Context, value []byte) (key string, output []byte, err error) {
+	if contextMapper, ok := m.mapper.(ContextMapper); ok {
+		key, output, err = contextMapper.MapContext(ctx, value)
+	} else {
+		key, output, err = m.mapper.Map(value)
+	}
+
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %s", m.name, err)
+	}
+	return key, output, nil
+}
+
+type namedReducer struct {
+	name    string
+	reducer Reducer
+}
+
+func (r namedReducer) StageName() string {
+	return r.name
+}
+
+func (r namedReducer) emitsOutputs() bool {
+	return emitsOutputs(r.reducer)
+}
+
+func (r namedReducer) Reduce(value [][]byte) (reduced [][]byte, err error) {
+	return r.ReduceOutputs(value, func(string, []byte) {})
+}
+
+func (r namedReducer) ReduceOutputs(value [][]byte, emit Emit) (reduced [][]byte, err error) {
+	if outputReducer, ok := r.reducer.(OutputReducer); ok {
+		reduced, err = outputReducer.ReduceOutputs(value, emit)
+	} else {
+		reduced, err = r.reducer.Reduce(value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", r.name, err)
+	}
+	return reduced, nil
+}
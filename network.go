@@ -2,10 +2,32 @@ package mapreduce
 
 import "golang.org/x/net/context"
 
-// Network is used to execute commands on remote node.
+// Network is used to execute commands on remote node. It has to be safe for
+// concurrent use. The network/grpcnet package implements it over gRPC.
 type Network interface {
 	// Execute is invoked to run calculations for a file (file) on a remote node (nodeID) with the given algorithm
 	// (algName). Any necessary information can be encoded into meta. The context (ctx) is used for lifecycle
-	// management.
+	// management: its deadline and cancellation have to reach the remote node, so that the node abandons work the
+	// coordinator has already given up on. It also carries the side inputs (see SideInputs), the split of the file
+	// (see SplitFrom), the policy for bad records (see BadRecordPolicyFrom), the quarantine (see
+	// QuarantinePrefixFrom), the shuffle (see ShufflePlanFrom), the reduction (see ReducePlanFrom), the version of
+	// the algorithm (see AlgorithmVersionFrom) and the idempotency key (see IdempotencyKeyFrom), which have to be
+	// restored on the remote node before invoking the Executor.
 	Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (result map[string][]byte, err error)
 }
+
+// StreamNetwork is a Network that delivers the result of a file in batches
+// as the remote node sends them, instead of a single response. MapReduce
+// uses ExecuteStream instead of Execute if the Network implements it. Each
+// batch is merged into the calculation as soon as it arrives, and the
+// batches of an attempt that fails are taken out again. The remote node
+// should send each key as soon as it is reduced (see
+// Executor.ExecuteStream).
+type StreamNetwork interface {
+	Network
+
+	// ExecuteStream is like Execute, but it invokes emit for each batch of
+	// the result. It only returns once every batch was emitted. The batches
+	// of a call that returns an error are incomplete.
+	ExecuteStream(file, algName, nodeID string, ctx context.Context, meta []byte, emit func(result map[string][]byte)) error
+}
@@ -0,0 +1,79 @@
+package grpcnet
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Auth decides whether a coordinator may push work to the node. The token is
+// the one the coordinator's Network was configured with (see WithToken), or
+// empty. The context carries the peer (see peer.FromContext), e.g. to check
+// the certificate of a coordinator that connected via mutual TLS. A non-nil
+// error rejects the request.
+type Auth func(ctx context.Context, token string) error
+
+// WithAuth makes the Server check each request with the given Auth.
+func WithAuth(auth Auth) ServerOption {
+	return func(s *Server) {
+		s.auth = auth
+	}
+}
+
+// AllowTokens returns an Auth that only accepts the given tokens.
+func AllowTokens(tokens ...string) Auth {
+	allowed := make(map[string]bool)
+	for _, t := range tokens {
+		allowed[t] = true
+	}
+
+	return func(ctx context.Context, token string) error {
+		if !allowed[token] {
+			return fmt.Errorf("token is not allowed")
+		}
+		return nil
+	}
+}
+
+// WithToken sends the given token with each request, for the Auth of the
+// Servers to check. The token is only sent over encrypted connections (see
+// WithTLS).
+func WithToken(token string) Option {
+	return func(n *Network) {
+		n.token = token
+	}
+}
+
+// tokenCredentials implements credentials.PerRPCCredentials.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// authorize checks the request with the Auth of the Server.
+func (s *Server) authorize(ctx context.Context) error {
+	if s.auth == nil {
+		return nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+
+	if err := s.auth(ctx, token); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
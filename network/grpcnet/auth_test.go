@@ -0,0 +1,100 @@
+package grpcnet_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TT {
+		dir, err := ioutil.TempDir("", "grpcnet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeCerts(t, dir)
+
+		config, err := grpcnet.LoadTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.ClientAuth = tls.NoClientCert
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer(grpcnet.ServerTLS(config))
+		grpcnet.NewServer(mapreduce.NewExecutor(algs, fs), grpcnet.WithAuth(grpcnet.AllowTokens("some-token"))).Register(gs)
+		go gs.Serve(lis)
+
+		return TT{
+			T:      t,
+			dir:    dir,
+			addr:   lis.Addr().String(),
+			config: &tls.Config{RootCAs: config.RootCAs},
+			server: gs,
+		}
+	})
+
+	o.AfterEach(func(t TT) {
+		t.server.Stop()
+		os.RemoveAll(t.dir)
+	})
+
+	o.Spec("it accepts an allowed token", func(t TT) {
+		network := grpcnet.New(grpcnet.WithTLS(t.config), grpcnet.WithToken("some-token"))
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", t.addr, context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+	})
+
+	o.Spec("it rejects any other token", func(t TT) {
+		network := grpcnet.New(grpcnet.WithTLS(t.config), grpcnet.WithToken("other-token"))
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", t.addr, context.Background(), nil)
+		Expect(t, status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	o.Spec("it rejects a request without a token", func(t TT) {
+		network := grpcnet.New(grpcnet.WithTLS(t.config))
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", t.addr, context.Background(), nil)
+		Expect(t, status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+}
@@ -0,0 +1,123 @@
+package grpcnet
+
+import (
+	"net"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+)
+
+// WithBandwidth caps the bytes per second that are sent to and received from
+// each node (perNode) and all nodes together (global), so that a large
+// shuffle does not saturate links that are shared with other traffic. A
+// limit of zero leaves the bandwidth uncapped, which is the default.
+//
+// The limits apply to the connections of the Network. A node that shuffles
+// to the other nodes has to cap its own Network (see mapreduce.WithShuffler).
+func WithBandwidth(perNode, global int64) Option {
+	return func(n *Network) {
+		n.nodeBandwidth = perNode
+		if global > 0 {
+			n.globalLimiter = newLimiter(global)
+		}
+	}
+}
+
+// newLimiter returns a limiter for the given bytes per second. It allows
+// bursts of a tenth of a second.
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := int(bytesPerSecond / 10)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// limiters returns the limiters for the connections to the node.
+func (n *Network) limiters(nodeID string) []*rate.Limiter {
+	var limiters []*rate.Limiter
+	if n.nodeBandwidth > 0 {
+		l, ok := n.nodeLimiters[nodeID]
+		if !ok {
+			l = newLimiter(n.nodeBandwidth)
+			n.nodeLimiters[nodeID] = l
+		}
+		limiters = append(limiters, l)
+	}
+
+	if n.globalLimiter != nil {
+		limiters = append(limiters, n.globalLimiter)
+	}
+	return limiters
+}
+
+// throttledDialer returns a dial option that throttles the connections with
+// the limiters.
+func throttledDialer(limiters []*rate.Limiter) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &throttledConn{Conn: conn, limiters: limiters}, nil
+	})
+}
+
+// throttledConn waits for the limiters before it passes on any bytes.
+type throttledConn struct {
+	net.Conn
+	limiters []*rate.Limiter
+}
+
+// Read implements net.Conn. It reads at most a burst at once.
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if burst := c.burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := c.Conn.Read(p)
+	c.wait(n)
+	return n, err
+}
+
+// Write implements net.Conn. It writes the bytes a burst at a time.
+func (c *throttledConn) Write(p []byte) (int, error) {
+	var written int
+	burst := c.burst()
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+
+		c.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *throttledConn) burst() int {
+	burst := -1
+	for _, l := range c.limiters {
+		if burst < 0 || l.Burst() < burst {
+			burst = l.Burst()
+		}
+	}
+	return burst
+}
+
+func (c *throttledConn) wait(n int) {
+	if n <= 0 {
+		return
+	}
+
+	for _, l := range c.limiters {
+		l.WaitN(context.Background(), n)
+	}
+}
@@ -0,0 +1,89 @@
+package grpcnet_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TBW struct {
+	*testing.T
+	addr   string
+	server *grpc.Server
+}
+
+func TestBandwidth(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TBW {
+		algs := mapreduce.AlgFetcherMap{
+			"constant": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return "key", value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", bytes.Repeat([]byte("x"), 30000))
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer()
+		grpcnet.NewServer(mapreduce.NewExecutor(algs, fs)).Register(gs)
+		go gs.Serve(lis)
+
+		return TBW{
+			T:      t,
+			addr:   lis.Addr().String(),
+			server: gs,
+		}
+	})
+
+	o.AfterEach(func(t TBW) {
+		t.server.Stop()
+	})
+
+	execute := func(t TBW, opts ...grpcnet.Option) time.Duration {
+		network := grpcnet.New(append([]grpcnet.Option{
+			grpcnet.WithAddrMapping(func(string) string { return t.addr }),
+		}, opts...)...)
+		defer network.Close()
+
+		start := time.Now()
+		result, err := network.Execute("file", "constant", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result["key"]).To(HaveLen(30000))
+		return time.Since(start)
+	}
+
+	o.Spec("it does not cap the bandwidth by default", func(t TBW) {
+		Expect(t, execute(t) < 500*time.Millisecond).To(BeTrue())
+	})
+
+	o.Spec("it caps the bandwidth per node", func(t TBW) {
+		Expect(t, execute(t, grpcnet.WithBandwidth(30000, 0)) > 500*time.Millisecond).To(BeTrue())
+	})
+
+	o.Spec("it caps the bandwidth of all nodes", func(t TBW) {
+		Expect(t, execute(t, grpcnet.WithBandwidth(0, 30000)) > 500*time.Millisecond).To(BeTrue())
+	})
+}
@@ -0,0 +1,176 @@
+package grpcnet
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// The features a node reports in its Capabilities.
+const (
+	StreamingFeature = "streaming"
+	ShuffleFeature   = "shuffle"
+	DrainFeature     = "drain"
+)
+
+// CompressionFeature returns the feature of a node that supports the named
+// compression (see WithCompression).
+func CompressionFeature(name string) string {
+	return "compression:" + name
+}
+
+// v1Features are the features of the nodes that speak version 1 of the
+// protocol, which did not have a handshake yet.
+var v1Features = []string{StreamingFeature, ShuffleFeature}
+
+// Capabilities are the versions of the protocol and the features that a node
+// supports.
+type Capabilities struct {
+	ProtocolVersion    int
+	MinProtocolVersion int
+	Features           []string
+
+	// Zone is the zone the node advertises (see WithZone).
+	Zone string
+}
+
+// Supports reports whether the node supports the feature.
+func (c Capabilities) Supports(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+type capabilitiesKey struct{}
+
+func withCapabilities(ctx context.Context, caps Capabilities) context.Context {
+	return context.WithValue(ctx, capabilitiesKey{}, caps)
+}
+
+// capabilitiesFrom returns the capabilities of the node that a call goes
+// to. Without any, the node is assumed to be as capable as the Network.
+func capabilitiesFrom(ctx context.Context) Capabilities {
+	caps, ok := ctx.Value(capabilitiesKey{}).(Capabilities)
+	if !ok {
+		return localCapabilities()
+	}
+	return caps
+}
+
+// negotiatedProtocol returns the version of the protocol that a call speaks:
+// the newest one that both sides support.
+func negotiatedProtocol(ctx context.Context) string {
+	version := protocolVersion
+	if caps := capabilitiesFrom(ctx); caps.ProtocolVersion < version {
+		version = caps.ProtocolVersion
+	}
+	return strconv.Itoa(version)
+}
+
+// Capabilities returns the capabilities of the node. The node is asked once
+// and then again after its connection dropped, as it might have been
+// upgraded. Nodes that predate the handshake speak version 1 of the
+// protocol.
+//
+// The Network uses them to only use what the node supports: it falls back to
+// unary calls instead of streaming, sends uncompressed payloads and speaks
+// the older version of the protocol if the node does.
+func (n *Network) Capabilities(nodeID string, ctx context.Context) (Capabilities, error) {
+	var caps Capabilities
+	err := n.call(nodeID, ctx, func(ctx context.Context, conn *grpc.ClientConn) error {
+		caps = capabilitiesFrom(ctx)
+		return nil
+	})
+	return caps, err
+}
+
+// handshake invokes f with the capabilities of the node. It asks the node
+// for them unless they are known already. A VersionMismatchError is
+// returned if the node and the Network do not speak a common version of the
+// protocol.
+func (n *Network) handshake(ctx context.Context, nodeID string, conn *grpc.ClientConn, f func(ctx context.Context, conn *grpc.ClientConn) error) error {
+	n.mu.Lock()
+	caps, ok := n.caps[nodeID]
+	n.mu.Unlock()
+
+	if !ok {
+		resp := &handshakeResponse{}
+		req := &handshakeRequest{protocolVersion: strconv.Itoa(protocolVersion)}
+		err := conn.Invoke(ctx, handshakeMethod, req, resp, grpc.CallContentSubtype(contentSubtype))
+		switch status.Code(err) {
+		case codes.OK:
+			caps.ProtocolVersion, _ = strconv.Atoi(resp.protocolVersion)
+			caps.MinProtocolVersion, _ = strconv.Atoi(resp.minProtocolVersion)
+			caps.Features = resp.features
+			caps.Zone = resp.zone
+		case codes.Unimplemented:
+			caps = Capabilities{
+				ProtocolVersion:    1,
+				MinProtocolVersion: 1,
+				Features:           v1Features,
+			}
+		default:
+			return err
+		}
+
+		if caps.ProtocolVersion < minProtocolVersion || caps.MinProtocolVersion > protocolVersion {
+			return &mapreduce.VersionMismatchError{
+				Name:        "grpcnet protocol",
+				Coordinator: fmt.Sprintf("%d-%d", minProtocolVersion, protocolVersion),
+				Node:        fmt.Sprintf("%d-%d", caps.MinProtocolVersion, caps.ProtocolVersion),
+			}
+		}
+
+		n.mu.Lock()
+		n.caps[nodeID] = caps
+		n.mu.Unlock()
+	}
+
+	return f(withCapabilities(ctx, caps), conn)
+}
+
+// forget drops the capabilities of the node, so that it is asked again.
+func (n *Network) forget(nodeID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.caps, nodeID)
+}
+
+// localCapabilities returns the capabilities of this version of the package.
+func localCapabilities() Capabilities {
+	features := []string{StreamingFeature, ShuffleFeature, DrainFeature}
+	for _, name := range []string{Gzip, Snappy, Zstd} {
+		if encoding.GetCompressor(name) != nil {
+			features = append(features, CompressionFeature(name))
+		}
+	}
+
+	return Capabilities{
+		ProtocolVersion:    protocolVersion,
+		MinProtocolVersion: minProtocolVersion,
+		Features:           features,
+	}
+}
+
+func (s *Server) handshake(ctx context.Context, req *handshakeRequest) (*handshakeResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	caps := localCapabilities()
+	return &handshakeResponse{
+		protocolVersion:    strconv.Itoa(caps.ProtocolVersion),
+		minProtocolVersion: strconv.Itoa(caps.MinProtocolVersion),
+		features:           caps.Features,
+		zone:               s.zone,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package grpcnet_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type TCA struct {
+	*testing.T
+	executor *mapreduce.Executor
+	servers  []*grpc.Server
+}
+
+func TestCapabilities(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TCA {
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+
+		return TCA{
+			T:        t,
+			executor: mapreduce.NewExecutor(algs, fs),
+		}
+	})
+
+	o.AfterEach(func(t TCA) {
+		for _, gs := range t.servers {
+			gs.Stop()
+		}
+	})
+
+	serve := func(t *TCA, opts ...grpc.ServerOption) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer(opts...)
+		grpcnet.NewServer(t.executor).Register(gs)
+		go gs.Serve(lis)
+		t.servers = append(t.servers, gs)
+		return lis.Addr().String()
+	}
+
+	// withoutHandshake makes the node look like one that speaks version 1
+	// of the protocol.
+	withoutHandshake := grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasSuffix(info.FullMethod, "/Handshake") {
+			return nil, status.Error(codes.Unimplemented, "unknown method")
+		}
+		return handler(ctx, req)
+	})
+
+	o.Spec("it reports the capabilities of the node", func(t TCA) {
+		addr := serve(&t)
+		network := grpcnet.New(grpcnet.WithAddrMapping(func(string) string { return addr }))
+		defer network.Close()
+
+		caps, err := network.Capabilities("id-a", context.Background())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, caps.ProtocolVersion).To(Equal(2))
+		Expect(t, caps.MinProtocolVersion).To(Equal(1))
+		Expect(t, caps.Supports(grpcnet.StreamingFeature)).To(BeTrue())
+		Expect(t, caps.Supports(grpcnet.ShuffleFeature)).To(BeTrue())
+		Expect(t, caps.Supports(grpcnet.DrainFeature)).To(BeTrue())
+		Expect(t, caps.Supports(grpcnet.CompressionFeature(grpcnet.Zstd))).To(BeTrue())
+	})
+
+	o.Spec("it reports the zone the node advertises", func(t TCA) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(t, err == nil).To(BeTrue())
+
+		gs := grpc.NewServer()
+		grpcnet.NewServer(t.executor, grpcnet.WithZone("region-a/zone-a")).Register(gs)
+		go gs.Serve(lis)
+		defer gs.Stop()
+
+		network := grpcnet.New(grpcnet.WithAddrMapping(func(nodeID string) string {
+			if nodeID == "id-a" {
+				return lis.Addr().String()
+			}
+			return "127.0.0.1:1"
+		}))
+		defer network.Close()
+
+		zones, err := network.Zones("id-a", "id-b").Zones(context.Background())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, zones).To(Equal(map[string]string{"id-a": "region-a/zone-a"}))
+	})
+
+	o.Spec("it treats a node without a handshake as version 1", func(t TCA) {
+		addr := serve(&t, withoutHandshake)
+		network := grpcnet.New(grpcnet.WithAddrMapping(func(string) string { return addr }))
+		defer network.Close()
+
+		caps, err := network.Capabilities("id-a", context.Background())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, caps.ProtocolVersion).To(Equal(1))
+		Expect(t, caps.Supports(grpcnet.CompressionFeature(grpcnet.Zstd))).To(BeFalse())
+
+		result, err := network.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result).To(Equal(map[string][]byte{"x": []byte("x")}))
+	})
+
+	o.Spec("it does not compress the payloads for a node that does not support it", func(t TCA) {
+		addr := serve(&t, withoutHandshake)
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return addr }),
+			grpcnet.WithCompression(grpcnet.Zstd),
+		)
+		defer network.Close()
+
+		counters := mapreduce.NewCounters()
+		ctx := mapreduce.WithCounters(context.Background(), counters)
+		_, err := network.Execute("file", "identity", "id-a", ctx, nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		values := counters.Values()
+		Expect(t, values[grpcnet.CompressedBytesCounter]).To(Equal(values[grpcnet.UncompressedBytesCounter]))
+	})
+}
@@ -0,0 +1,42 @@
+package grpcnet
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// contentSubtype names the codec of the messages, which are encoded by hand
+// (see execute.proto) rather than generated.
+const contentSubtype = "mapreduce"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type message interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+type codec struct{}
+
+func (codec) Name() string {
+	return contentSubtype
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal %T", v)
+	}
+	return m.unmarshal(data)
+}
@@ -0,0 +1,176 @@
+package grpcnet
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+)
+
+// The compressions that WithCompression accepts.
+const (
+	Gzip   = "gzip"
+	Snappy = "snappy"
+	Zstd   = "zstd"
+)
+
+// The counters (see mapreduce.Job.Counters()) that hold the bytes of the
+// payloads to and from the nodes before and after compression (see
+// WithCompression). Their quotient is the compression ratio.
+const (
+	UncompressedBytesCounter = "grpcnet.uncompressed-bytes"
+	CompressedBytesCounter   = "grpcnet.compressed-bytes"
+)
+
+func init() {
+	encoding.RegisterCompressor(snappyCompressor{})
+	encoding.RegisterCompressor(newZstdCompressor())
+}
+
+// WithCompression compresses the payloads that are sent to the nodes with the
+// named compression (Gzip, Snappy or Zstd). The nodes answer with the same
+// compression, so it is negotiated with each call. Nodes that do not support
+// it (see Network.Capabilities) are sent uncompressed payloads. Payloads are
+// not compressed by default.
+//
+// The bytes before and after compression are added to the
+// UncompressedBytesCounter and CompressedBytesCounter of the calculation.
+func WithCompression(name string) Option {
+	return func(n *Network) {
+		n.compression = name
+	}
+}
+
+// compressionOptions returns the dial options that compress the calls.
+func (n *Network) compressionOptions() []grpc.DialOption {
+	if n.compression == "" {
+		return nil
+	}
+
+	feature := CompressionFeature(n.compression)
+	compress := func(ctx context.Context, opts []grpc.CallOption) []grpc.CallOption {
+		// Calls without capabilities (e.g., the handshake) are not
+		// compressed, the node might not support it.
+		caps, ok := ctx.Value(capabilitiesKey{}).(Capabilities)
+		if !ok || !caps.Supports(feature) {
+			return opts
+		}
+		return append(opts, grpc.UseCompressor(n.compression))
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ctx, method, req, reply, cc, compress(ctx, opts)...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, method, compress(ctx, opts)...)
+		}),
+		grpc.WithStatsHandler(compressionStats{}),
+	}
+}
+
+// compressionStats adds the sizes of the payloads to the counters of the
+// calculation.
+type compressionStats struct{}
+
+func (compressionStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (compressionStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.OutPayload:
+		addPayload(ctx, p.Length, p.CompressedLength)
+	case *stats.InPayload:
+		addPayload(ctx, p.Length, p.CompressedLength)
+	}
+}
+
+func (compressionStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (compressionStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func addPayload(ctx context.Context, uncompressed, compressed int) {
+	mapreduce.AddCounter(ctx, UncompressedBytesCounter, int64(uncompressed))
+	mapreduce.AddCounter(ctx, CompressedBytesCounter, int64(compressed))
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return Snappy
+}
+
+func (snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
+
+// zstdCompressor compresses each payload as a whole. The encoder and decoder
+// are safe to share between calls.
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor() zstdCompressor {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return zstdCompressor{
+		encoder: encoder,
+		decoder: decoder,
+	}
+}
+
+func (c zstdCompressor) Name() string {
+	return Zstd
+}
+
+func (c zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &zstdWriter{w: w, encoder: c.encoder}, nil
+}
+
+func (c zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = c.decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// zstdWriter buffers the payload and writes it compressed once it is closed.
+type zstdWriter struct {
+	bytes.Buffer
+	w       io.Writer
+	encoder *zstd.Encoder
+}
+
+func (w *zstdWriter) Close() error {
+	_, err := w.w.Write(w.encoder.EncodeAll(w.Bytes(), nil))
+	return err
+}
@@ -0,0 +1,94 @@
+package grpcnet_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TCP struct {
+	*testing.T
+	addr   string
+	server *grpc.Server
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TCP {
+		algs := mapreduce.AlgFetcherMap{
+			"constant": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return "key", value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", bytes.Repeat([]byte("GET /index.html 200\t"), 1000))
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer()
+		grpcnet.NewServer(mapreduce.NewExecutor(algs, fs)).Register(gs)
+		go gs.Serve(lis)
+
+		return TCP{
+			T:      t,
+			addr:   lis.Addr().String(),
+			server: gs,
+		}
+	})
+
+	o.AfterEach(func(t TCP) {
+		t.server.Stop()
+	})
+
+	execute := func(t TCP, opts ...grpcnet.Option) map[string]int64 {
+		network := grpcnet.New(append([]grpcnet.Option{
+			grpcnet.WithAddrMapping(func(string) string { return t.addr }),
+		}, opts...)...)
+		defer network.Close()
+
+		counters := mapreduce.NewCounters()
+		ctx := mapreduce.WithCounters(context.Background(), counters)
+		result, err := network.Execute("file", "constant", "id-a", ctx, nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result["key"]).To(Equal(bytes.Repeat([]byte("GET /index.html 200\t"), 1000)))
+		return counters.Values()
+	}
+
+	for _, name := range []string{grpcnet.Gzip, grpcnet.Snappy, grpcnet.Zstd} {
+		name := name
+		o.Spec("it compresses the payloads with "+name, func(t TCP) {
+			counters := execute(t, grpcnet.WithCompression(name))
+			uncompressed := counters[grpcnet.UncompressedBytesCounter]
+			compressed := counters[grpcnet.CompressedBytesCounter]
+			Expect(t, compressed > 0).To(BeTrue())
+			Expect(t, uncompressed/compressed >= 10).To(BeTrue())
+		})
+	}
+
+	o.Spec("it does not compress the payloads by default", func(t TCP) {
+		counters := execute(t)
+		_, ok := counters[grpcnet.CompressedBytesCounter]
+		Expect(t, ok).To(BeFalse())
+	})
+}
@@ -0,0 +1,111 @@
+package grpcnet
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// drainingReason marks the status of a node that refuses new work.
+const drainingReason = "DRAINING"
+
+// NodeDrainingError is returned when a node refuses new work because it is
+// drained (see Server.Drain).
+type NodeDrainingError struct {
+	NodeID string
+}
+
+// Error implements error.
+func (e *NodeDrainingError) Error() string {
+	return fmt.Sprintf("node %s is draining", e.NodeID)
+}
+
+// Drain refuses new calculations and waits for the ones in flight to finish,
+// so that the node can be stopped without failing the calculations in
+// flight. A refused calculation returns a NodeDrainingError to the
+// coordinator. It is not a mapreduce.NodeFailure, so the file is not
+// re-dispatched and the node is not reported to a mapreduce.Blacklist: the
+// node should no longer be handed out (e.g., by a mapreduce.Discovery) once
+// it drains. Shuffled values and collect calls are still served, so that the
+// calculations that ran on the node can finish.
+//
+// Drain returns the error of the context if it is done before the
+// calculations in flight finished.
+func (s *Server) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	if s.drained == nil {
+		s.drained = make(chan struct{})
+	}
+	s.draining = true
+	s.checkDrained()
+	drained := s.drained
+	s.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// begin registers a calculation in flight. It returns an error if the node
+// is draining. The calculation has to be finished with end.
+func (s *Server) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		st, err := status.New(codes.Unavailable, "node is draining").WithDetails(&errdetails.ErrorInfo{
+			Reason: drainingReason,
+			Domain: serviceName,
+		})
+		if err != nil {
+			return status.Error(codes.Unavailable, "node is draining")
+		}
+		return st.Err()
+	}
+
+	s.inFlight++
+	return nil
+}
+
+func (s *Server) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	s.checkDrained()
+}
+
+// checkDrained closes the drained channel once nothing is in flight anymore.
+// It has to be called with the lock held.
+func (s *Server) checkDrained() {
+	if !s.draining || s.inFlight > 0 {
+		return
+	}
+
+	select {
+	case <-s.drained:
+	default:
+		close(s.drained)
+	}
+}
+
+// isDraining reports whether the status marks a node that is draining.
+func isDraining(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.Unavailable {
+		return false
+	}
+
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == drainingReason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package grpcnet_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TD struct {
+	*testing.T
+	network *grpcnet.Network
+	server  *grpcnet.Server
+	gs      *grpc.Server
+	started chan struct{}
+	release chan struct{}
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TD {
+		started := make(chan struct{}, 1)
+		release := make(chan struct{})
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+			"blocking": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					started <- struct{}{}
+					<-release
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer()
+		server := grpcnet.NewServer(mapreduce.NewExecutor(algs, fs))
+		server.Register(gs)
+		go gs.Serve(lis)
+
+		return TD{
+			T: t,
+			network: grpcnet.New(
+				grpcnet.WithAddrMapping(func(string) string { return lis.Addr().String() }),
+			),
+			server:  server,
+			gs:      gs,
+			started: started,
+			release: release,
+		}
+	})
+
+	o.AfterEach(func(t TD) {
+		t.network.Close()
+		t.gs.Stop()
+	})
+
+	o.Spec("it returns once nothing is in flight", func(t TD) {
+		Expect(t, t.server.Drain(context.Background()) == nil).To(BeTrue())
+	})
+
+	o.Spec("it refuses new calculations", func(t TD) {
+		t.server.Drain(context.Background())
+
+		_, err := t.network.Execute("file", "identity", "id-a", context.Background(), nil)
+		draining, ok := err.(*grpcnet.NodeDrainingError)
+		Expect(t, ok).To(BeTrue())
+		Expect(t, draining.NodeID).To(Equal("id-a"))
+
+		err = t.network.ExecuteStream("file", "identity", "id-a", context.Background(), nil, func(map[string][]byte) {})
+		_, ok = err.(*grpcnet.NodeDrainingError)
+		Expect(t, ok).To(BeTrue())
+	})
+
+	o.Spec("it finishes the calculations in flight", func(t TD) {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := t.network.Execute("file", "blocking", "id-a", context.Background(), nil)
+			errs <- err
+		}()
+		<-t.started
+
+		drained := make(chan error, 1)
+		go func() {
+			drained <- t.server.Drain(context.Background())
+		}()
+		Expect(t, drained).To(Always(Not(Receive())))
+
+		close(t.release)
+		Expect(t, <-errs == nil).To(BeTrue())
+		Expect(t, <-drained == nil).To(BeTrue())
+	})
+
+	o.Spec("it gives up once the context is done", func(t TD) {
+		go t.network.Execute("file", "blocking", "id-a", context.Background(), nil)
+		<-t.started
+		defer close(t.release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(t, t.server.Drain(ctx) == nil).To(BeFalse())
+	})
+}
@@ -0,0 +1,92 @@
+package grpcnet
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// WithHeartbeat pings each node every interval while a calculation is running
+// on it. A node that does not answer a ping within the timeout is marked
+// down: its calculation is abandoned with a NodeDownError instead of hanging,
+// and so are new calculations until it answers a ping again.
+func WithHeartbeat(interval, timeout time.Duration) Option {
+	return func(n *Network) {
+		n.heartbeatInterval = interval
+		n.heartbeatTimeout = timeout
+	}
+}
+
+// NodeDownError is returned when a node did not answer a heartbeat (see
+// WithHeartbeat).
+type NodeDownError struct {
+	NodeID string
+	Err    error
+}
+
+// Error implements error.
+func (e *NodeDownError) Error() string {
+	return fmt.Sprintf("node %s is down: %s", e.NodeID, e.Err)
+}
+
+// NodeFailure implements mapreduce.NodeFailure.
+func (e *NodeDownError) NodeFailure() {}
+
+// ping sends a heartbeat to the node. It returns a NodeDownError and marks
+// the node down if the node does not answer in time.
+func (n *Network) ping(ctx context.Context, nodeID string, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, n.heartbeatTimeout)
+	defer cancel()
+
+	err := conn.Invoke(ctx, pingMethod, &empty{}, &empty{}, grpc.CallContentSubtype(contentSubtype))
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.down[nodeID] = true
+		return &NodeDownError{NodeID: nodeID, Err: err}
+	}
+
+	delete(n.down, nodeID)
+	return nil
+}
+
+// checkDown returns a NodeDownError if the node is marked down and still
+// does not answer a heartbeat.
+func (n *Network) checkDown(ctx context.Context, nodeID string, conn *grpc.ClientConn) error {
+	n.mu.Lock()
+	down := n.down[nodeID]
+	n.mu.Unlock()
+
+	if !down {
+		return nil
+	}
+	return n.ping(ctx, nodeID, conn)
+}
+
+// watch pings the node until the context is done. Once the node does not
+// answer, it sends the error and cancels the calculation.
+func (n *Network) watch(ctx context.Context, nodeID string, conn *grpc.ClientConn, cancel context.CancelFunc, errs chan<- error) {
+	ticker := time.NewTicker(n.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := n.ping(ctx, nodeID, conn); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			errs <- err
+			cancel()
+			return
+		}
+	}
+}
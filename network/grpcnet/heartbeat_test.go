@@ -0,0 +1,195 @@
+package grpcnet_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TH struct {
+	*testing.T
+	proxy   *freezingProxy
+	network *grpcnet.Network
+	server  *grpc.Server
+	release chan struct{}
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TH {
+		release := make(chan struct{})
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+			"blocking": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					<-release
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer()
+		grpcnet.NewServer(mapreduce.NewExecutor(algs, fs)).Register(gs)
+		go gs.Serve(lis)
+
+		proxy := newFreezingProxy(t, lis.Addr().String())
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return proxy.addr }),
+			grpcnet.WithHeartbeat(20*time.Millisecond, 100*time.Millisecond),
+		)
+
+		return TH{
+			T:       t,
+			proxy:   proxy,
+			network: network,
+			server:  gs,
+			release: release,
+		}
+	})
+
+	o.AfterEach(func(t TH) {
+		close(t.release)
+		t.network.Close()
+		t.proxy.close()
+		t.server.Stop()
+	})
+
+	o.Spec("it calculates while the node answers", func(t TH) {
+		results, err := t.network.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(map[string][]byte{"x": []byte("x")}))
+	})
+
+	o.Spec("it marks an unresponsive node down mid-calculation", func(t TH) {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := t.network.Execute("file", "blocking", "id-a", context.Background(), nil)
+			errs <- err
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		t.proxy.freeze()
+
+		var err error
+		select {
+		case err = <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("calculation did not return")
+		}
+
+		downErr, ok := err.(*grpcnet.NodeDownError)
+		Expect(t, ok).To(BeTrue())
+		Expect(t, downErr.NodeID).To(Equal("id-a"))
+
+		_, err = t.network.Execute("file", "identity", "id-a", context.Background(), nil)
+		_, ok = err.(*grpcnet.NodeDownError)
+		Expect(t, ok).To(BeTrue())
+	})
+}
+
+// freezingProxy forwards TCP connections to a server until it is frozen.
+// Once frozen, it stops forwarding without closing the connections, like a
+// node that stopped responding.
+type freezingProxy struct {
+	addr string
+	lis  net.Listener
+
+	mu     sync.Mutex
+	frozen bool
+}
+
+func newFreezingProxy(t *testing.T, target string) *freezingProxy {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &freezingProxy{addr: lis.Addr().String(), lis: lis}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+
+			go p.forward(upstream, conn)
+			go p.forward(conn, upstream)
+		}
+	}()
+	return p
+}
+
+func (p *freezingProxy) forward(dst io.WriteCloser, src io.ReadCloser) {
+	defer dst.Close()
+	defer src.Close()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+
+		if p.isFrozen() {
+			continue
+		}
+
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func (p *freezingProxy) freeze() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frozen = true
+}
+
+func (p *freezingProxy) isFrozen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.frozen
+}
+
+func (p *freezingProxy) close() {
+	p.lis.Close()
+}
@@ -0,0 +1,639 @@
+package grpcnet
+
+import (
+	"fmt"
+
+	"github.com/poy/mapreduce"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// executeRequest is the wire format of a call to Network.Execute (see
+// execute.proto).
+type executeRequest struct {
+	file             string
+	algName          string
+	meta             []byte
+	sideInputs       map[string][]byte
+	split            *mapreduce.Split
+	badRecordPolicy  mapreduce.BadRecordPolicy
+	quarantinePrefix string
+	shuffle          *mapreduce.ShufflePlan
+	protocolVersion  string
+	algVersion       string
+	idempotencyKey   string
+	reduce           *mapreduce.ReducePlan
+}
+
+func (r *executeRequest) marshal() []byte {
+	var data []byte
+	data = appendString(data, 1, r.file)
+	data = appendString(data, 2, r.algName)
+	if len(r.meta) > 0 {
+		data = protowire.AppendTag(data, 3, protowire.BytesType)
+		data = protowire.AppendBytes(data, r.meta)
+	}
+
+	for name, value := range r.sideInputs {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, value)
+
+		data = protowire.AppendTag(data, 4, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+
+	if r.split != nil {
+		var split []byte
+		split = protowire.AppendTag(split, 1, protowire.VarintType)
+		split = protowire.AppendVarint(split, r.split.Start)
+		split = protowire.AppendTag(split, 2, protowire.VarintType)
+		split = protowire.AppendVarint(split, r.split.End)
+
+		data = protowire.AppendTag(data, 5, protowire.BytesType)
+		data = protowire.AppendBytes(data, split)
+	}
+
+	if r.badRecordPolicy != mapreduce.FailOnBadRecords {
+		data = protowire.AppendTag(data, 6, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(r.badRecordPolicy))
+	}
+
+	data = appendString(data, 7, r.quarantinePrefix)
+
+	data = appendShufflePlan(data, 8, r.shuffle)
+	data = appendString(data, 9, r.protocolVersion)
+	data = appendString(data, 10, r.algVersion)
+	data = appendString(data, 11, r.idempotencyKey)
+	return appendReducePlan(data, 12, r.reduce)
+}
+
+func (r *executeRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.file = v
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.algName = v
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			r.meta = append([]byte{}, v...)
+			return n
+		case num == 4 && typ == protowire.BytesType:
+			entry, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return n
+			}
+
+			var name string
+			var value []byte
+			err := consumeFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) int {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					v, n := protowire.ConsumeString(data)
+					name = v
+					return n
+				case num == 2 && typ == protowire.BytesType:
+					v, n := protowire.ConsumeBytes(data)
+					value = append([]byte{}, v...)
+					return n
+				}
+				return protowire.ConsumeFieldValue(num, typ, data)
+			})
+			if err != nil {
+				return -1
+			}
+
+			if r.sideInputs == nil {
+				r.sideInputs = make(map[string][]byte)
+			}
+			r.sideInputs[name] = value
+			return n
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return n
+			}
+
+			r.split = &mapreduce.Split{}
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, data []byte) int {
+				switch {
+				case num == 1 && typ == protowire.VarintType:
+					v, n := protowire.ConsumeVarint(data)
+					r.split.Start = v
+					return n
+				case num == 2 && typ == protowire.VarintType:
+					v, n := protowire.ConsumeVarint(data)
+					r.split.End = v
+					return n
+				}
+				return protowire.ConsumeFieldValue(num, typ, data)
+			})
+			if err != nil {
+				return -1
+			}
+			return n
+		case num == 6 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			r.badRecordPolicy = mapreduce.BadRecordPolicy(v)
+			return n
+		case num == 7 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.quarantinePrefix = v
+			return n
+		case num == 8 && typ == protowire.BytesType:
+			var n int
+			r.shuffle, n = consumeShufflePlan(data)
+			return n
+		case num == 9 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.protocolVersion = v
+			return n
+		case num == 10 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.algVersion = v
+			return n
+		case num == 11 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.idempotencyKey = v
+			return n
+		case num == 12 && typ == protowire.BytesType:
+			var n int
+			r.reduce, n = consumeReducePlan(data)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+}
+
+// executeResponse is the wire format of the result of Network.Execute. It
+// extends the encoding of mapreduce.Results with the counters, the
+// accumulators and the number of records of each key.
+type executeResponse struct {
+	results      mapreduce.Results
+	counters     map[string]int64
+	accumulators mapreduce.AccumulatorValues
+	records      map[string]int64
+	signature    []byte
+}
+
+func (r *executeResponse) marshal() []byte {
+	data := r.results.ToProto()
+	data = appendValues(data, 2, r.counters)
+
+	if len(r.signature) > 0 {
+		data = protowire.AppendTag(data, 3, protowire.BytesType)
+		data = protowire.AppendBytes(data, r.signature)
+	}
+
+	data = appendValues(data, 4, r.accumulators.Sums)
+	data = appendValues(data, 5, r.accumulators.Maxes)
+	for name, members := range r.accumulators.Sets {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		for _, member := range members {
+			entry = appendString(entry, 2, member)
+		}
+
+		data = protowire.AppendTag(data, 6, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+
+	data = appendValues(data, 7, r.records)
+	return data
+}
+
+func (r *executeResponse) unmarshal(data []byte) error {
+	results, err := mapreduce.ResultsFromProto(data)
+	if err != nil {
+		return err
+	}
+	r.results = results
+
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		switch num {
+		case 2:
+			return consumeValue(data, &r.counters)
+		case 3:
+			v, n := protowire.ConsumeBytes(data)
+			r.signature = append([]byte{}, v...)
+			return n
+		case 4:
+			return consumeValue(data, &r.accumulators.Sums)
+		case 5:
+			return consumeValue(data, &r.accumulators.Maxes)
+		case 6:
+			return consumeSet(data, &r.accumulators.Sets)
+		case 7:
+			return consumeValue(data, &r.records)
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+}
+
+// appendValues appends an entry (name and value) for each of the values.
+func appendValues(data []byte, num protowire.Number, values map[string]int64) []byte {
+	for name, value := range values {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = protowire.AppendTag(entry, 2, protowire.VarintType)
+		entry = protowire.AppendVarint(entry, uint64(value))
+
+		data = protowire.AppendTag(data, num, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+	return data
+}
+
+// consumeValue reads an entry written by appendValues into values.
+func consumeValue(data []byte, values *map[string]int64) int {
+	entry, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return n
+	}
+
+	var name string
+	var value int64
+	err := consumeFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			name = v
+			return n
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			value = int64(v)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+	if err != nil {
+		return -1
+	}
+
+	if *values == nil {
+		*values = make(map[string]int64)
+	}
+	(*values)[name] = value
+	return n
+}
+
+// consumeSet reads the name and the members of a set into sets.
+func consumeSet(data []byte, sets *map[string][]string) int {
+	entry, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return n
+	}
+
+	var name string
+	var members []string
+	err := consumeFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			return protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		v, n := protowire.ConsumeString(data)
+		if num == 1 {
+			name = v
+		} else {
+			members = append(members, v)
+		}
+		return n
+	})
+	if err != nil {
+		return -1
+	}
+
+	if *sets == nil {
+		*sets = make(map[string][]string)
+	}
+	(*sets)[name] = append((*sets)[name], members...)
+	return n
+}
+
+// empty is a message without fields.
+type empty struct{}
+
+func (empty) marshal() []byte {
+	return nil
+}
+
+func (empty) unmarshal(data []byte) error {
+	return nil
+}
+
+// shuffleRequest is the wire format of a call to Network.Shuffle.
+type shuffleRequest struct {
+	jobID  string
+	task   string
+	values mapreduce.Results
+}
+
+func (r *shuffleRequest) marshal() []byte {
+	var data []byte
+	data = appendString(data, 1, r.jobID)
+	data = appendString(data, 2, r.task)
+	data = protowire.AppendTag(data, 3, protowire.BytesType)
+	return protowire.AppendBytes(data, r.values.ToProto())
+}
+
+func (r *shuffleRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.jobID = v
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.task = v
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return n
+			}
+
+			values, err := mapreduce.ResultsFromProto(v)
+			if err != nil {
+				return -1
+			}
+			r.values = values
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+}
+
+// collectRequest is the wire format of a call to Network.Collect. Its
+// response is an executeResponse.
+type collectRequest struct {
+	jobID   string
+	algName string
+	meta    []byte
+	shuffle *mapreduce.ShufflePlan
+	reduce  *mapreduce.ReducePlan
+
+	protocolVersion string
+	algVersion      string
+}
+
+func (r *collectRequest) marshal() []byte {
+	var data []byte
+	data = appendString(data, 1, r.jobID)
+	data = appendString(data, 2, r.algName)
+	if len(r.meta) > 0 {
+		data = protowire.AppendTag(data, 3, protowire.BytesType)
+		data = protowire.AppendBytes(data, r.meta)
+	}
+	data = appendShufflePlan(data, 4, r.shuffle)
+	data = appendString(data, 5, r.protocolVersion)
+	data = appendString(data, 6, r.algVersion)
+	return appendReducePlan(data, 7, r.reduce)
+}
+
+func (r *collectRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.jobID = v
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.algName = v
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			r.meta = append([]byte{}, v...)
+			return n
+		case num == 4 && typ == protowire.BytesType:
+			var n int
+			r.shuffle, n = consumeShufflePlan(data)
+			return n
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.protocolVersion = v
+			return n
+		case num == 6 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.algVersion = v
+			return n
+		case num == 7 && typ == protowire.BytesType:
+			var n int
+			r.reduce, n = consumeReducePlan(data)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+}
+
+// handshakeRequest is the wire format of a call to Network.Capabilities.
+type handshakeRequest struct {
+	protocolVersion string
+}
+
+func (r *handshakeRequest) marshal() []byte {
+	return appendString(nil, 1, r.protocolVersion)
+}
+
+func (r *handshakeRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(data)
+			r.protocolVersion = v
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+}
+
+// handshakeResponse is the wire format of the Capabilities of a node.
+type handshakeResponse struct {
+	protocolVersion    string
+	minProtocolVersion string
+	features           []string
+	zone               string
+}
+
+func (r *handshakeResponse) marshal() []byte {
+	var data []byte
+	data = appendString(data, 1, r.protocolVersion)
+	data = appendString(data, 2, r.minProtocolVersion)
+	for _, feature := range r.features {
+		data = protowire.AppendTag(data, 3, protowire.BytesType)
+		data = protowire.AppendString(data, feature)
+	}
+	return appendString(data, 4, r.zone)
+}
+
+func (r *handshakeResponse) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.protocolVersion = v
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.minProtocolVersion = v
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.features = append(r.features, v)
+			return n
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			r.zone = v
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+}
+
+// appendShufflePlan appends the plan as the given field, unless it is nil.
+func appendShufflePlan(data []byte, num protowire.Number, plan *mapreduce.ShufflePlan) []byte {
+	if plan == nil {
+		return data
+	}
+
+	var v []byte
+	v = appendString(v, 1, plan.JobID)
+	for _, nodeID := range plan.Nodes {
+		v = protowire.AppendTag(v, 2, protowire.BytesType)
+		v = protowire.AppendString(v, nodeID)
+	}
+
+	if plan.MaxReduceIterations > 0 {
+		v = protowire.AppendTag(v, 3, protowire.VarintType)
+		v = protowire.AppendVarint(v, uint64(plan.MaxReduceIterations))
+	}
+
+	if plan.Replicate {
+		v = protowire.AppendTag(v, 4, protowire.VarintType)
+		v = protowire.AppendVarint(v, 1)
+	}
+
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+	return protowire.AppendBytes(data, v)
+}
+
+// consumeShufflePlan consumes a plan that was appended by appendShufflePlan.
+func consumeShufflePlan(data []byte) (*mapreduce.ShufflePlan, int) {
+	v, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return nil, n
+	}
+
+	plan := &mapreduce.ShufflePlan{}
+	err := consumeFields(v, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			plan.JobID = v
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			plan.Nodes = append(plan.Nodes, v)
+			return n
+		case num == 3 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			plan.MaxReduceIterations = int(v)
+			return n
+		case num == 4 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			plan.Replicate = v != 0
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+	if err != nil {
+		return nil, -1
+	}
+	return plan, n
+}
+
+// appendReducePlan appends the plan as the given field, unless it is nil.
+func appendReducePlan(data []byte, num protowire.Number, plan *mapreduce.ReducePlan) []byte {
+	if plan == nil {
+		return data
+	}
+
+	var v []byte
+	if plan.MaxIterations > 0 {
+		v = protowire.AppendTag(v, 1, protowire.VarintType)
+		v = protowire.AppendVarint(v, uint64(plan.MaxIterations))
+	}
+
+	if plan.Unreduced {
+		v = protowire.AppendTag(v, 2, protowire.VarintType)
+		v = protowire.AppendVarint(v, 1)
+	}
+
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+	return protowire.AppendBytes(data, v)
+}
+
+// consumeReducePlan consumes a plan that was appended by appendReducePlan.
+func consumeReducePlan(data []byte) (*mapreduce.ReducePlan, int) {
+	v, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return nil, n
+	}
+
+	plan := &mapreduce.ReducePlan{}
+	err := consumeFields(v, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			plan.MaxIterations = int(v)
+			return n
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			plan.Unreduced = v != 0
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, data)
+	})
+	if err != nil {
+		return nil, -1
+	}
+	return plan, n
+}
+
+func appendString(data []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return data
+	}
+
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+	return protowire.AppendString(data, s)
+}
+
+// consumeFields invokes consume for each field of the message. It returns
+// the number of bytes the value of the field took up, or a negative number
+// if the value is invalid.
+func consumeFields(data []byte, consume func(num protowire.Number, typ protowire.Type, data []byte) int) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		n = consume(num, typ, data)
+		if n < 0 {
+			return fmt.Errorf("invalid value for field %d", num)
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Package grpcnet implements a mapreduce.Network over gRPC. Each node runs a
+// Server for its Executor, and the coordinator passes a Network to
+// mapreduce.New.
+package grpcnet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Option is used to configure a new Network.
+type Option func(*Network)
+
+// WithAddrMapping sets how a node ID is mapped to the address of its Server.
+// It defaults to using the node ID as the address.
+func WithAddrMapping(f func(nodeID string) (addr string)) Option {
+	return func(n *Network) {
+		n.addr = f
+	}
+}
+
+// WithDialOptions adds options for the connections to the nodes. Without
+// any transport credentials, the connections are not encrypted.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(n *Network) {
+		n.dialOpts = append(n.dialOpts, opts...)
+	}
+}
+
+// Network implements mapreduce.ShuffleNetwork and mapreduce.StreamNetwork
+// over gRPC. It ships the side inputs, the split, the policy for bad
+// records, the quarantine, the shuffle, the version of the algorithm and the
+// idempotency key with each call and merges the counters, the accumulators
+// and the record counts of the remote node into the coordinator's. The
+// connections to each node are shared by the calls of every calculation
+// (see WithPool and WithMaxStreams). gRPC carries the deadline of the
+// context with each call and cancels the call along with the context, so a
+// node abandons the calculation as soon as the coordinator gives up on it. A
+// call whose connection dropped can be replayed (see WithRetry).
+//
+// It also implements mapreduce.Shuffler, so a node can pass its own Network
+// to mapreduce.WithShuffler to send values to the other nodes.
+//
+// It should be created with New().
+type Network struct {
+	addr     func(nodeID string) string
+	dialOpts []grpc.DialOption
+	token    string
+
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+
+	retryAttempts int
+	retryBase     time.Duration
+	retryMax      time.Duration
+
+	compression string
+	verify      Verifier
+
+	nodeBandwidth int64
+	globalLimiter *rate.Limiter
+	nodeLimiters  map[string]*rate.Limiter
+
+	poolSize    int
+	maxStreams  int
+	idleTimeout time.Duration
+	stop        chan struct{}
+
+	mu    sync.Mutex
+	conns map[string][]*pooledConn
+	down  map[string]bool
+	caps  map[string]Capabilities
+}
+
+// New returns a new Network.
+func New(opts ...Option) *Network {
+	n := &Network{
+		addr: func(nodeID string) string {
+			return nodeID
+		},
+		dialOpts: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+		poolSize:   1,
+		maxStreams: 1,
+		stop:       make(chan struct{}),
+		conns:      make(map[string][]*pooledConn),
+		down:       make(map[string]bool),
+		caps:       make(map[string]Capabilities),
+
+		nodeLimiters: make(map[string]*rate.Limiter),
+	}
+
+	for _, o := range opts {
+		o(n)
+	}
+
+	if n.idleTimeout > 0 {
+		go n.closeIdle()
+	}
+
+	return n
+}
+
+// Execute implements mapreduce.Network.
+func (n *Network) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	resp := &executeResponse{}
+	err := n.call(nodeID, ctx, func(ctx context.Context, conn *grpc.ClientConn) error {
+		req := newExecuteRequest(file, algName, ctx, meta)
+		if err := conn.Invoke(ctx, executeMethod, req, resp, grpc.CallContentSubtype(contentSubtype)); err != nil {
+			return err
+		}
+		return n.verifyResponse(nodeID, executeFields(req, 0, true), resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c := mapreduce.CountersFrom(ctx); c != nil {
+		c.Merge(resp.counters)
+	}
+
+	if a := mapreduce.AccumulatorsFrom(ctx); a != nil {
+		a.MergeValues(resp.accumulators)
+	}
+
+	if c := mapreduce.RecordCountsFrom(ctx); c != nil {
+		c.Merge(resp.records)
+	}
+	return resp.results, nil
+}
+
+// newExecuteRequest returns the request for a calculation. It ships the
+// values of the context.
+func newExecuteRequest(file, algName string, ctx context.Context, meta []byte) *executeRequest {
+	req := &executeRequest{
+		file:             file,
+		algName:          algName,
+		meta:             meta,
+		sideInputs:       mapreduce.SideInputs(ctx),
+		badRecordPolicy:  mapreduce.BadRecordPolicyFrom(ctx),
+		quarantinePrefix: mapreduce.QuarantinePrefixFrom(ctx),
+		protocolVersion:  negotiatedProtocol(ctx),
+	}
+	req.algVersion, _ = mapreduce.AlgorithmVersionFrom(ctx)
+	req.idempotencyKey, _ = mapreduce.IdempotencyKeyFrom(ctx)
+	if split, ok := mapreduce.SplitFrom(ctx); ok {
+		req.split = &split
+	}
+	if plan, ok := mapreduce.ShufflePlanFrom(ctx); ok {
+		req.shuffle = &plan
+	}
+	if plan, ok := mapreduce.ReducePlanFrom(ctx); ok {
+		req.reduce = &plan
+	}
+	return req
+}
+
+// call invokes f with the connection to the node. With heartbeats
+// configured, the node is watched while f runs (see WithHeartbeat). Calls
+// whose connection dropped are replayed (see WithRetry). Errors are
+// converted back from their status, and a connection that dropped for good
+// is reported as a mapreduce.NodeError.
+func (n *Network) call(nodeID string, ctx context.Context, f func(ctx context.Context, conn *grpc.ClientConn) error) error {
+	err := n.retry(nodeID, ctx, func() error {
+		return n.attempt(nodeID, ctx, f)
+	})
+	if retryable(err) {
+		return &mapreduce.NodeError{NodeID: nodeID, Err: err}
+	}
+	return err
+}
+
+// attempt invokes f once. The context that f receives carries the
+// capabilities of the node (see Network.Capabilities).
+func (n *Network) attempt(nodeID string, ctx context.Context, f func(ctx context.Context, conn *grpc.ClientConn) error) error {
+	pc, err := n.conn(nodeID)
+	if err != nil {
+		return err
+	}
+	defer n.release(pc)
+	conn := pc.conn
+
+	down := make(chan error, 1)
+	if n.heartbeatInterval > 0 {
+		if err := n.checkDown(ctx, nodeID, conn); err != nil {
+			return err
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go n.watch(ctx, nodeID, conn, cancel, down)
+	}
+
+	err = n.handshake(ctx, nodeID, conn, f)
+	if err != nil {
+		select {
+		case downErr := <-down:
+			return downErr
+		default:
+			if isDraining(err) {
+				return &NodeDrainingError{NodeID: nodeID}
+			}
+
+			if retryable(err) {
+				// The node might come back with a different version.
+				n.forget(nodeID)
+			}
+
+			if n.retryAttempts > 1 && retryable(err) {
+				// Redial right away instead of waiting out gRPC's own
+				// backoff, the next attempt is spaced by ours.
+				conn.ResetConnectBackoff()
+			}
+			return fromStatus(err)
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to the nodes.
+func (n *Network) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	select {
+	case <-n.stop:
+	default:
+		close(n.stop)
+	}
+
+	var err error
+	for nodeID, conns := range n.conns {
+		for _, pc := range conns {
+			if closeErr := pc.conn.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		delete(n.conns, nodeID)
+	}
+	return err
+}
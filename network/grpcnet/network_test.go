@@ -0,0 +1,349 @@
+package grpcnet_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TN struct {
+	*testing.T
+	fs      *fsfakes.InMemory
+	network *grpcnet.Network
+	peers   *grpcnet.Network
+	mr      mapreduce.MapReduce
+	servers []*grpc.Server
+
+	abandoned chan error
+	gate      *sync.Once
+	sent      chan struct{}
+}
+
+func TestNetwork(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TN {
+		abandoned := make(chan error, 2)
+		sent := make(chan struct{})
+		var reduced int32
+		algs := mapreduce.AlgFetcherMap{
+			"gate": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					if atomic.AddInt32(&reduced, 1) == 1 {
+						return values[:1], nil
+					}
+
+					select {
+					case <-sent:
+						return values[:1], nil
+					case <-time.After(5 * time.Second):
+						return nil, fmt.Errorf("the first key was not sent before the next one was reduced")
+					}
+				}),
+			},
+			"wait": {
+				Mapper: mapreduce.MapContextFunc(func(ctx context.Context, value []byte) (string, []byte, error) {
+					<-ctx.Done()
+					abandoned <- ctx.Err()
+					return "", nil, ctx.Err()
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+			"key": {
+				Mapper: mapreduce.MapContextFunc(func(ctx context.Context, value []byte) (string, []byte, error) {
+					key, _ := mapreduce.IdempotencyKeyFrom(ctx)
+					return key, value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+			"stuck": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return "key", value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values, nil
+				}),
+			},
+			"outputs": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.OutputReduceFunc(func(values [][]byte, emit mapreduce.Emit) ([][]byte, error) {
+					emit("sizes", []byte(fmt.Sprint(len(values))))
+					return values[:1], nil
+				}),
+			},
+			"count": {
+				Mapper: mapreduce.MapContextFunc(func(ctx context.Context, value []byte) (string, []byte, error) {
+					mapreduce.IncCounter(ctx, "mapped")
+					mapreduce.AccumulateSum(ctx, "mapped", 1)
+					mapreduce.AccumulateMax(ctx, "longest", int64(len(value)))
+					mapreduce.AccumulateSet(ctx, "values", string(value))
+					prefix, _ := mapreduce.SideInput(ctx, "prefix")
+					return string(prefix) + string(value), []byte{1}, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					var sum byte
+					for _, v := range values {
+						sum += v[0]
+					}
+					return [][]byte{{sum}}, nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a", "id-b")
+		fs.Write("file-a", []byte("x"), []byte("y"), []byte("x"))
+		fs.Write("file-b", []byte("x"))
+		fs.Write("gate", []byte("x"), []byte("y"), []byte("x"), []byte("y"))
+		fs.SetNodes("file-a", "id-a")
+		fs.SetNodes("file-b", "id-b")
+
+		addrs := make(map[string]string)
+		addrMapping := grpcnet.WithAddrMapping(func(nodeID string) string {
+			return addrs[nodeID]
+		})
+		peers := grpcnet.New(addrMapping)
+
+		var servers []*grpc.Server
+		for _, id := range []string{"id-a", "id-b"} {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gs := grpc.NewServer()
+			grpcnet.NewServer(mapreduce.NewExecutor(algs, fs, mapreduce.WithShuffler(peers, nil)), grpcnet.WithBatchSize(1)).Register(gs)
+			go gs.Serve(lis)
+
+			addrs[id] = lis.Addr().String()
+			servers = append(servers, gs)
+		}
+
+		network := grpcnet.New(addrMapping)
+
+		return TN{
+			T:       t,
+			fs:      fs,
+			network: network,
+			peers:   peers,
+			mr:      mapreduce.New(fs, network, algs),
+			servers: servers,
+
+			abandoned: abandoned,
+			gate:      &sync.Once{},
+			sent:      sent,
+		}
+	})
+
+	o.AfterEach(func(t TN) {
+		t.network.Close()
+		t.peers.Close()
+		for _, gs := range t.servers {
+			gs.Stop()
+		}
+	})
+
+	o.Spec("it calculates on the remote nodes", func(t TN) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithSideInput("prefix", []byte("p-")))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{
+			"p-x": {3},
+			"p-y": {1},
+		}))
+	})
+
+	o.Spec("it shuffles between the remote nodes", func(t TN) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithShuffle())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{
+			"x": {3},
+			"y": {1},
+		}))
+	})
+
+	o.Spec("it replicates the shuffled values between the remote nodes", func(t TN) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithShuffleReplication())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{
+			"x": {3},
+			"y": {1},
+		}))
+	})
+
+	o.Spec("it reduces on the remote nodes", func(t TN) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithRemoteReduce(), mapreduce.WithMaxReduceIterations(10))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{
+			"x": {3},
+			"y": {1},
+		}))
+	})
+
+	o.Spec("it limits the reduction on the remote nodes", func(t TN) {
+		_, err := t.mr.Calculate("file", "stuck", context.Background(), nil, mapreduce.WithMaxReduceIterations(2))
+		Expect(t, err == nil).To(BeFalse())
+		Expect(t, strings.Contains(err.Error(), "key key did not converge after 2 iterations")).To(BeTrue())
+	})
+
+	o.Spec("it leaves the convergence to the coordinator", func(t TN) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithShuffle(), mapreduce.WithConvergence(func(values [][]byte) bool {
+			return len(values) <= 3
+		}))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results.Values("x")).To(Equal([][]byte{{1}, {1}, {1}}))
+	})
+
+	o.Spec("it collects the side outputs of every reduction", func(t TN) {
+		job, err := t.mr.Submit("file", "outputs", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		_, err = job.Wait()
+		Expect(t, err == nil).To(BeTrue())
+
+		// The node of file-a does not reduce its two values of x, so the
+		// coordinator reduces all three at once.
+		Expect(t, job.Output("sizes")).To(Equal(map[string][][]byte{
+			"x": {[]byte("3")},
+		}))
+	})
+
+	o.Spec("it collects the side outputs of a shuffled calculation", func(t TN) {
+		job, err := t.mr.Submit("file", "outputs", context.Background(), nil, mapreduce.WithShuffle())
+		Expect(t, err == nil).To(BeTrue())
+		_, err = job.Wait()
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, job.Output("sizes")).To(Equal(map[string][][]byte{
+			"x": {[]byte("3")},
+		}))
+	})
+
+	o.Spec("it does not reduce the side outputs on the remote nodes", func(t TN) {
+		_, err := t.mr.Calculate("file", "outputs", context.Background(), nil, mapreduce.WithRemoteReduce())
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it merges the counters of the remote nodes", func(t TN) {
+		job, err := t.mr.Submit("file", "count", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		job.Wait()
+		Expect(t, job.Counters()).To(Equal(map[string]int64{"mapped": 4}))
+	})
+
+	o.Spec("it merges the accumulators of the remote nodes", func(t TN) {
+		job, err := t.mr.Submit("file", "count", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		job.Wait()
+		Expect(t, job.Accumulators().Sum("mapped")).To(Equal(int64(4)))
+		max, ok := job.Accumulators().Max("longest")
+		Expect(t, ok).To(BeTrue())
+		Expect(t, max).To(Equal(int64(1)))
+		Expect(t, job.Accumulators().Set("values")).To(Equal([]string{"x", "y"}))
+	})
+
+	o.Spec("it merges the record counts of the remote nodes", func(t TN) {
+		job, err := t.mr.Submit("file", "count", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		job.Wait()
+
+		meta, ok := job.Meta("x")
+		Expect(t, ok).To(BeTrue())
+		Expect(t, meta.Records).To(Equal(int64(3)))
+	})
+
+	o.Spec("it merges the accumulators of a streamed result", func(t TN) {
+		accumulators := mapreduce.NewAccumulators()
+		ctx := mapreduce.WithAccumulators(context.Background(), accumulators)
+		err := t.network.ExecuteStream("file-a", "count", "id-a", ctx, nil, func(map[string][]byte) {})
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, accumulators.Sum("mapped")).To(Equal(int64(3)))
+	})
+
+	o.Spec("it streams the result of the remote node in batches", func(t TN) {
+		var batches []map[string][]byte
+		err := t.network.ExecuteStream("file-a", "count", "id-a", context.Background(), nil, func(result map[string][]byte) {
+			batches = append(batches, result)
+		})
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, batches).To(HaveLen(3))
+		Expect(t, batches[0]).To(HaveLen(1))
+		Expect(t, batches[1]).To(HaveLen(1))
+
+		// The last batch only carries the counters, as the node cannot
+		// tell which key is its last one.
+		Expect(t, batches[2]).To(HaveLen(0))
+	})
+
+	o.Spec("it streams each key before the node reduced the next one", func(t TN) {
+		err := t.network.ExecuteStream("gate", "gate", "id-a", context.Background(), nil, func(result map[string][]byte) {
+			t.gate.Do(func() { close(t.sent) })
+		})
+		Expect(t, err == nil).To(BeTrue())
+	})
+
+	o.Spec("it ships the split to the remote node", func(t TN) {
+		// The in-memory FileSystem cannot read ranges, so the remote
+		// Executor only fails if it got the split.
+		ctx := mapreduce.WithSplit(context.Background(), mapreduce.Split{Start: 0, End: 1})
+		_, err := t.network.Execute("file-a", "count", "id-a", ctx, nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it ships the idempotency key to the remote node", func(t TN) {
+		ctx := mapreduce.WithIdempotencyKey(context.Background(), "some-key")
+		result, err := t.network.Execute("file-b", "key", "id-b", ctx, nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result).To(Equal(map[string][]byte{"some-key": []byte("x")}))
+	})
+
+	o.Spec("it returns an error when the nodes have another version of the algorithm", func(t TN) {
+		algs := mapreduce.AlgFetcherMap{
+			"count": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), []byte{1}, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+				Version: "v2",
+			},
+		}
+
+		_, err := mapreduce.New(t.fs, t.network, algs).Calculate("file", "count", context.Background(), nil)
+		mismatch, ok := err.(*mapreduce.VersionMismatchError)
+		Expect(t, ok).To(BeTrue())
+		Expect(t, mismatch.Coordinator).To(Equal("v2"))
+	})
+
+	o.Spec("it abandons the work on the remote nodes once the deadline passed", func(t TN) {
+		_, err := t.mr.Calculate("file-b", "wait", context.Background(), nil, mapreduce.WithTimeout(50*time.Millisecond))
+		Expect(t, err == nil).To(BeFalse())
+		Expect(t, t.abandoned).To(Receive(ReceiveWait(time.Second)))
+	})
+
+	o.Spec("it returns the error of the remote node", func(t TN) {
+		_, err := t.mr.Calculate("file", "unknown", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
@@ -0,0 +1,126 @@
+package grpcnet
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// WithPool keeps up to size connections to each node. A call uses the least
+// busy connection and another connection is only dialed while every
+// connection carries the maximum number of calls (see WithMaxStreams).
+// Connections that were not used for the idle timeout are closed and dialed
+// again once they are needed. By default a single connection per node is
+// kept open until Close.
+func WithPool(size int, idleTimeout time.Duration) Option {
+	return func(n *Network) {
+		if size < 1 {
+			size = 1
+		}
+
+		n.poolSize = size
+		n.idleTimeout = idleTimeout
+	}
+}
+
+// WithMaxStreams sets the number of concurrent calls a connection carries
+// before the pool dials another one (see WithPool). The calls of every
+// calculation are multiplexed over the connections as separate HTTP/2
+// streams, so the number of connections does not grow with the number of
+// calculations. It defaults to 1.
+func WithMaxStreams(n int) Option {
+	return func(nw *Network) {
+		if n < 1 {
+			n = 1
+		}
+		nw.maxStreams = n
+	}
+}
+
+// pooledConn is a connection of the pool.
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	inFlight int
+	lastUsed time.Time
+}
+
+// conn returns the least busy connection to the node. It has to be
+// released once the call is done.
+func (n *Network) conn(nodeID string) (*pooledConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var least *pooledConn
+	for _, pc := range n.conns[nodeID] {
+		if least == nil || pc.inFlight < least.inFlight {
+			least = pc
+		}
+	}
+
+	if least == nil || (least.inFlight >= n.maxStreams && len(n.conns[nodeID]) < n.poolSize) {
+		dialOpts := append([]grpc.DialOption{}, n.dialOpts...)
+		if n.token != "" {
+			dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(tokenCredentials(n.token)))
+		}
+
+		dialOpts = append(dialOpts, n.compressionOptions()...)
+
+		if limiters := n.limiters(nodeID); len(limiters) > 0 {
+			dialOpts = append(dialOpts, throttledDialer(limiters))
+		}
+
+		conn, err := grpc.NewClient(n.addr(nodeID), dialOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		least = &pooledConn{conn: conn}
+		n.conns[nodeID] = append(n.conns[nodeID], least)
+	}
+
+	least.inFlight++
+	least.lastUsed = time.Now()
+	return least, nil
+}
+
+func (n *Network) release(pc *pooledConn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	pc.inFlight--
+	pc.lastUsed = time.Now()
+}
+
+// closeIdle closes the connections that were idle for too long until the
+// Network is closed.
+func (n *Network) closeIdle() {
+	ticker := time.NewTicker(n.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.Lock()
+		for nodeID, conns := range n.conns {
+			var active []*pooledConn
+			for _, pc := range conns {
+				if pc.inFlight == 0 && time.Since(pc.lastUsed) >= n.idleTimeout {
+					pc.conn.Close()
+					continue
+				}
+				active = append(active, pc)
+			}
+
+			if len(active) == 0 {
+				delete(n.conns, nodeID)
+				continue
+			}
+			n.conns[nodeID] = active
+		}
+		n.mu.Unlock()
+	}
+}
@@ -0,0 +1,164 @@
+package grpcnet_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TPL struct {
+	*testing.T
+	lis     *countingListener
+	network *grpcnet.Network
+	server  *grpc.Server
+	release chan struct{}
+}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TPL {
+		release := make(chan struct{})
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+			"blocking": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					<-release
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis := &countingListener{Listener: l}
+
+		gs := grpc.NewServer()
+		grpcnet.NewServer(mapreduce.NewExecutor(algs, fs)).Register(gs)
+		go gs.Serve(lis)
+
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return l.Addr().String() }),
+			grpcnet.WithPool(2, 50*time.Millisecond),
+		)
+
+		return TPL{
+			T:       t,
+			lis:     lis,
+			network: network,
+			server:  gs,
+			release: release,
+		}
+	})
+
+	o.AfterEach(func(t TPL) {
+		close(t.release)
+		t.network.Close()
+		t.server.Stop()
+	})
+
+	o.Spec("it reuses an idle connection", func(t TPL) {
+		for i := 0; i < 3; i++ {
+			_, err := t.network.Execute("file", "identity", "id-a", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+		}
+		Expect(t, t.lis.count()).To(Equal(1))
+	})
+
+	o.Spec("it dials another connection while the others are busy", func(t TPL) {
+		for i := 0; i < 2; i++ {
+			go t.network.Execute("file", "blocking", "id-a", context.Background(), nil)
+		}
+		Expect(t, t.lis.count).To(ViaPolling(Equal(2)))
+	})
+
+	o.Spec("it multiplexes the calls up to the maximum streams", func(t TPL) {
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return t.lis.Addr().String() }),
+			grpcnet.WithPool(2, time.Minute),
+			grpcnet.WithMaxStreams(2),
+		)
+		defer network.Close()
+
+		for i := 0; i < 2; i++ {
+			go network.Execute("file", "blocking", "id-a", context.Background(), nil)
+		}
+		Expect(t, t.lis.count).To(ViaPolling(Equal(1)))
+		Expect(t, t.lis.count).To(Always(Equal(1)))
+
+		go network.Execute("file", "blocking", "id-a", context.Background(), nil)
+		Expect(t, t.lis.count).To(ViaPolling(Equal(2)))
+	})
+
+	o.Spec("it multiplexes every calculation over a single connection by default", func(t TPL) {
+		network := grpcnet.New(grpcnet.WithAddrMapping(func(string) string { return t.lis.Addr().String() }))
+		defer network.Close()
+
+		for i := 0; i < 3; i++ {
+			go network.Execute("file", "blocking", "id-a", context.Background(), nil)
+		}
+		Expect(t, t.lis.count).To(ViaPolling(Equal(1)))
+		Expect(t, t.lis.count).To(Always(Equal(1)))
+	})
+
+	o.Spec("it closes idle connections", func(t TPL) {
+		_, err := t.network.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		time.Sleep(200 * time.Millisecond)
+		_, err = t.network.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, t.lis.count()).To(Equal(2))
+	})
+}
+
+// countingListener counts the accepted connections.
+type countingListener struct {
+	net.Listener
+
+	mu       sync.Mutex
+	accepted int
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.accepted++
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *countingListener) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.accepted
+}
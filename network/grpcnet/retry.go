@@ -0,0 +1,91 @@
+package grpcnet
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithRetry replays a call whose connection to the node dropped (or could
+// not be established), up to the given number of attempts. The attempts are
+// spaced with a jittered exponential backoff that starts at base and is
+// capped at max. Calls are not retried by default.
+//
+// Replaying a call is safe: the node calculates the file (or split) again
+// and only the result of the successful attempt is used.
+func WithRetry(attempts int, base, max time.Duration) Option {
+	return func(n *Network) {
+		n.retryAttempts = attempts
+		n.retryBase = base
+		n.retryMax = max
+	}
+}
+
+// UnreachableError is returned when a call to a node failed on every attempt
+// (see WithRetry).
+type UnreachableError struct {
+	NodeID   string
+	Attempts int
+	Err      error
+}
+
+// Error implements error.
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("node %s is unreachable after %d attempts: %s", e.NodeID, e.Attempts, e.Err)
+}
+
+// NodeFailure implements mapreduce.NodeFailure.
+func (e *UnreachableError) NodeFailure() {}
+
+// retry invokes f until it succeeds, fails with an error that is not worth
+// retrying or the attempts are exhausted.
+func (n *Network) retry(nodeID string, ctx context.Context, f func() error) error {
+	if n.retryAttempts <= 1 {
+		return f()
+	}
+
+	var err error
+	for attempt := 0; attempt < n.retryAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(n.backoff(attempt)):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		err = f()
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return &UnreachableError{
+		NodeID:   nodeID,
+		Attempts: n.retryAttempts,
+		Err:      err,
+	}
+}
+
+// backoff returns how long to wait before the given attempt. It doubles
+// with each attempt and is jittered between half and all of it.
+func (n *Network) backoff(attempt int) time.Duration {
+	d := n.retryBase << uint(attempt-1)
+	if d <= 0 || (n.retryMax > 0 && d > n.retryMax) {
+		d = n.retryMax
+	}
+
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether the error stems from the connection to the node.
+func retryable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
@@ -0,0 +1,124 @@
+package grpcnet_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TRT struct {
+	*testing.T
+	addr     string
+	executor *mapreduce.Executor
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TRT {
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+
+		// Reserve an address that nothing listens on (yet).
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+
+		return TRT{
+			T:        t,
+			addr:     addr,
+			executor: mapreduce.NewExecutor(algs, fs),
+		}
+	})
+
+	o.Spec("it replays the call once the node is back", func(t TRT) {
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return t.addr }),
+			grpcnet.WithRetry(20, 10*time.Millisecond, 50*time.Millisecond),
+		)
+		defer network.Close()
+
+		gs := grpc.NewServer()
+		defer gs.Stop()
+		grpcnet.NewServer(t.executor).Register(gs)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			l, err := net.Listen("tcp", t.addr)
+			if err != nil {
+				return
+			}
+			gs.Serve(l)
+		}()
+
+		result, err := network.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result).To(Equal(map[string][]byte{"x": []byte("x")}))
+	})
+
+	o.Spec("it returns an UnreachableError once the attempts are exhausted", func(t TRT) {
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return t.addr }),
+			grpcnet.WithRetry(3, time.Millisecond, 5*time.Millisecond),
+		)
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", "id-a", context.Background(), nil)
+		unreachable, ok := err.(*grpcnet.UnreachableError)
+		Expect(t, ok).To(BeTrue())
+		Expect(t, unreachable.NodeID).To(Equal("id-a"))
+		Expect(t, unreachable.Attempts).To(Equal(3))
+	})
+
+	o.Spec("it does not retry by default", func(t TRT) {
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return t.addr }),
+		)
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+		_, ok := err.(*grpcnet.UnreachableError)
+		Expect(t, ok).To(BeFalse())
+	})
+
+	o.Spec("it stops retrying once the context is done", func(t TRT) {
+		network := grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return t.addr }),
+			grpcnet.WithRetry(1000, 10*time.Millisecond, 10*time.Millisecond),
+		)
+		defer network.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := network.Execute("file", "identity", "id-a", ctx, nil)
+		Expect(t, err == nil).To(BeFalse())
+		Expect(t, time.Since(start) < time.Second).To(BeTrue())
+	})
+}
@@ -0,0 +1,198 @@
+package grpcnet
+
+import (
+	"sync"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const (
+	serviceName   = "mapreduce.grpcnet.Executor"
+	executeMethod = "/" + serviceName + "/Execute"
+	streamMethod  = "/" + serviceName + "/ExecuteStream"
+	pingMethod    = "/" + serviceName + "/Ping"
+	shuffleMethod = "/" + serviceName + "/Shuffle"
+	collectMethod = "/" + serviceName + "/Collect"
+
+	handshakeMethod = "/" + serviceName + "/Handshake"
+)
+
+// ServerOption is used to configure a new Server.
+type ServerOption func(*Server)
+
+// Server runs the calculations that a Network sends to its node. It restores
+// the values of the context that the coordinator's Network shipped along
+// (see mapreduce.Network) before invoking the Executor.
+//
+// It should be created with NewServer().
+type Server struct {
+	e         *mapreduce.Executor
+	auth      Auth
+	batchSize int
+	sign      Signer
+	zone      string
+
+	mu       sync.Mutex
+	draining bool
+	inFlight int
+	drained  chan struct{}
+}
+
+// NewServer returns a new Server for the given Executor. By default any
+// coordinator that can connect may push work to the node (see WithAuth).
+func NewServer(e *mapreduce.Executor, opts ...ServerOption) *Server {
+	s := &Server{
+		e:         e,
+		batchSize: 1000,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// Register registers the service of the Server with the given gRPC server.
+func (s *Server) Register(gs *grpc.Server) {
+	gs.RegisterService(&grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Execute",
+				Handler: handler(executeMethod, func() message { return &executeRequest{} }, func(ctx context.Context, req message) (message, error) {
+					return s.execute(ctx, req.(*executeRequest))
+				}),
+			},
+			{
+				MethodName: "Ping",
+				Handler: handler(pingMethod, func() message { return &empty{} }, func(ctx context.Context, req message) (message, error) {
+					return &empty{}, nil
+				}),
+			},
+			{
+				MethodName: "Shuffle",
+				Handler: handler(shuffleMethod, func() message { return &shuffleRequest{} }, func(ctx context.Context, req message) (message, error) {
+					return s.shuffle(ctx, req.(*shuffleRequest))
+				}),
+			},
+			{
+				MethodName: "Collect",
+				Handler: handler(collectMethod, func() message { return &collectRequest{} }, func(ctx context.Context, req message) (message, error) {
+					return s.collect(ctx, req.(*collectRequest))
+				}),
+			},
+			{
+				MethodName: "Handshake",
+				Handler: handler(handshakeMethod, func() message { return &handshakeRequest{} }, func(ctx context.Context, req message) (message, error) {
+					return s.handshake(ctx, req.(*handshakeRequest))
+				}),
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "ExecuteStream",
+				Handler:       s.handleExecuteStream,
+				ServerStreams: true,
+			},
+		},
+		Metadata: "execute.proto",
+	}, s)
+}
+
+// handler returns the handler of a method. The request is decoded into the
+// message that newReq returns. The interceptor of the gRPC server is
+// supported.
+func handler(method string, newReq func() message, call func(ctx context.Context, req message) (message, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+
+		if interceptor == nil {
+			return call(ctx, req)
+		}
+
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: method,
+		}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(ctx, req.(message))
+		})
+	}
+}
+
+func (s *Server) execute(ctx context.Context, req *executeRequest) (*executeResponse, error) {
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	defer s.end()
+
+	results := make(mapreduce.Results)
+	resp, err := s.run(ctx, req, func(key string, value []byte) error {
+		results[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp.results = results
+	return s.signResponse(executeFields(req, 0, true), resp)
+}
+
+// run restores the values of the context that the coordinator shipped and
+// invokes the Executor, which emits each key as soon as it is reduced. The
+// response holds the counters, the accumulators and the record counts that
+// the calculation updated on the node.
+func (s *Server) run(ctx context.Context, req *executeRequest, emit func(key string, value []byte) error) (*executeResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := checkProtocol(req.protocolVersion); err != nil {
+		return nil, toStatus(err)
+	}
+
+	counters := mapreduce.NewCounters()
+	ctx = mapreduce.WithCounters(ctx, counters)
+	accumulators := mapreduce.NewAccumulators()
+	ctx = mapreduce.WithAccumulators(ctx, accumulators)
+	records := mapreduce.NewCounters()
+	ctx = mapreduce.WithRecordCounts(ctx, records)
+	ctx = mapreduce.WithSideInputs(ctx, req.sideInputs)
+	if req.split != nil {
+		ctx = mapreduce.WithSplit(ctx, *req.split)
+	}
+	ctx = mapreduce.WithBadRecordPolicy(ctx, req.badRecordPolicy)
+	ctx = mapreduce.WithQuarantinePrefix(ctx, req.quarantinePrefix)
+	if req.shuffle != nil {
+		ctx = mapreduce.WithShufflePlan(ctx, *req.shuffle)
+	}
+	if req.reduce != nil {
+		ctx = mapreduce.WithReducePlan(ctx, *req.reduce)
+	}
+
+	if req.algVersion != "" {
+		ctx = mapreduce.WithAlgorithmVersion(ctx, req.algVersion)
+	}
+
+	if req.idempotencyKey != "" {
+		ctx = mapreduce.WithIdempotencyKey(ctx, req.idempotencyKey)
+	}
+
+	if err := s.e.ExecuteStream(req.file, req.algName, ctx, req.meta, emit); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &executeResponse{
+		counters:     counters.Values(),
+		accumulators: accumulators.Values(),
+		records:      records.Values(),
+	}, nil
+}
@@ -0,0 +1,93 @@
+package grpcnet
+
+import (
+	"fmt"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Shuffle implements mapreduce.Shuffler.
+func (n *Network) Shuffle(jobID, task, nodeID string, ctx context.Context, values map[string][]byte) error {
+	req := &shuffleRequest{
+		jobID:  jobID,
+		task:   task,
+		values: values,
+	}
+	return n.call(nodeID, ctx, func(ctx context.Context, conn *grpc.ClientConn) error {
+		if !capabilitiesFrom(ctx).Supports(ShuffleFeature) {
+			return fmt.Errorf("node %s does not support shuffling", nodeID)
+		}
+		return conn.Invoke(ctx, shuffleMethod, req, &empty{}, grpc.CallContentSubtype(contentSubtype))
+	})
+}
+
+// Collect implements mapreduce.ShuffleNetwork.
+func (n *Network) Collect(jobID, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	req := &collectRequest{
+		jobID:   jobID,
+		algName: algName,
+		meta:    meta,
+	}
+	req.algVersion, _ = mapreduce.AlgorithmVersionFrom(ctx)
+	if plan, ok := mapreduce.ShufflePlanFrom(ctx); ok {
+		req.shuffle = &plan
+	}
+	if plan, ok := mapreduce.ReducePlanFrom(ctx); ok {
+		req.reduce = &plan
+	}
+
+	resp := &executeResponse{}
+	err := n.call(nodeID, ctx, func(ctx context.Context, conn *grpc.ClientConn) error {
+		if !capabilitiesFrom(ctx).Supports(ShuffleFeature) {
+			return fmt.Errorf("node %s does not support shuffling", nodeID)
+		}
+
+		req.protocolVersion = negotiatedProtocol(ctx)
+		if err := conn.Invoke(ctx, collectMethod, req, resp, grpc.CallContentSubtype(contentSubtype)); err != nil {
+			return err
+		}
+		return n.verifyResponse(nodeID, collectFields(req), resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.results, nil
+}
+
+func (s *Server) shuffle(ctx context.Context, req *shuffleRequest) (*empty, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	s.e.Receive(req.jobID, req.task, req.values)
+	return &empty{}, nil
+}
+
+func (s *Server) collect(ctx context.Context, req *collectRequest) (*executeResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := checkProtocol(req.protocolVersion); err != nil {
+		return nil, toStatus(err)
+	}
+
+	if req.shuffle != nil {
+		ctx = mapreduce.WithShufflePlan(ctx, *req.shuffle)
+	}
+	if req.reduce != nil {
+		ctx = mapreduce.WithReducePlan(ctx, *req.reduce)
+	}
+
+	if req.algVersion != "" {
+		ctx = mapreduce.WithAlgorithmVersion(ctx, req.algVersion)
+	}
+
+	result, err := s.e.Collect(req.jobID, req.algName, ctx, req.meta)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return s.signResponse(collectFields(req), &executeResponse{results: mapreduce.Results(result)})
+}
@@ -0,0 +1,200 @@
+package grpcnet
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Signer signs the digest of a result that the node sends to the
+// coordinator.
+type Signer func(digest []byte) (signature []byte, err error)
+
+// Verifier verifies the signature of the digest of a result that the given
+// node sent. A non-nil error rejects the result.
+type Verifier func(nodeID string, digest, signature []byte) error
+
+// WithSigner makes the Server sign each result (and each batch of a streamed
+// result) that it sends, for the coordinator's Network to verify (see
+// WithVerifier). The signature covers the request that the result answers,
+// so that a result cannot be passed off as the one of another file.
+func WithSigner(sign Signer) ServerOption {
+	return func(s *Server) {
+		s.sign = sign
+	}
+}
+
+// WithVerifier makes the Network verify the signature of each result that a
+// node sends (see WithSigner), so that results which traverse untrusted
+// networks cannot be tampered with undetected. A result with a missing or
+// invalid signature fails with a SignatureError.
+func WithVerifier(verify Verifier) Option {
+	return func(n *Network) {
+		n.verify = verify
+	}
+}
+
+// SignatureError is returned when the signature of a result is missing or
+// invalid (see WithVerifier).
+type SignatureError struct {
+	NodeID string
+	Err    error
+}
+
+// Error implements error.
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("invalid signature of node %s: %s", e.NodeID, e.Err)
+}
+
+// HMACSigner returns a Signer that signs with HMAC-SHA256 and the given key.
+func HMACSigner(key []byte) Signer {
+	return func(digest []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(digest)
+		return mac.Sum(nil), nil
+	}
+}
+
+// HMACVerifier returns a Verifier for the signatures of an HMACSigner with
+// the same key. Every node shares the key.
+func HMACVerifier(key []byte) Verifier {
+	sign := HMACSigner(key)
+	return func(nodeID string, digest, signature []byte) error {
+		expected, _ := sign(digest)
+		if !hmac.Equal(expected, signature) {
+			return fmt.Errorf("signature does not match")
+		}
+		return nil
+	}
+}
+
+// Ed25519Signer returns a Signer that signs with the node's private key.
+func Ed25519Signer(key ed25519.PrivateKey) Signer {
+	return func(digest []byte) ([]byte, error) {
+		return ed25519.Sign(key, digest), nil
+	}
+}
+
+// Ed25519Verifier returns a Verifier that checks the signatures against the
+// public key of each node.
+func Ed25519Verifier(keys map[string]ed25519.PublicKey) Verifier {
+	return func(nodeID string, digest, signature []byte) error {
+		key, ok := keys[nodeID]
+		if !ok {
+			return fmt.Errorf("unknown node")
+		}
+
+		if !ed25519.Verify(key, digest, signature) {
+			return fmt.Errorf("signature does not match")
+		}
+		return nil
+	}
+}
+
+// resultDigest returns the digest of a response that is signed. The
+// request lists what identifies the request (e.g., the file and split) and
+// the batch.
+func resultDigest(request []string, resp *executeResponse) []byte {
+	h := sha256.New()
+	var size [binary.MaxVarintLen64]byte
+	write := func(data []byte) {
+		h.Write(size[:binary.PutUvarint(size[:], uint64(len(data)))])
+		h.Write(data)
+	}
+
+	for _, field := range request {
+		write([]byte(field))
+	}
+
+	// Each map is preceded by its length, so that an entry can not move
+	// from one map to the next without changing the digest.
+	write([]byte(fmt.Sprint(len(resp.results))))
+	keys := make([]string, 0, len(resp.results))
+	for key := range resp.results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		write([]byte(key))
+		write(resp.results[key])
+	}
+
+	for _, values := range []map[string]int64{resp.counters, resp.accumulators.Sums, resp.accumulators.Maxes, resp.records} {
+		write([]byte(fmt.Sprint(len(values))))
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			write([]byte(name))
+			write([]byte(fmt.Sprint(values[name])))
+		}
+	}
+
+	names := make([]string, 0, len(resp.accumulators.Sets))
+	for name := range resp.accumulators.Sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		members := resp.accumulators.Sets[name]
+		write([]byte(name))
+		write([]byte(fmt.Sprint(len(members))))
+		for _, member := range members {
+			write([]byte(member))
+		}
+	}
+	return h.Sum(nil)
+}
+
+// executeFields identifies an execute request for the digest of a batch of
+// its result. The last batch is marked, so that a truncated stream is
+// detected.
+func executeFields(req *executeRequest, batch int, last bool) []string {
+	fields := []string{"execute", req.file, req.algName, fmt.Sprint(batch, last)}
+	if req.split != nil {
+		fields = append(fields, fmt.Sprint(req.split.Start, req.split.End))
+	}
+	return fields
+}
+
+// collectFields identifies a collect request for the digest of its result.
+func collectFields(req *collectRequest) []string {
+	return []string{"collect", req.jobID, req.algName}
+}
+
+// signResponse signs the response, if the Server has a Signer.
+func (s *Server) signResponse(request []string, resp *executeResponse) (*executeResponse, error) {
+	if s.sign == nil {
+		return resp, nil
+	}
+
+	signature, err := s.sign(resultDigest(request, resp))
+	if err != nil {
+		return nil, err
+	}
+	resp.signature = signature
+	return resp, nil
+}
+
+// verifyResponse verifies the signature of the response, if the Network has
+// a Verifier.
+func (n *Network) verifyResponse(nodeID string, request []string, resp *executeResponse) error {
+	if n.verify == nil {
+		return nil
+	}
+
+	if len(resp.signature) == 0 {
+		return &SignatureError{NodeID: nodeID, Err: fmt.Errorf("result is not signed")}
+	}
+
+	if err := n.verify(nodeID, resultDigest(request, resp), resp.signature); err != nil {
+		return &SignatureError{NodeID: nodeID, Err: err}
+	}
+	return nil
+}
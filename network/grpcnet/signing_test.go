@@ -0,0 +1,145 @@
+package grpcnet_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TSG struct {
+	*testing.T
+	executor *mapreduce.Executor
+	servers  []*grpc.Server
+}
+
+func TestSigning(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TSG {
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"), []byte("y"), []byte("z"))
+
+		return TSG{
+			T:        t,
+			executor: mapreduce.NewExecutor(algs, fs),
+		}
+	})
+
+	o.AfterEach(func(t TSG) {
+		for _, gs := range t.servers {
+			gs.Stop()
+		}
+	})
+
+	network := func(t *TSG, sign grpcnet.Signer, verify grpcnet.Verifier) *grpcnet.Network {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var opts []grpcnet.ServerOption
+		if sign != nil {
+			opts = append(opts, grpcnet.WithSigner(sign))
+		}
+		opts = append(opts, grpcnet.WithBatchSize(1))
+
+		gs := grpc.NewServer()
+		grpcnet.NewServer(t.executor, opts...).Register(gs)
+		go gs.Serve(lis)
+		t.servers = append(t.servers, gs)
+
+		return grpcnet.New(
+			grpcnet.WithAddrMapping(func(string) string { return lis.Addr().String() }),
+			grpcnet.WithVerifier(verify),
+		)
+	}
+
+	expectResult := func(t TSG, n *grpcnet.Network) {
+		result, err := n.Execute("file", "identity", "id-a", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result).To(HaveLen(3))
+
+		streamed := make(map[string][]byte)
+		err = n.ExecuteStream("file", "identity", "id-a", context.Background(), nil, func(batch map[string][]byte) {
+			for key, value := range batch {
+				streamed[key] = value
+			}
+		})
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, streamed).To(Equal(result))
+	}
+
+	expectSignatureError := func(t TSG, n *grpcnet.Network) {
+		_, err := n.Execute("file", "identity", "id-a", context.Background(), nil)
+		_, ok := err.(*grpcnet.SignatureError)
+		Expect(t, ok).To(BeTrue())
+
+		err = n.ExecuteStream("file", "identity", "id-a", context.Background(), nil, func(map[string][]byte) {})
+		_, ok = err.(*grpcnet.SignatureError)
+		Expect(t, ok).To(BeTrue())
+	}
+
+	o.Spec("it accepts results signed with the shared key", func(t TSG) {
+		n := network(&t, grpcnet.HMACSigner([]byte("key")), grpcnet.HMACVerifier([]byte("key")))
+		defer n.Close()
+		expectResult(t, n)
+	})
+
+	o.Spec("it rejects results signed with another key", func(t TSG) {
+		n := network(&t, grpcnet.HMACSigner([]byte("other")), grpcnet.HMACVerifier([]byte("key")))
+		defer n.Close()
+		expectSignatureError(t, n)
+	})
+
+	o.Spec("it rejects results that are not signed", func(t TSG) {
+		n := network(&t, nil, grpcnet.HMACVerifier([]byte("key")))
+		defer n.Close()
+		expectSignatureError(t, n)
+	})
+
+	o.Spec("it verifies results signed with the node's private key", func(t TSG) {
+		public, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := network(&t, grpcnet.Ed25519Signer(private), grpcnet.Ed25519Verifier(map[string]ed25519.PublicKey{
+			"id-a": public,
+		}))
+		defer n.Close()
+		expectResult(t, n)
+	})
+
+	o.Spec("it rejects results of a node without a public key", func(t TSG) {
+		_, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := network(&t, grpcnet.Ed25519Signer(private), grpcnet.Ed25519Verifier(nil))
+		defer n.Close()
+		expectSignatureError(t, n)
+	})
+}
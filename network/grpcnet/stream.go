@@ -0,0 +1,169 @@
+package grpcnet
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// WithBatchSize sets the number of keys the Server sends per message of a
+// streamed result (see Network.ExecuteStream). It defaults to 1000.
+func WithBatchSize(n int) ServerOption {
+	return func(s *Server) {
+		s.batchSize = n
+	}
+}
+
+var streamDesc = grpc.StreamDesc{
+	StreamName:    "ExecuteStream",
+	ServerStreams: true,
+}
+
+// ExecuteStream implements mapreduce.StreamNetwork. The node sends the
+// result in batches (see WithBatchSize), so that no single message has to
+// hold all of it. A replayed call (see WithRetry) emits the keys again. A
+// node that does not support streaming sends the result at once.
+func (n *Network) ExecuteStream(file, algName, nodeID string, ctx context.Context, meta []byte, emit func(result map[string][]byte)) error {
+	var (
+		counters     *mapreduce.Counters
+		accumulators *mapreduce.Accumulators
+		records      *mapreduce.Counters
+	)
+	err := n.call(nodeID, ctx, func(ctx context.Context, conn *grpc.ClientConn) error {
+		counters = mapreduce.NewCounters()
+		accumulators = mapreduce.NewAccumulators()
+		records = mapreduce.NewCounters()
+		req := newExecuteRequest(file, algName, ctx, meta)
+		if !capabilitiesFrom(ctx).Supports(StreamingFeature) {
+			resp := &executeResponse{}
+			if err := conn.Invoke(ctx, executeMethod, req, resp, grpc.CallContentSubtype(contentSubtype)); err != nil {
+				return err
+			}
+
+			if err := n.verifyResponse(nodeID, executeFields(req, 0, true), resp); err != nil {
+				return err
+			}
+
+			emit(resp.results)
+			counters.Merge(resp.counters)
+			accumulators.MergeValues(resp.accumulators)
+			records.Merge(resp.records)
+			return nil
+		}
+
+		stream, err := conn.NewStream(ctx, &streamDesc, streamMethod, grpc.CallContentSubtype(contentSubtype))
+		if err != nil {
+			return err
+		}
+
+		if err := stream.SendMsg(req); err != nil {
+			return err
+		}
+
+		if err := stream.CloseSend(); err != nil {
+			return err
+		}
+
+		var (
+			batch int
+			last  bool
+		)
+		for {
+			resp := &executeResponse{}
+			err := stream.RecvMsg(resp)
+			if err == io.EOF {
+				if n.verify != nil && !last {
+					return &SignatureError{NodeID: nodeID, Err: fmt.Errorf("result ended before its last batch")}
+				}
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if n.verify != nil {
+				if last {
+					return &SignatureError{NodeID: nodeID, Err: fmt.Errorf("result continued after its last batch")}
+				}
+
+				if err := n.verifyResponse(nodeID, executeFields(req, batch, false), resp); err != nil {
+					if n.verifyResponse(nodeID, executeFields(req, batch, true), resp) != nil {
+						return err
+					}
+					last = true
+				}
+			}
+			batch++
+
+			emit(resp.results)
+			counters.Merge(resp.counters)
+			accumulators.MergeValues(resp.accumulators)
+			records.Merge(resp.records)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if c := mapreduce.CountersFrom(ctx); c != nil {
+		c.Merge(counters.Values())
+	}
+
+	if a := mapreduce.AccumulatorsFrom(ctx); a != nil {
+		a.Merge(accumulators)
+	}
+
+	if c := mapreduce.RecordCountsFrom(ctx); c != nil {
+		c.Merge(records.Values())
+	}
+	return nil
+}
+
+// handleExecuteStream sends the result in batches as the Executor reduces
+// its keys. The counters, the accumulators and the record counts are sent
+// with the last one. Each batch is signed on its own (see WithSigner).
+func (s *Server) handleExecuteStream(srv interface{}, stream grpc.ServerStream) error {
+	req := &executeRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+
+	var sent int
+	send := func(resp *executeResponse, last bool) error {
+		resp, err := s.signResponse(executeFields(req, sent, last), resp)
+		if err != nil {
+			return err
+		}
+		sent++
+		return stream.SendMsg(resp)
+	}
+
+	batch := make(mapreduce.Results)
+	resp, err := s.run(stream.Context(), req, func(key string, value []byte) error {
+		batch[key] = value
+		if s.batchSize <= 0 || len(batch) < s.batchSize {
+			return nil
+		}
+
+		if err := send(&executeResponse{results: batch}, false); err != nil {
+			return err
+		}
+		batch = make(mapreduce.Results)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resp.results = batch
+	return send(resp, true)
+}
@@ -0,0 +1,57 @@
+package grpcnet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// WithTLS encrypts the connections to the nodes. The config sets the
+// certificate authorities that are trusted (RootCAs), the name the
+// certificate of each node has to be valid for (ServerName, which is also
+// sent via SNI) and, for mutual TLS, the certificate of the coordinator
+// (Certificates). The ServerName defaults to the host of each node's address.
+func WithTLS(config *tls.Config) Option {
+	return WithDialOptions(grpc.WithTransportCredentials(credentials.NewTLS(config)))
+}
+
+// ServerTLS returns the option that makes a gRPC server only accept
+// encrypted connections. Set the ClientAuth of the config to
+// tls.RequireAndVerifyClientCert (and ClientCAs) for mutual TLS, so that
+// only coordinators with a trusted certificate can connect.
+func ServerTLS(config *tls.Config) grpc.ServerOption {
+	return grpc.Creds(credentials.NewTLS(config))
+}
+
+// LoadTLSConfig returns a config with the certificate and key from the given
+// PEM files. The certificate authorities of the PEM file caFile are trusted
+// both as RootCAs and as ClientCAs, and client certificates are required,
+// so the config can be used for mutual TLS by both WithTLS and ServerTLS.
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package grpcnet_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/mapreduce/network/grpcnet"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+	"google.golang.org/grpc"
+)
+
+type TT struct {
+	*testing.T
+	dir    string
+	addr   string
+	config *tls.Config
+	server *grpc.Server
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TT {
+		dir, err := ioutil.TempDir("", "grpcnet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeCerts(t, dir)
+
+		config, err := grpcnet.LoadTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("file", []byte("x"))
+		algs := mapreduce.AlgFetcherMap{
+			"identity": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gs := grpc.NewServer(grpcnet.ServerTLS(config))
+		grpcnet.NewServer(mapreduce.NewExecutor(algs, fs)).Register(gs)
+		go gs.Serve(lis)
+
+		return TT{
+			T:      t,
+			dir:    dir,
+			addr:   lis.Addr().String(),
+			config: config,
+			server: gs,
+		}
+	})
+
+	o.AfterEach(func(t TT) {
+		t.server.Stop()
+		os.RemoveAll(t.dir)
+	})
+
+	o.Spec("it calculates over mutual TLS", func(t TT) {
+		network := grpcnet.New(grpcnet.WithTLS(t.config))
+		defer network.Close()
+
+		result, err := network.Execute("file", "identity", t.addr, context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, result).To(Equal(map[string][]byte{"x": []byte("x")}))
+	})
+
+	o.Spec("it rejects a coordinator without a certificate", func(t TT) {
+		network := grpcnet.New(grpcnet.WithTLS(&tls.Config{RootCAs: t.config.RootCAs}))
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", t.addr, context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it does not connect without TLS", func(t TT) {
+		network := grpcnet.New()
+		defer network.Close()
+
+		_, err := network.Execute("file", "identity", t.addr, context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+// writeCerts writes a certificate authority and a certificate for 127.0.0.1
+// that it signed.
+func writeCerts(t *testing.T, dir string) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", caDER)
+	writePEM(t, filepath.Join(dir, "cert.pem"), "CERTIFICATE", certDER)
+	writePEM(t, filepath.Join(dir, "key.pem"), "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package grpcnet
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/poy/mapreduce"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// protocolVersion is the version of the messages in execute.proto. It has
+// to change whenever a change is not compatible with older nodes. Nodes and
+// coordinators also speak the previous version (minProtocolVersion), so that
+// they can be upgraded independently. Version 2 added the handshake (see
+// Network.Capabilities).
+const (
+	protocolVersion    = 2
+	minProtocolVersion = 1
+)
+
+// versionMismatchReason marks the status of a mapreduce.VersionMismatchError.
+const versionMismatchReason = "VERSION_MISMATCH"
+
+// checkProtocol returns a mapreduce.VersionMismatchError if the coordinator
+// speaks a version of the protocol that the node does not.
+func checkProtocol(version string) error {
+	v, err := strconv.Atoi(version)
+	if err == nil && v >= minProtocolVersion && v <= protocolVersion {
+		return nil
+	}
+
+	return &mapreduce.VersionMismatchError{
+		Name:        "grpcnet protocol",
+		Coordinator: version,
+		Node:        fmt.Sprintf("%d-%d", minProtocolVersion, protocolVersion),
+	}
+}
+
+// toStatus converts a mapreduce.VersionMismatchError into a status that
+// keeps its fields, so that the Network can restore it.
+func toStatus(err error) error {
+	mismatch, ok := err.(*mapreduce.VersionMismatchError)
+	if !ok {
+		return err
+	}
+
+	s, detailsErr := status.New(codes.FailedPrecondition, err.Error()).WithDetails(&errdetails.ErrorInfo{
+		Reason: versionMismatchReason,
+		Domain: serviceName,
+		Metadata: map[string]string{
+			"name":        mismatch.Name,
+			"coordinator": mismatch.Coordinator,
+			"node":        mismatch.Node,
+		},
+	})
+	if detailsErr != nil {
+		return err
+	}
+	return s.Err()
+}
+
+// fromStatus restores a mapreduce.VersionMismatchError that was converted
+// by toStatus.
+func fromStatus(err error) error {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.FailedPrecondition {
+		return err
+	}
+
+	for _, detail := range s.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Reason != versionMismatchReason {
+			continue
+		}
+
+		return &mapreduce.VersionMismatchError{
+			Name:        info.Metadata["name"],
+			Coordinator: info.Metadata["coordinator"],
+			Node:        info.Metadata["node"],
+		}
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package grpcnet
+
+import (
+	"github.com/poy/mapreduce"
+	"golang.org/x/net/context"
+)
+
+// WithZone advertises the zone of the node in its Capabilities (see
+// mapreduce.Zones for how zones are named).
+func WithZone(zone string) ServerOption {
+	return func(s *Server) {
+		s.zone = zone
+	}
+}
+
+// Zones returns a mapreduce.Zones that reports the zone that each of the
+// given nodes advertises (see WithZone). Nodes that cannot be reached or do
+// not advertise a zone are left out, so they are in an unknown zone.
+func (n *Network) Zones(nodeIDs ...string) mapreduce.Zones {
+	return mapreduce.ZonesFunc(func(ctx context.Context) (map[string]string, error) {
+		zones := make(map[string]string)
+		for _, nodeID := range nodeIDs {
+			caps, err := n.Capabilities(nodeID, ctx)
+			if err != nil || caps.Zone == "" {
+				continue
+			}
+			zones[nodeID] = caps.Zone
+		}
+		return zones, nil
+	})
+}
@@ -0,0 +1,45 @@
+package mapreduce
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NodeFailure is implemented by the errors of a Network that mean the node
+// failed instead of the calculation (e.g., the node crashed or could not be
+// reached). Only files whose node failed are re-dispatched to the other nodes
+// that have them, and only those failures count against the node (see
+// WithBlacklist). Any other error (e.g., of the Mapper) fails the file right
+// away, as it would fail on every node.
+type NodeFailure interface {
+	error
+
+	// NodeFailure marks the error.
+	NodeFailure()
+}
+
+// NodeError is a NodeFailure for Networks that do not have their own error
+// types.
+type NodeError struct {
+	NodeID string
+	Err    error
+}
+
+// Error implements error.
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("node %s failed: %s", e.NodeID, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// NodeFailure implements NodeFailure.
+func (e *NodeError) NodeFailure() {}
+
+// isNodeFailure reports whether the error means the node failed.
+func isNodeFailure(err error) bool {
+	var f NodeFailure
+	return errors.As(err, &f)
+}
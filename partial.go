@@ -0,0 +1,47 @@
+package mapreduce
+
+import "fmt"
+
+// WithPartialResults keeps calculating when files (or splits) fail on every
+// node that has them, as long as at least minFraction of them succeed. The
+// result is then reduced from the files that succeeded and returned along
+// with a PartialResultsError that lists the missing ones. Once more files
+// failed than minFraction allows, the calculation fails with the
+// PartialResultsError alone. By default any failed file fails the
+// calculation.
+func WithPartialResults(minFraction float64) MapReduceOption {
+	return func(r *MapReduce) {
+		r.partialResults = minFraction
+	}
+}
+
+// MissingFile is a file (or split) that is missing from partial results.
+type MissingFile struct {
+	File  string
+	Split *Split
+	Err   error
+}
+
+// PartialResultsError is returned when files failed (see
+// WithPartialResults).
+type PartialResultsError struct {
+	// Missing holds the files that failed.
+	Missing []MissingFile
+
+	// Total is the number of files of the calculation.
+	Total int
+}
+
+// Error implements error.
+func (e *PartialResultsError) Error() string {
+	return fmt.Sprintf("%d of %d files failed, first: %s", len(e.Missing), e.Total, e.Missing[0].Err)
+}
+
+// tolerates reports whether the calculation may go on with the given number
+// of failed files.
+func (r MapReduce) tolerates(failed, total int) bool {
+	if r.partialResults <= 0 {
+		return false
+	}
+	return float64(total-failed) >= r.partialResults*float64(total)
+}
@@ -0,0 +1,28 @@
+package mapreduce
+
+import "strings"
+
+// WithPartitionFilter prunes the files of a partitioned dataset before any
+// of them is read. Each file is passed to the filter with the partition
+// values of its path (see Partitions) and is only calculated if the filter
+// returns true.
+func WithPartitionFilter(f func(partitions map[string]string) bool) MapReduceOption {
+	return func(r *MapReduce) {
+		r.partitionFilter = f
+	}
+}
+
+// Partitions returns the partition values of a file. They are read from the
+// path elements of the form key=value, e.g. "events/dt=2017-01-02/hour=03/a"
+// has the partitions dt=2017-01-02 and hour=03.
+func Partitions(file string) map[string]string {
+	partitions := make(map[string]string)
+	for _, element := range strings.Split(file, "/") {
+		i := strings.Index(element, "=")
+		if i <= 0 {
+			continue
+		}
+		partitions[element[:i]] = element[i+1:]
+	}
+	return partitions
+}
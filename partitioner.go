@@ -0,0 +1,128 @@
+package mapreduce
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Partitioner decides which node is responsible for a key, e.g. the node
+// that reduces it. It has to be safe for concurrent use.
+type Partitioner interface {
+	// Partition returns the node of the given ones that is responsible for
+	// the key.
+	Partition(key string, nodeIDs []string) string
+}
+
+// PartitionerFunc wraps a function into a Partitioner.
+type PartitionerFunc func(key string, nodeIDs []string) string
+
+// Partition implements Partitioner.
+func (f PartitionerFunc) Partition(key string, nodeIDs []string) string {
+	return f(key, nodeIDs)
+}
+
+// HashPartitioner assigns each key to a node by the hash of the key modulo
+// the number of nodes. Almost every key moves to another node when the nodes
+// change, see ConsistentHash for a Partitioner that avoids that.
+var HashPartitioner = PartitionerFunc(func(key string, nodeIDs []string) string {
+	if len(nodeIDs) == 0 {
+		return ""
+	}
+	return nodeIDs[hash(key)%uint64(len(nodeIDs))]
+})
+
+// ConsistentHash is a Partitioner that places the nodes on a hash ring and
+// assigns each key to the first node that follows the hash of the key. When
+// a node joins or leaves, only the keys of the ring segments next to it move,
+// so most keys stay with the same node between calculations.
+//
+// It should be created with NewConsistentHash().
+type ConsistentHash struct {
+	replicas int
+
+	mu    sync.Mutex
+	rings map[string]*ring
+}
+
+// ring is the hash ring of a set of nodes.
+type ring struct {
+	hashes []uint64
+	nodes  map[uint64]string
+}
+
+// NewConsistentHash returns a new ConsistentHash. Each node is placed on the
+// ring the given number of times, more replicas spread the keys more evenly.
+func NewConsistentHash(replicas int) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = 1
+	}
+
+	return &ConsistentHash{
+		replicas: replicas,
+		rings:    make(map[string]*ring),
+	}
+}
+
+// Partition implements Partitioner.
+func (c *ConsistentHash) Partition(key string, nodeIDs []string) string {
+	if len(nodeIDs) == 0 {
+		return ""
+	}
+
+	r := c.ring(nodeIDs)
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// ring returns the ring of the nodes. The ring of the most recent set of
+// nodes is kept, as the nodes rarely change between calls.
+func (c *ConsistentHash) ring(nodeIDs []string) *ring {
+	sorted := append([]string(nil), nodeIDs...)
+	sort.Strings(sorted)
+	id := strings.Join(sorted, "\x00")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r, ok := c.rings[id]; ok {
+		return r
+	}
+
+	r := &ring{nodes: make(map[uint64]string)}
+	for _, nodeID := range sorted {
+		for i := 0; i < c.replicas; i++ {
+			h := hash(fmt.Sprintf("%s#%d", nodeID, i))
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = nodeID
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+
+	c.rings = map[string]*ring{id: r}
+	return r
+}
+
+// hash returns the FNV-1a hash of the string. It is mixed further, as
+// FNV-1a alone spreads similar strings (like the replicas of a node) poorly.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
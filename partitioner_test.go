@@ -0,0 +1,67 @@
+package mapreduce_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TP struct {
+	*testing.T
+	keys []string
+}
+
+func TestPartitioner(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TP {
+		var keys []string
+		for i := 0; i < 1000; i++ {
+			keys = append(keys, fmt.Sprintf("key-%d", i))
+		}
+		return TP{T: t, keys: keys}
+	})
+
+	o.Spec("it assigns each key to one of the nodes", func(t TP) {
+		nodeIDs := []string{"id-a", "id-b", "id-c"}
+		for _, p := range []mapreduce.Partitioner{mapreduce.HashPartitioner, mapreduce.NewConsistentHash(100)} {
+			counts := make(map[string]int)
+			for _, key := range t.keys {
+				counts[p.Partition(key, nodeIDs)]++
+			}
+
+			Expect(t, counts).To(HaveLen(3))
+			for _, nodeID := range nodeIDs {
+				Expect(t, counts[nodeID] > 200).To(BeTrue())
+			}
+		}
+	})
+
+	o.Spec("it does not depend on the order of the nodes", func(t TP) {
+		p := mapreduce.NewConsistentHash(100)
+		for _, key := range t.keys {
+			Expect(t, p.Partition(key, []string{"id-a", "id-b", "id-c"})).To(Equal(p.Partition(key, []string{"id-c", "id-a", "id-b"})))
+		}
+	})
+
+	o.Spec("it keeps most keys on the same node when a node joins", func(t TP) {
+		p := mapreduce.NewConsistentHash(100)
+
+		var moved int
+		for _, key := range t.keys {
+			before := p.Partition(key, []string{"id-a", "id-b", "id-c", "id-d"})
+			after := p.Partition(key, []string{"id-a", "id-b", "id-c", "id-d", "id-e"})
+			if before != after {
+				Expect(t, after).To(Equal("id-e"))
+				moved++
+			}
+		}
+		Expect(t, moved < 350).To(BeTrue())
+	})
+}
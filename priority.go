@@ -0,0 +1,214 @@
+package mapreduce
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// PreemptedFilesCounter is the counter of the files (or splits) of a
+// calculation that were preempted by a calculation of a higher priority
+// (see WithPriority).
+const PreemptedFilesCounter = "mapreduce.preempted-files"
+
+// WithNodePool limits how many files (or splits) the calculations that share
+// the NodePool run on each node at once.
+func WithNodePool(p *NodePool) MapReduceOption {
+	return func(r *MapReduce) {
+		r.pool = p
+	}
+}
+
+// WithPriority sets the priority of a calculation within its NodePool (see
+// WithNodePool). Higher values are more important, and the default is 0.
+// When every slot of a node is taken, a calculation preempts a file of a
+// calculation with a lower priority. The preempted file is canceled on the
+// node and queued again, so it is calculated once a slot frees up.
+func WithPriority(priority int) MapReduceOption {
+	return func(r *MapReduce) {
+		r.priority = priority
+	}
+}
+
+// NodePool hands out the slots of the nodes to the files of the calculations
+// that share it. A file that has to wait for a slot is queued, and the slot
+// that frees up goes to the queued file of the highest priority. Queued files
+// gain a priority for every aging interval they wait, so that calculations
+// of a low priority are not starved. Aging only affects the order of the
+// queue, files are only preempted by a higher priority of their own. It is
+// safe for concurrent use.
+//
+// It should be created with NewNodePool().
+type NodePool struct {
+	slots int
+	aging time.Duration
+
+	mu      sync.Mutex
+	running map[string][]*poolSlot
+	waiting map[string][]*poolSlot
+}
+
+// poolSlot is a slot of a node that is taken (or waited for) by a file.
+type poolSlot struct {
+	nodeID    string
+	priority  int
+	since     time.Time
+	cancel    context.CancelFunc
+	granted   chan struct{}
+	preempted bool
+}
+
+// NewNodePool returns a new NodePool with the given number of slots per
+// node. An aging interval of 0 disables aging.
+func NewNodePool(slots int, aging time.Duration) *NodePool {
+	return &NodePool{
+		slots:   slots,
+		aging:   aging,
+		running: make(map[string][]*poolSlot),
+		waiting: make(map[string][]*poolSlot),
+	}
+}
+
+// acquire waits for a slot of the node. The returned context is canceled if
+// the slot is preempted. The slot has to be released once the file is done.
+func (p *NodePool) acquire(nodeID string, priority int, ctx context.Context) (*poolSlot, context.Context, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &poolSlot{
+		nodeID:   nodeID,
+		priority: priority,
+		since:    time.Now(),
+		cancel:   cancel,
+		granted:  make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	if len(p.running[nodeID]) < p.slots {
+		p.running[nodeID] = append(p.running[nodeID], s)
+		p.mu.Unlock()
+		return s, ctx, nil
+	}
+
+	p.preempt(nodeID, priority)
+	p.waiting[nodeID] = append(p.waiting[nodeID], s)
+	p.mu.Unlock()
+
+	select {
+	case <-s.granted:
+		return s, ctx, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		queued := p.remove(p.waiting, s)
+		p.mu.Unlock()
+
+		if !queued {
+			// The slot was granted in the meantime.
+			p.release(s)
+		}
+		cancel()
+		return nil, nil, ctx.Err()
+	}
+}
+
+// preempt cancels the running slot of the lowest priority below the given
+// one. The lock has to be held.
+func (p *NodePool) preempt(nodeID string, priority int) {
+	var victim *poolSlot
+	for _, s := range p.running[nodeID] {
+		if s.preempted || s.priority >= priority {
+			continue
+		}
+
+		if victim == nil || s.priority < victim.priority {
+			victim = s
+		}
+	}
+
+	if victim == nil {
+		return
+	}
+	victim.preempted = true
+	victim.cancel()
+}
+
+// release frees the slot and hands it to the queued file of the highest
+// priority. It reports whether the slot was preempted.
+func (p *NodePool) release(s *poolSlot) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s.cancel()
+	p.remove(p.running, s)
+
+	waiting := p.waiting[s.nodeID]
+	if len(waiting) > 0 && len(p.running[s.nodeID]) < p.slots {
+		next := p.next(waiting)
+		p.remove(p.waiting, next)
+		p.running[s.nodeID] = append(p.running[s.nodeID], next)
+		close(next.granted)
+	}
+	return s.preempted
+}
+
+// next returns the queued slot of the highest priority, including the
+// priority it gained by aging. The lock has to be held.
+func (p *NodePool) next(waiting []*poolSlot) *poolSlot {
+	now := time.Now()
+	effective := func(s *poolSlot) int {
+		if p.aging <= 0 {
+			return s.priority
+		}
+		return s.priority + int(now.Sub(s.since)/p.aging)
+	}
+
+	best := waiting[0]
+	for _, s := range waiting[1:] {
+		if effective(s) > effective(best) {
+			best = s
+		}
+	}
+	return best
+}
+
+// remove removes the slot from the node's slots. It reports whether the slot
+// was found. The lock has to be held.
+func (p *NodePool) remove(slots map[string][]*poolSlot, s *poolSlot) bool {
+	list := slots[s.nodeID]
+	for i, other := range list {
+		if other == s {
+			slots[s.nodeID] = append(list[:i:i], list[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// executePooled executes the file on the node once the NodePool hands out a
+// slot. A file that is preempted is queued again, and the batches it emitted
+// are discarded.
+func (r MapReduce) executePooled(file, algName, nodeID string, ctx context.Context, meta []byte, sink *fileSink) error {
+	emit := func(batch map[string][]byte) {
+		sink.emit(nodeID, batch)
+	}
+
+	if r.pool == nil {
+		return r.executeTimed(file, algName, nodeID, ctx, meta, emit)
+	}
+
+	for {
+		slot, slotCtx, err := r.pool.acquire(nodeID, r.priority, ctx)
+		if err != nil {
+			return err
+		}
+
+		err = r.executeTimed(file, algName, nodeID, slotCtx, meta, emit)
+		if !r.pool.release(slot) || err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		sink.discard()
+
+		IncCounter(ctx, PreemptedFilesCounter)
+		r.log.Printf("Calculation for file %s on %s was preempted, queuing it again", file, nodeID)
+	}
+}
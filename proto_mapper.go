@@ -0,0 +1,18 @@
+package mapreduce
+
+import "google.golang.org/protobuf/proto"
+
+// ProtoMapper returns a Mapper for records that hold encoded protobuf
+// messages, such as the records of a varint length-delimited stream (see
+// records.LengthPrefixed). Each record is unmarshaled into a new message of
+// the same type as the given one and handed to f. A record that cannot be
+// unmarshaled is a bad record (see WithBadRecords).
+func ProtoMapper(message proto.Message, f func(message proto.Message) (key string, output []byte, err error)) Mapper {
+	return MapFunc(func(value []byte) (string, []byte, error) {
+		m := message.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(value, m); err != nil {
+			return "", nil, err
+		}
+		return f(m)
+	})
+}
@@ -0,0 +1,131 @@
+package mapreduce
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"golang.org/x/net/context"
+)
+
+type quarantinePrefixKey struct{}
+
+// QuarantinedRecord is a bad record that was written to the quarantine (see
+// WithQuarantine). Each record of a quarantine file is a QuarantinedRecord
+// encoded as JSON.
+type QuarantinedRecord struct {
+	// File is the file the record was read from.
+	File string `json:"file"`
+
+	// Split is the split of the file that was read, if any.
+	Split *Split `json:"split,omitempty"`
+
+	// Record is the index of the record within the file. If Split is set,
+	// it is relative to the split instead: the first record that starts at
+	// or after Split.Start has the index 0. The byte offset of the record is
+	// not stored, as the readers of a FileSystem do not report it.
+	Record uint64 `json:"record"`
+
+	// Data holds the raw record.
+	Data []byte `json:"data"`
+
+	// Err describes why the record is bad.
+	Err string `json:"err"`
+}
+
+// WithQuarantine skips bad records like SkipBadRecords and also writes each
+// of them to the quarantine via the FileSystem, so that they can be
+// inspected and calculated again later. The bad records of each file are
+// written to a file of the same name below the given prefix. The FileSystem
+// has to be a WriteFileSystem.
+func WithQuarantine(prefix string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.badRecords = QuarantineBadRecords
+		r.quarantinePrefix = prefix
+	}
+}
+
+// QuarantinePrefixFrom returns the prefix of the quarantine files that is
+// stored in the context. A Network implementation uses it to ship the prefix
+// to the remote node.
+func QuarantinePrefixFrom(ctx context.Context) string {
+	prefix, _ := ctx.Value(quarantinePrefixKey{}).(string)
+	return prefix
+}
+
+// WithQuarantinePrefix returns a context that stores the given prefix of the
+// quarantine files. A Network implementation uses it on the remote node
+// before invoking the Executor.
+func WithQuarantinePrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, quarantinePrefixKey{}, prefix)
+}
+
+// quarantine writes the bad records of a file. The quarantine file is only
+// created once there is a bad record.
+type quarantine struct {
+	fs    FileSystem
+	file  string
+	split *Split
+	ctx   context.Context
+	meta  []byte
+
+	writer func([]byte) error
+	close  func() error
+}
+
+func newQuarantine(fs FileSystem, file string, ctx context.Context, meta []byte) *quarantine {
+	q := &quarantine{
+		fs:   fs,
+		file: file,
+		ctx:  ctx,
+		meta: meta,
+	}
+
+	if split, ok := SplitFrom(ctx); ok {
+		q.split = &split
+	}
+
+	return q
+}
+
+// add writes the bad record to the quarantine.
+func (q *quarantine) add(record uint64, data []byte, err error) error {
+	if q.writer == nil {
+		fs, ok := q.fs.(WriteFileSystem)
+		if !ok {
+			return fmt.Errorf("file system does not support writing the quarantine")
+		}
+
+		name := path.Join(QuarantinePrefixFrom(q.ctx), q.file)
+		if q.split != nil {
+			name = fmt.Sprintf("%s.%d-%d", name, q.split.Start, q.split.End)
+		}
+
+		writer, close, err := fs.Writer(name, q.ctx, q.meta)
+		if err != nil {
+			return err
+		}
+		q.writer, q.close = writer, close
+	}
+
+	encoded, jsonErr := json.Marshal(QuarantinedRecord{
+		File:   q.file,
+		Split:  q.split,
+		Record: record,
+		Data:   data,
+		Err:    err.Error(),
+	})
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	return q.writer(encoded)
+}
+
+// finish closes the quarantine file if it was created.
+func (q *quarantine) finish() error {
+	if q.close == nil {
+		return nil
+	}
+	return q.close()
+}
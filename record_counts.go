@@ -0,0 +1,34 @@
+package mapreduce
+
+import "golang.org/x/net/context"
+
+type recordCountsKey struct{}
+
+// RecordCountsFrom returns the Counters stored in the context that hold the
+// number of records mapped to each key (see ResultMeta.Records). It returns
+// nil if there are none.
+func RecordCountsFrom(ctx context.Context) *Counters {
+	c, _ := ctx.Value(recordCountsKey{}).(*Counters)
+	return c
+}
+
+// WithRecordCounts returns a context that stores the given Counters for the
+// number of records mapped to each key. A Network implementation uses it on
+// the remote node before invoking the Executor and then merges the resulting
+// values into the coordinator's, like it does for WithCounters.
+func WithRecordCounts(ctx context.Context, c *Counters) context.Context {
+	return context.WithValue(ctx, recordCountsKey{}, c)
+}
+
+// countRecords adds the number of values of each key to the record counts
+// of the calculation.
+func countRecords(ctx context.Context, m map[string][][]byte) {
+	c := RecordCountsFrom(ctx)
+	if c == nil {
+		return
+	}
+
+	for key, values := range m {
+		c.Add(key, int64(len(values)))
+	}
+}
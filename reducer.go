@@ -1,5 +1,11 @@
 package mapreduce
 
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
 // Reducer reduces a slice data points into a smaller set.
 type Reducer interface {
 	// Reduce is called with marshalled data either from a mapper or
@@ -16,3 +22,90 @@ type ReduceFunc func(value [][]byte) (reduced [][]byte, err error)
 func (f ReduceFunc) Reduce(value [][]byte) (reduced [][]byte, err error) {
 	return f(value)
 }
+
+// Emit writes a value to the named side output for the key that is currently
+// being reduced.
+type Emit func(output string, value []byte)
+
+// OutputReducer is a Reducer that can also write to named side outputs
+// (e.g., "errors" or "metrics") while reducing. The side outputs of a
+// calculation are available from its Job once it has finished. As they
+// cannot be shipped back from the nodes, the nodes return every value they
+// mapped and only the coordinator reduces them (see ReducePlan). It cannot be
+// combined with WithRemoteReduce.
+type OutputReducer interface {
+	Reducer
+
+	// ReduceOutputs is invoked instead of Reduce. Besides the reduced
+	// values, it may write any number of values to side outputs via emit.
+	ReduceOutputs(value [][]byte, emit Emit) (reduced [][]byte, err error)
+}
+
+// outputEmitter is implemented by the Reducers that wrap another one, to
+// report whether the wrapped Reducer writes to side outputs.
+type outputEmitter interface {
+	emitsOutputs() bool
+}
+
+// emitsOutputs reports whether the Reducer writes to side outputs.
+func emitsOutputs(r Reducer) bool {
+	if emitter, ok := r.(outputEmitter); ok {
+		return emitter.emitsOutputs()
+	}
+
+	_, ok := r.(OutputReducer)
+	return ok
+}
+
+// OutputReduceFunc wraps a function into an OutputReducer.
+type OutputReduceFunc func(value [][]byte, emit Emit) (reduced [][]byte, err error)
+
+// Reduce implements the Reducer interface. Any side outputs are discarded.
+func (f OutputReduceFunc) Reduce(value [][]byte) (reduced [][]byte, err error) {
+	return f(value, func(string, []byte) {})
+}
+
+// ReduceOutputs implements the OutputReducer interface.
+func (f OutputReduceFunc) ReduceOutputs(value [][]byte, emit Emit) (reduced [][]byte, err error) {
+	return f(value, emit)
+}
+
+// ReducePlan describes how a node reduces the values that it mapped for a
+// file, before they are returned to the coordinator.
+type ReducePlan struct {
+	// MaxIterations bounds the number of times the Reducer is invoked for a
+	// single key (see WithMaxReduceIterations). A value of 0 means there is
+	// no limit.
+	MaxIterations int
+
+	// Unreduced leaves the reduction to the coordinator: the node returns
+	// every value of a key instead of invoking the Reducer. It is set for a
+	// calculation with WithConvergence or an OutputReducer, as neither the
+	// predicate nor the side outputs can be shipped between the nodes and
+	// the coordinator.
+	Unreduced bool
+}
+
+type reducePlanKey struct{}
+
+// WithReducePlan returns a context that carries the ReducePlan. A Network
+// implementation has to restore it on the remote node before invoking the
+// Executor.
+func WithReducePlan(ctx context.Context, plan ReducePlan) context.Context {
+	return context.WithValue(ctx, reducePlanKey{}, plan)
+}
+
+// ReducePlanFrom returns the ReducePlan that is stored in the context.
+func ReducePlanFrom(ctx context.Context) (ReducePlan, bool) {
+	plan, ok := ctx.Value(reducePlanKey{}).(ReducePlan)
+	return plan, ok
+}
+
+// checkOutputs returns an error if the Reducer writes to side outputs that
+// would be lost, as the node reduces the values instead of the coordinator.
+func checkOutputs(algName string, alg Algorithm, plan ReducePlan) error {
+	if plan.Unreduced || !emitsOutputs(alg.Reducer) {
+		return nil
+	}
+	return fmt.Errorf("%s: the side outputs of the Reducer cannot be returned from a node", algName)
+}
@@ -0,0 +1,77 @@
+package mapreduce
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry is an AlgorithmFetcher that algorithms are registered with under
+// an ID. Functions cannot be sent over the wire, so every node registers the
+// same algorithms under the same IDs (usually from an init function) and the
+// Network only ships the ID. It is safe for concurrent use.
+//
+// It should be created with NewRegistry().
+type Registry struct {
+	mu   sync.RWMutex
+	algs map[string]Algorithm
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		algs: make(map[string]Algorithm),
+	}
+}
+
+// DefaultRegistry is the Registry that Register adds to. Pass it to New and
+// NewExecutor to dispatch the registered algorithms.
+var DefaultRegistry = NewRegistry()
+
+// Register registers the algorithm under the ID with the DefaultRegistry,
+// e.g. Register("wordcount", alg). It panics if the algorithm is incomplete
+// or the ID is already taken.
+func Register(id string, alg Algorithm) {
+	DefaultRegistry.Register(id, alg)
+}
+
+// Register registers the algorithm under the ID. It panics if the algorithm
+// is incomplete or the ID is already taken.
+func (r *Registry) Register(id string, alg Algorithm) {
+	if err := alg.Validate(); err != nil {
+		panic(fmt.Sprintf("mapreduce: Register %s: %s", id, err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.algs[id]; ok {
+		panic(fmt.Sprintf("mapreduce: Register called twice for %s", id))
+	}
+	r.algs[id] = alg
+}
+
+// Alg implements AlgorithmFetcher.
+func (r *Registry) Alg(id string, meta []byte) (Algorithm, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	alg, ok := r.algs[id]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("unknown algorithm: %s", id)
+	}
+	return alg, nil
+}
+
+// IDs returns the sorted IDs of the registered algorithms.
+func (r *Registry) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []string
+	for id := range r.algs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,68 @@
+package mapreduce_test
+
+import (
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TRG struct {
+	*testing.T
+	registry *mapreduce.Registry
+	alg      mapreduce.Algorithm
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TRG {
+		return TRG{
+			T:        t,
+			registry: mapreduce.NewRegistry(),
+			alg: mapreduce.Algorithm{
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values[:1], nil
+				}),
+			},
+		}
+	})
+
+	o.Spec("it fetches the registered algorithm", func(t TRG) {
+		t.registry.Register("wordcount", t.alg)
+
+		alg, err := t.registry.Alg("wordcount", nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, alg.Mapper == nil).To(BeFalse())
+		Expect(t, t.registry.IDs()).To(Equal([]string{"wordcount"}))
+	})
+
+	o.Spec("it returns an error for an unknown ID", func(t TRG) {
+		_, err := t.registry.Alg("unknown", nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it panics when an ID is registered twice", func(t TRG) {
+		t.registry.Register("wordcount", t.alg)
+		Expect(t, panics(func() { t.registry.Register("wordcount", t.alg) })).To(BeTrue())
+	})
+
+	o.Spec("it panics for an incomplete algorithm", func(t TRG) {
+		Expect(t, panics(func() { t.registry.Register("wordcount", mapreduce.Algorithm{}) })).To(BeTrue())
+	})
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
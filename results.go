@@ -0,0 +1,420 @@
+package mapreduce
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Results stores the reduced value for each key of a calculation.
+//
+// MapReduce never modifies Results once they are returned, and none of the
+// methods modify the receiver, so Results may be read from several
+// goroutines without locking. Job.Wait() and MemoryCache return a copy to
+// each caller, so a caller may modify its Results without affecting the
+// others.
+type Results map[string][]byte
+
+// StopWalk is returned from a WalkFunc to stop Walk without an error.
+var StopWalk = errors.New("stop walk")
+
+// WalkFunc is invoked by Walk for each key and its value. A non-nil error
+// stops the walk.
+type WalkFunc func(key string, value []byte) error
+
+// Walk invokes f for each key in sorted order. It stops at the first non-nil
+// error and returns it, unless it is StopWalk.
+func (r Results) Walk(f WalkFunc) error {
+	for _, key := range r.SortedKeys() {
+		if err := f(key, r[key]); err != nil {
+			if err == StopWalk {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the value of the key and whether the key exists. Results
+// are flat, so a single key is the full path to its value. The value of a
+// key that converged to several values is the first of them (see Values).
+func (r Results) Lookup(key string) ([]byte, bool) {
+	value, ok := r[key]
+	if !ok {
+		return nil, false
+	}
+
+	values := splitValues(value)
+	if len(values) == 0 {
+		return nil, true
+	}
+	return values[0], true
+}
+
+// Values returns every value of the key, or nil if the key does not exist.
+// A key that converged to several values (see WithConvergence) holds them
+// encoded into a single value, which Values decodes. The returned values are
+// copies.
+func (r Results) Values(key string) [][]byte {
+	value, ok := r[key]
+	if !ok {
+		return nil
+	}
+
+	var values [][]byte
+	for _, v := range splitValues(value) {
+		if v != nil {
+			v = append([]byte{}, v...)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// valuesPrefix marks a value that holds several values (see joinValues).
+const valuesPrefix = "\xffmapreduce-values\x00"
+
+// joinValues returns the value that a key with the given values is stored
+// as. A single value is stored as it is, several values are encoded into one
+// behind valuesPrefix.
+func joinValues(values [][]byte) []byte {
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	}
+
+	data := []byte(valuesPrefix)
+	for _, value := range values {
+		data = protowire.AppendBytes(data, value)
+	}
+	return data
+}
+
+// splitValues reverses joinValues.
+func splitValues(value []byte) [][]byte {
+	if !bytes.HasPrefix(value, []byte(valuesPrefix)) {
+		return [][]byte{value}
+	}
+
+	var values [][]byte
+	data := value[len(valuesPrefix):]
+	for len(data) > 0 {
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return [][]byte{value}
+		}
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values
+}
+
+// Merge returns new Results that contain the keys of both r and other. For
+// keys that exist in both, conflict is given the value of r and other and
+// returns the merged value. A nil conflict uses the value of other.
+func (r Results) Merge(other Results, conflict func(a, b []byte) []byte) Results {
+	merged := make(Results, len(r)+len(other))
+	for key, value := range r {
+		merged[key] = value
+	}
+
+	for key, value := range other {
+		if existing, ok := merged[key]; ok && conflict != nil {
+			value = conflict(existing, value)
+		}
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// ResultsDiff describes how Results changed between two calculations.
+type ResultsDiff struct {
+	// Added holds the keys that only exist in the new Results.
+	Added Results
+
+	// Removed holds the keys that only exist in the old Results.
+	Removed Results
+
+	// Changed holds the new value of each key whose value differs.
+	Changed Results
+}
+
+// Diff returns the keys that were added, removed or changed between the old
+// and new Results.
+func Diff(old, new Results) ResultsDiff {
+	diff := ResultsDiff{
+		Added:   make(Results),
+		Removed: make(Results),
+		Changed: make(Results),
+	}
+
+	for key, value := range new {
+		oldValue, ok := old[key]
+		switch {
+		case !ok:
+			diff.Added[key] = value
+		case !bytes.Equal(oldValue, value):
+			diff.Changed[key] = value
+		}
+	}
+
+	for key, value := range old {
+		if _, ok := new[key]; !ok {
+			diff.Removed[key] = value
+		}
+	}
+
+	return diff
+}
+
+// Flatten returns a copy of the Results as a plain map from each key to its
+// value.
+func (r Results) Flatten() map[string][]byte {
+	m := make(map[string][]byte, len(r))
+	for key, value := range r {
+		m[key] = value
+	}
+	return m
+}
+
+// clone returns a copy of the Results and their values, so that callers do
+// not share any memory.
+func (r Results) clone() Results {
+	if r == nil {
+		return nil
+	}
+
+	c := make(Results, len(r))
+	for key, value := range r {
+		if value != nil {
+			value = append([]byte{}, value...)
+		}
+		c[key] = value
+	}
+	return c
+}
+
+// Filter returns the subset of the Results for which keep returns true.
+func (r Results) Filter(keep func(key string, value []byte) bool) Results {
+	subset := make(Results)
+	for key, value := range r {
+		if keep(key, value) {
+			subset[key] = value
+		}
+	}
+	return subset
+}
+
+// Prefix returns the subset of the Results whose keys start with the given
+// prefix. It is useful for composite keys (e.g., "2024-05|host-a").
+func (r Results) Prefix(prefix string) Results {
+	subset := make(Results)
+	for key, value := range r {
+		if strings.HasPrefix(key, prefix) {
+			subset[key] = value
+		}
+	}
+	return subset
+}
+
+// Range returns the subset of the Results whose keys are within [start, end)
+// in byte order. An empty end has no upper bound.
+func (r Results) Range(start, end string) Results {
+	subset := make(Results)
+	for key, value := range r {
+		if key < start || (end != "" && key >= end) {
+			continue
+		}
+		subset[key] = value
+	}
+	return subset
+}
+
+// Page returns up to limit keys in byte order, starting after the given
+// cursor. An empty cursor starts at the first key. The returned cursor is
+// given to the next call and is empty once there are no more keys.
+func (r Results) Page(cursor string, limit int) (page Results, next string) {
+	keys := r.SortedKeys()
+	start := 0
+	if cursor != "" {
+		start = sort.Search(len(keys), func(i int) bool {
+			return keys[i] > cursor
+		})
+	}
+
+	end := start + limit
+	if limit <= 0 || end > len(keys) {
+		end = len(keys)
+	}
+
+	page = make(Results, end-start)
+	for _, key := range keys[start:end] {
+		page[key] = r[key]
+	}
+
+	if end < len(keys) {
+		next = keys[end-1]
+	}
+	return page, next
+}
+
+// LeafCount returns the number of values. Results are flat, so each key
+// holds a single value.
+func (r Results) LeafCount() int {
+	return len(r)
+}
+
+// Depth returns the number of levels below the Results. Results are flat,
+// so it is 1, unless the Results are empty.
+func (r Results) Depth() int {
+	if len(r) == 0 {
+		return 0
+	}
+	return 1
+}
+
+// ByteSize returns the combined size of every key and value.
+func (r Results) ByteSize() int {
+	var size int
+	for key, value := range r {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// SortedKeys returns the keys in byte order. Unlike ranging over the
+// Results, the order is the same for every run.
+func (r Results) SortedKeys() []string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MarshalJSON implements json.Marshaler. It produces an object keyed by the
+// result keys with base64 encoded values.
+func (r Results) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string][]byte(r))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It is the counterpart of
+// MarshalJSON.
+func (r *Results) UnmarshalJSON(data []byte) error {
+	var m map[string][]byte
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*r = Results(m)
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder. It uses the protobuf encoding (see
+// ToProto).
+func (r Results) GobEncode() ([]byte, error) {
+	return r.ToProto(), nil
+}
+
+// GobDecode implements gob.GobDecoder.
+func (r *Results) GobDecode(data []byte) error {
+	results, err := ResultsFromProto(data)
+	if err != nil {
+		return err
+	}
+
+	*r = results
+	return nil
+}
+
+// ToProto encodes the Results as a protobuf Results message (see
+// results.proto). Keys are written in sorted order so that equal Results
+// encode identically.
+func (r Results) ToProto() []byte {
+	var data []byte
+	for _, key := range r.SortedKeys() {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, r[key])
+
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+	return data
+}
+
+// ResultsFromProto decodes a protobuf Results message (see results.proto).
+func ResultsFromProto(data []byte) (Results, error) {
+	r := make(Results)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if num != 1 || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		entry, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		key, value, err := consumeResultsEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		r[key] = value
+	}
+
+	return r, nil
+}
+
+func consumeResultsEntry(entry []byte) (key string, value []byte, err error) {
+	for len(entry) > 0 {
+		num, typ, n := protowire.ConsumeTag(entry)
+		if n < 0 {
+			return "", nil, protowire.ParseError(n)
+		}
+		entry = entry[n:]
+
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			key, n = protowire.ConsumeString(entry)
+		case num == 2 && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(entry)
+			value = append([]byte{}, v...)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, entry)
+		}
+
+		if n < 0 {
+			return "", nil, fmt.Errorf("invalid results entry: %s", protowire.ParseError(n))
+		}
+		entry = entry[n:]
+	}
+
+	return key, value, nil
+}
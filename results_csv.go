@@ -0,0 +1,86 @@
+package mapreduce
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// CSVOption is used to configure Results.WriteCSV().
+type CSVOption func(*csvConfig)
+
+type csvConfig struct {
+	comma        rune
+	header       []string
+	keySeparator string
+	formatValue  func(value []byte) string
+}
+
+// WithCSVComma sets the field delimiter. It defaults to ','. Use '\t' for
+// TSV.
+func WithCSVComma(comma rune) CSVOption {
+	return func(c *csvConfig) {
+		c.comma = comma
+	}
+}
+
+// WithCSVHeader writes the given column names as the first row.
+func WithCSVHeader(columns ...string) CSVOption {
+	return func(c *csvConfig) {
+		c.header = columns
+	}
+}
+
+// WithCSVKeySeparator splits composite keys (e.g., "2024-05|host-a") on the
+// separator so that each part gets its own column.
+func WithCSVKeySeparator(sep string) CSVOption {
+	return func(c *csvConfig) {
+		c.keySeparator = sep
+	}
+}
+
+// WithCSVValueFormat sets how values are written. It defaults to writing
+// the value as a string.
+func WithCSVValueFormat(f func(value []byte) string) CSVOption {
+	return func(c *csvConfig) {
+		c.formatValue = f
+	}
+}
+
+// WriteCSV writes one row per key in sorted order. Each row holds the key
+// columns followed by the value.
+func (r Results) WriteCSV(w io.Writer, opts ...CSVOption) error {
+	c := csvConfig{
+		comma: ',',
+		formatValue: func(value []byte) string {
+			return string(value)
+		},
+	}
+
+	for _, o := range opts {
+		o(&c)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = c.comma
+
+	if c.header != nil {
+		if err := cw.Write(c.header); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range r.SortedKeys() {
+		row := []string{key}
+		if c.keySeparator != "" {
+			row = strings.Split(key, c.keySeparator)
+		}
+
+		if err := cw.Write(append(row, c.formatValue(r[key]))); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
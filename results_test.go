@@ -0,0 +1,284 @@
+package mapreduce_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TR struct {
+	*testing.T
+	results mapreduce.Results
+}
+
+func TestResults(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TR {
+		return TR{
+			T: t,
+			results: mapreduce.Results{
+				"key-a": []byte("value-a"),
+				"key-b": []byte("value-b"),
+			},
+		}
+	})
+
+	o.Spec("it returns the keys in order", func(t TR) {
+		t.results["a"] = nil
+		Expect(t, t.results.SortedKeys()).To(Equal([]string{"a", "key-a", "key-b"}))
+	})
+
+	o.Spec("it returns the size of the keys and values", func(t TR) {
+		Expect(t, t.results.ByteSize()).To(Equal(24))
+	})
+
+	o.Spec("it returns the number of values and levels", func(t TR) {
+		Expect(t, t.results.LeafCount()).To(Equal(2))
+		Expect(t, t.results.Depth()).To(Equal(1))
+	})
+
+	o.Spec("it does not have any levels when it is empty", func(t TR) {
+		Expect(t, mapreduce.Results{}.LeafCount()).To(Equal(0))
+		Expect(t, mapreduce.Results{}.Depth()).To(Equal(0))
+	})
+
+	o.Spec("it looks up a key", func(t TR) {
+		value, ok := t.results.Lookup("key-a")
+		Expect(t, ok).To(BeTrue())
+		Expect(t, value).To(Equal([]byte("value-a")))
+
+		_, ok = t.results.Lookup("unknown")
+		Expect(t, ok).To(BeFalse())
+	})
+
+	o.Spec("it returns the single value of a key", func(t TR) {
+		Expect(t, t.results.Values("key-a")).To(Equal([][]byte{[]byte("value-a")}))
+		Expect(t, t.results.Values("unknown")).To(HaveLen(0))
+	})
+
+	o.Group("Walk", func() {
+		o.Spec("it visits each key in order", func(t TR) {
+			var keys []string
+			err := t.results.Walk(func(key string, value []byte) error {
+				keys = append(keys, key)
+				return nil
+			})
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, keys).To(Equal([]string{"key-a", "key-b"}))
+		})
+
+		o.Spec("it stops without an error", func(t TR) {
+			var keys []string
+			err := t.results.Walk(func(key string, value []byte) error {
+				keys = append(keys, key)
+				return mapreduce.StopWalk
+			})
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, keys).To(Equal([]string{"key-a"}))
+		})
+
+		o.Spec("it returns the error", func(t TR) {
+			err := t.results.Walk(func(key string, value []byte) error {
+				return fmt.Errorf("some-error")
+			})
+			Expect(t, err == nil).To(BeFalse())
+		})
+	})
+
+	o.Group("Merge", func() {
+		o.Spec("it resolves conflicting keys", func(t TR) {
+			merged := t.results.Merge(mapreduce.Results{
+				"key-b": []byte("other-b"),
+				"key-c": []byte("other-c"),
+			}, func(a, b []byte) []byte {
+				return append(append([]byte{}, a...), b...)
+			})
+
+			Expect(t, merged).To(Equal(mapreduce.Results{
+				"key-a": []byte("value-a"),
+				"key-b": []byte("value-bother-b"),
+				"key-c": []byte("other-c"),
+			}))
+		})
+
+		o.Spec("it does not modify either results", func(t TR) {
+			other := mapreduce.Results{"key-c": []byte("other-c")}
+			t.results.Merge(other, nil)
+
+			Expect(t, t.results).To(HaveLen(2))
+			Expect(t, other).To(HaveLen(1))
+		})
+	})
+
+	o.Spec("it flattens into a map", func(t TR) {
+		m := t.results.Flatten()
+		Expect(t, m).To(Equal(map[string][]byte{
+			"key-a": []byte("value-a"),
+			"key-b": []byte("value-b"),
+		}))
+
+		delete(m, "key-a")
+		Expect(t, t.results).To(HaveLen(2))
+	})
+
+	o.Group("queries", func() {
+		o.BeforeEach(func(t TR) TR {
+			t.results = mapreduce.Results{
+				"2024-04|host-a": []byte("a"),
+				"2024-05|host-a": []byte("b"),
+				"2024-05|host-b": []byte("c"),
+				"2024-06|host-a": []byte("d"),
+			}
+			return t
+		})
+
+		o.Spec("it pages through the keys", func(t TR) {
+			page, cursor := t.results.Page("", 3)
+			Expect(t, page).To(HaveLen(3))
+			Expect(t, cursor).To(Equal("2024-05|host-b"))
+
+			page, cursor = t.results.Page(cursor, 3)
+			Expect(t, page).To(Equal(mapreduce.Results{
+				"2024-06|host-a": []byte("d"),
+			}))
+			Expect(t, cursor).To(Equal(""))
+		})
+
+		o.Spec("it returns the keys that pass the filter", func(t TR) {
+			filtered := t.results.Filter(func(key string, value []byte) bool {
+				return string(value) == "a" || string(value) == "d"
+			})
+			Expect(t, filtered).To(Equal(mapreduce.Results{
+				"2024-04|host-a": []byte("a"),
+				"2024-06|host-a": []byte("d"),
+			}))
+			Expect(t, t.results).To(HaveLen(4))
+		})
+
+		o.Spec("it returns the keys with the prefix", func(t TR) {
+			Expect(t, t.results.Prefix("2024-05|")).To(Equal(mapreduce.Results{
+				"2024-05|host-a": []byte("b"),
+				"2024-05|host-b": []byte("c"),
+			}))
+		})
+
+		o.Spec("it returns the keys within the range", func(t TR) {
+			Expect(t, t.results.Range("2024-05", "2024-06")).To(Equal(mapreduce.Results{
+				"2024-05|host-a": []byte("b"),
+				"2024-05|host-b": []byte("c"),
+			}))
+		})
+
+		o.Spec("it treats an empty end as unbounded", func(t TR) {
+			Expect(t, t.results.Range("2024-05|host-b", "")).To(HaveLen(2))
+		})
+	})
+
+	o.Group("CSV", func() {
+		o.Spec("it writes a row for each key", func(t TR) {
+			buf := &bytes.Buffer{}
+			err := t.results.WriteCSV(buf)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, buf.String()).To(Equal("key-a,value-a\nkey-b,value-b\n"))
+		})
+
+		o.Spec("it splits composite keys into columns", func(t TR) {
+			buf := &bytes.Buffer{}
+			results := mapreduce.Results{"2024-05|host-a": []byte("1")}
+			err := results.WriteCSV(buf,
+				mapreduce.WithCSVComma('\t'),
+				mapreduce.WithCSVHeader("day", "host", "count"),
+				mapreduce.WithCSVKeySeparator("|"),
+			)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, buf.String()).To(Equal("day\thost\tcount\n2024-05\thost-a\t1\n"))
+		})
+	})
+
+	o.Spec("it diffs against newer results", func(t TR) {
+		diff := mapreduce.Diff(t.results, mapreduce.Results{
+			"key-a": []byte("value-a"),
+			"key-b": []byte("other-b"),
+			"key-c": []byte("value-c"),
+		})
+
+		Expect(t, diff.Added).To(Equal(mapreduce.Results{"key-c": []byte("value-c")}))
+		Expect(t, diff.Removed).To(HaveLen(0))
+		Expect(t, diff.Changed).To(Equal(mapreduce.Results{"key-b": []byte("other-b")}))
+
+		diff = mapreduce.Diff(t.results, mapreduce.Results{})
+		Expect(t, diff.Removed).To(Equal(t.results))
+	})
+
+	// The race detector (go test -race) reports any unsynchronized access.
+	o.Spec("it can be read concurrently", func(t TR) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.results.Walk(func(string, []byte) error { return nil })
+				t.results.Page("", 1)
+				t.results.Filter(func(string, []byte) bool { return true })
+				t.results.ToProto()
+			}()
+		}
+		wg.Wait()
+	})
+
+	o.Group("JSON", func() {
+		o.Spec("it marshals into an object keyed by the result keys", func(t TR) {
+			data, err := json.Marshal(t.results)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, string(data)).To(Equal(`{"key-a":"dmFsdWUtYQ==","key-b":"dmFsdWUtYg=="}`))
+		})
+
+		o.Spec("it unmarshals what it marshals", func(t TR) {
+			data, _ := json.Marshal(t.results)
+
+			var results mapreduce.Results
+			err := json.Unmarshal(data, &results)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, results).To(Equal(t.results))
+		})
+	})
+
+	o.Spec("it can be gob encoded", func(t TR) {
+		buf := &bytes.Buffer{}
+		err := gob.NewEncoder(buf).Encode(t.results)
+		Expect(t, err == nil).To(BeTrue())
+
+		var results mapreduce.Results
+		err = gob.NewDecoder(buf).Decode(&results)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(t.results))
+	})
+
+	o.Group("protobuf", func() {
+		o.Spec("it decodes what it encodes", func(t TR) {
+			results, err := mapreduce.ResultsFromProto(t.results.ToProto())
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, results).To(Equal(t.results))
+		})
+
+		o.Spec("it encodes deterministically", func(t TR) {
+			Expect(t, t.results.ToProto()).To(Equal(t.results.ToProto()))
+		})
+
+		o.Spec("it returns an error for invalid data", func(t TR) {
+			_, err := mapreduce.ResultsFromProto([]byte{0x0a, 0xff})
+			Expect(t, err == nil).To(BeFalse())
+		})
+	})
+}
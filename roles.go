@@ -0,0 +1,71 @@
+package mapreduce
+
+import "fmt"
+
+// Role is what a node takes part in (see WithRoles).
+type Role int
+
+const (
+	// MapAndReduce nodes map the files and reduce the shuffled keys. It is
+	// the role of every node that is not given one.
+	MapAndReduce Role = iota
+
+	// MapOnly nodes map the files, but do not reduce any keys (e.g., edge
+	// nodes that are close to the data).
+	MapOnly
+
+	// ReduceOnly nodes reduce the shuffled keys, but do not map any files
+	// (e.g., central nodes with lots of memory).
+	ReduceOnly
+)
+
+// WithRoles sets the role of the nodes. Files are only assigned to nodes that
+// map them. With WithShuffle, the keys are only partitioned across the nodes
+// that reduce, which includes the ReduceOnly nodes that are eligible (see
+// WithNodes and WithDiscovery) even though they hold no files. Without
+// shuffling the coordinator reduces, so ReduceOnly nodes are not used.
+func WithRoles(roles map[string]Role) MapReduceOption {
+	return func(r *MapReduce) {
+		r.roles = roles
+	}
+}
+
+// maps reports whether the node maps files.
+func (r MapReduce) maps(nodeID string) bool {
+	return r.roles[nodeID] != ReduceOnly
+}
+
+// reducers returns the nodes that reduce the keys of a calculation that is
+// mapped on the given nodes.
+func (r MapReduce) reducers(mappers []string, discovered map[string]bool) ([]string, error) {
+	if r.roles == nil {
+		return mappers, nil
+	}
+
+	var reducers []string
+	for _, id := range mappers {
+		if r.roles[id] == MapAndReduce {
+			reducers = append(reducers, id)
+		}
+	}
+
+	for id, role := range r.roles {
+		if role != ReduceOnly {
+			continue
+		}
+
+		if r.nodes != nil && !r.nodes[id] {
+			continue
+		}
+
+		if discovered != nil && !discovered[id] {
+			continue
+		}
+		reducers = append(reducers, id)
+	}
+
+	if len(reducers) == 0 {
+		return nil, fmt.Errorf("no node to reduce")
+	}
+	return reducers, nil
+}
@@ -19,3 +19,12 @@ func NewInProcessNetwork(e *mapreduce.Executor) *InProcessNetwork {
 func (n *InProcessNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (result map[string][]byte, err error) {
 	return n.e.Execute(file, algName, ctx, meta)
 }
+
+func (n *InProcessNetwork) Shuffle(jobID, task, nodeID string, ctx context.Context, values map[string][]byte) error {
+	n.e.Receive(jobID, task, values)
+	return nil
+}
+
+func (n *InProcessNetwork) Collect(jobID, algName, nodeID string, ctx context.Context, meta []byte) (result map[string][]byte, err error) {
+	return n.e.Collect(jobID, algName, ctx, meta)
+}
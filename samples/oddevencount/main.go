@@ -41,6 +41,10 @@ func main() {
 		},
 	}
 
+	if err := mapreduce.AlgFetcherMap(algs).Validate(); err != nil {
+		log.Fatalf("Invalid algorithms: %s", err)
+	}
+
 	size := rand.Intn(100000)
 	println(size)
 	fileSystem := components.NewInMemoryFS(3, size)
@@ -0,0 +1,238 @@
+package mapreduce
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Scheduler queues calculations and only runs a bounded number of them at
+// once. Queued calculations are started in the order of their priority (see
+// WithPriority), and in the order they were submitted within the same
+// priority. It is safe for concurrent use.
+//
+// It should be created with NewScheduler().
+type Scheduler struct {
+	r           MapReduce
+	concurrency int
+	weights     map[string]float64
+
+	mu      sync.Mutex
+	running int
+	queue   []*ScheduledJob
+	tenants map[string]*tenant
+}
+
+// SchedulerOption is used to configure a Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// NewScheduler returns a new Scheduler that runs up to the given number of
+// calculations of the MapReduce at once. A concurrency below 1 runs a single
+// calculation at a time.
+func NewScheduler(r MapReduce, concurrency int, opts ...SchedulerOption) *Scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	s := &Scheduler{
+		r:           r,
+		concurrency: concurrency,
+		tenants:     make(map[string]*tenant),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// ScheduledJob is a calculation that was submitted to a Scheduler. It is
+// safe to use from several goroutines.
+type ScheduledJob struct {
+	routes   []string
+	algName  string
+	ctx      context.Context
+	meta     []byte
+	opts     []MapReduceOption
+	priority int
+	tenant   string
+
+	started chan struct{}
+	job     *Job
+	err     error
+}
+
+// Submit queues the same calculation as MapReduce.Submit. A calculation
+// that is still queued when the context is done is dropped.
+func (s *Scheduler) Submit(route, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) *ScheduledJob {
+	return s.SubmitMulti([]string{route}, algName, ctx, meta, opts...)
+}
+
+// SubmitMulti queues the same calculation as MapReduce.SubmitMulti.
+func (s *Scheduler) SubmitMulti(routes []string, algName string, ctx context.Context, meta []byte, opts ...MapReduceOption) *ScheduledJob {
+	r := s.r
+	for _, o := range opts {
+		o(&r)
+	}
+
+	j := &ScheduledJob{
+		routes:   routes,
+		algName:  algName,
+		ctx:      ctx,
+		meta:     meta,
+		opts:     opts,
+		priority: r.priority,
+		tenant:   r.tenant,
+		started:  make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.queue = append(s.queue, j)
+	s.mu.Unlock()
+	s.schedule()
+
+	go func() {
+		select {
+		case <-j.started:
+		case <-ctx.Done():
+			s.drop(j, ctx.Err())
+		}
+	}()
+
+	return j
+}
+
+// QueueDepth returns the number of calculations that wait to be started.
+func (s *Scheduler) QueueDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Running returns the number of calculations that are running.
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// schedule starts queued calculations while there is room for them.
+func (s *Scheduler) schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.running < s.concurrency && len(s.queue) > 0 {
+		best := s.next()
+		if best < 0 {
+			return
+		}
+
+		j := s.queue[best]
+		s.queue = append(s.queue[:best:best], s.queue[best+1:]...)
+		s.running++
+		s.tenant(j.tenant).running++
+		go s.start(j)
+	}
+}
+
+// start submits the calculation to the MapReduce and frees its room once it
+// has finished. It does not hold the lock, as the MapReduce may take a while
+// to start the calculation (e.g., to wait for its nodes).
+func (s *Scheduler) start(j *ScheduledJob) {
+	opts := append([]MapReduceOption{withNodeTime()}, j.opts...)
+	job, err := s.r.SubmitMulti(j.routes, j.algName, j.ctx, j.meta, opts...)
+	j.job, j.err = job, err
+	if err != nil {
+		close(j.started)
+		s.done(j.tenant, nil)
+		s.schedule()
+		return
+	}
+
+	s.mu.Lock()
+	s.tenant(j.tenant).jobs[job] = true
+	s.mu.Unlock()
+	close(j.started)
+
+	<-job.Done()
+	s.done(j.tenant, job)
+	s.schedule()
+}
+
+// next returns the index of the queued calculation to start next, or -1 if
+// every queued calculation has to wait for its tenant's share. The lock has
+// to be held.
+func (s *Scheduler) next() int {
+	best := -1
+	for i, j := range s.queue {
+		if s.weights != nil && s.tenant(j.tenant).running >= s.limit(j.tenant) {
+			continue
+		}
+
+		if best < 0 || s.before(j, s.queue[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// done frees the room of a calculation and adds the node time of its Job
+// (if it was started) to the usage of the tenant.
+func (s *Scheduler) done(name string, job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	t := s.tenant(name)
+	t.running--
+	if job == nil {
+		return
+	}
+
+	delete(t.jobs, job)
+	t.nodeTime += nodeTime(job)
+	t.finished++
+}
+
+// drop removes the calculation from the queue, unless it was started in the
+// meantime.
+func (s *Scheduler) drop(j *ScheduledJob, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, other := range s.queue {
+		if other == j {
+			s.queue = append(s.queue[:i:i], s.queue[i+1:]...)
+			j.err = err
+			close(j.started)
+			return
+		}
+	}
+}
+
+// Started returns a channel that is closed once the calculation was started
+// or dropped.
+func (j *ScheduledJob) Started() <-chan struct{} {
+	return j.started
+}
+
+// Job returns the Job of the calculation. It returns false while the
+// calculation is queued or if it could not be started.
+func (j *ScheduledJob) Job() (*Job, bool) {
+	select {
+	case <-j.started:
+		return j.job, j.job != nil
+	default:
+		return nil, false
+	}
+}
+
+// Wait blocks until the calculation has finished and returns its result.
+func (j *ScheduledJob) Wait() (Results, error) {
+	<-j.started
+	if j.err != nil {
+		return nil, j.err
+	}
+	return j.job.Wait()
+}
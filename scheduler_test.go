@@ -0,0 +1,196 @@
+package mapreduce_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TSC struct {
+	*testing.T
+	network   *blockingNetwork
+	mr        mapreduce.MapReduce
+	scheduler *mapreduce.Scheduler
+}
+
+func TestScheduler(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TSC {
+		fs := fsfakes.NewInMemory()
+		fs.SetNodes("some-file", "id-a")
+
+		network := &blockingNetwork{release: make(chan struct{})}
+		mr := mapreduce.New(fs, network, mapreduce.AlgFetcherMap{
+			"some-alg": {Mapper: newMockMapper(), Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+				return values[:1], nil
+			})},
+		})
+
+		return TSC{
+			T:         t,
+			network:   network,
+			mr:        mr,
+			scheduler: mapreduce.NewScheduler(mr, 1),
+		}
+	})
+
+	o.Spec("it bounds the running calculations", func(t TSC) {
+		a := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+		b := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+		Expect(t, t.scheduler.Running()).To(Equal(1))
+		Expect(t, t.scheduler.QueueDepth()).To(Equal(1))
+
+		_, ok := b.Job()
+		Expect(t, ok).To(BeFalse())
+
+		close(t.network.release)
+		_, err := a.Wait()
+		Expect(t, err == nil).To(BeTrue())
+
+		results, err := b.Wait()
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(HaveLen(1))
+		Expect(t, func() int { return t.scheduler.Running() }).To(ViaPolling(Equal(0)))
+	})
+
+	o.Spec("it starts the calculations by priority and then in order", func(t TSC) {
+		t.scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+		low := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+		highA := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithPriority(1))
+		highB := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithPriority(1))
+
+		started := func(j *mapreduce.ScheduledJob) func() bool {
+			return func() bool {
+				_, ok := j.Job()
+				return ok
+			}
+		}
+
+		for _, j := range []*mapreduce.ScheduledJob{highA, highB, low} {
+			t.network.release <- struct{}{}
+			Expect(t, started(j)).To(ViaPolling(BeTrue()))
+		}
+		Expect(t, t.scheduler.QueueDepth()).To(Equal(0))
+
+		t.network.release <- struct{}{}
+		_, err := low.Wait()
+		Expect(t, err == nil).To(BeTrue())
+	})
+
+	o.Spec("it drops a queued calculation once its context is done", func(t TSC) {
+		defer close(t.network.release)
+		t.scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		j := t.scheduler.Submit("some-file", "some-alg", ctx, nil)
+		cancel()
+
+		_, err := j.Wait()
+		Expect(t, err == context.Canceled).To(BeTrue())
+		Expect(t, t.scheduler.QueueDepth()).To(Equal(0))
+	})
+	o.Spec("it runs a calculation at a time when the concurrency is below 1", func(t TSC) {
+		close(t.network.release)
+		j := mapreduce.NewScheduler(t.mr, 0).Submit("some-file", "some-alg", context.Background(), nil)
+		Expect(t, func() bool {
+			_, ok := j.Job()
+			return ok
+		}).To(ViaPolling(BeTrue()))
+
+		_, err := j.Wait()
+		Expect(t, err == nil).To(BeTrue())
+	})
+
+	o.Spec("it does not block the submitter while a calculation is started", func(t TSC) {
+		fs := &blockingFileSystem{InMemory: fsfakes.NewInMemory(), release: make(chan struct{})}
+		fs.SetNodes("some-file", "id-a")
+		defer close(fs.release)
+		close(t.network.release)
+
+		mr := mapreduce.New(fs, t.network, mapreduce.AlgFetcherMap{
+			"some-alg": {Mapper: newMockMapper(), Reducer: newMockReducer()},
+		})
+		scheduler := mapreduce.NewScheduler(mr, 2)
+
+		submitted := make(chan *mapreduce.ScheduledJob, 2)
+		go func() {
+			submitted <- scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+			submitted <- scheduler.Submit("some-file", "some-alg", context.Background(), nil)
+		}()
+		Expect(t, submitted).To(Receive(ReceiveWait(time.Second)))
+		Expect(t, submitted).To(Receive(ReceiveWait(time.Second)))
+		Expect(t, scheduler.Running()).To(Equal(2))
+	})
+
+	o.Group("when the tenants share the Scheduler", func() {
+		o.BeforeEach(func(t TSC) TSC {
+			t.scheduler = mapreduce.NewScheduler(t.mr, 2, mapreduce.WithFairShare(map[string]float64{
+				"team-a": 1,
+				"team-b": 1,
+			}))
+			return t
+		})
+
+		o.Spec("it starts the calculations of the tenant below its share", func(t TSC) {
+			var jobs []*mapreduce.ScheduledJob
+			for i := 0; i < 3; i++ {
+				jobs = append(jobs, t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithTenant("team-a")))
+			}
+			b := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithTenant("team-b"))
+			Expect(t, t.scheduler.QueueDepth()).To(Equal(2))
+
+			t.network.release <- struct{}{}
+			Expect(t, func() bool {
+				_, ok := b.Job()
+				return ok
+			}).To(ViaPolling(BeTrue()))
+
+			_, ok := jobs[2].Job()
+			Expect(t, ok).To(BeFalse())
+
+			close(t.network.release)
+			for _, j := range append(jobs, b) {
+				_, err := j.Wait()
+				Expect(t, err == nil).To(BeTrue())
+			}
+		})
+
+		o.Spec("it reports the usage of each tenant", func(t TSC) {
+			a := t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithTenant("team-a"))
+			t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithTenant("team-b"))
+			t.scheduler.Submit("some-file", "some-alg", context.Background(), nil, mapreduce.WithTenant("team-b"))
+
+			usage := t.scheduler.Usage()
+			Expect(t, usage["team-a"].Running).To(Equal(1))
+			Expect(t, usage["team-b"].Running).To(Equal(1))
+			Expect(t, usage["team-b"].Queued).To(Equal(1))
+
+			close(t.network.release)
+			_, err := a.Wait()
+			Expect(t, err == nil).To(BeTrue())
+
+			Expect(t, func() int { return t.scheduler.Usage()["team-a"].Finished }).To(ViaPolling(Equal(1)))
+			Expect(t, t.scheduler.Usage()["team-a"].NodeTime > 0).To(BeTrue())
+		})
+	})
+}
+
+// blockingFileSystem does not return the files until it is released.
+type blockingFileSystem struct {
+	*fsfakes.InMemory
+	release chan struct{}
+}
+
+func (fs *blockingFileSystem) Files(route string, ctx context.Context, meta []byte) (map[string][]string, error) {
+	<-fs.release
+	return fs.InMemory.Files(route, ctx, meta)
+}
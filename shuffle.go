@@ -0,0 +1,356 @@
+package mapreduce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+// WithRemoteReduce reduces the keys on the nodes instead of the coordinator.
+// It implies WithShuffle: the node that is responsible for a key invokes the
+// Reducer until a single value is left, honoring WithMaxReduceIterations. The
+// coordinator takes those values as they are and streams each one as soon as
+// its node is done, so it never holds more than the final values. It cannot
+// be combined with WithConvergence or an OutputReducer, as neither the
+// predicate nor the side outputs can be shipped between the nodes and the
+// coordinator.
+func WithRemoteReduce() MapReduceOption {
+	return func(r *MapReduce) {
+		r.shuffle = true
+		r.remoteReduce = true
+	}
+}
+
+// WithShuffle makes each node send the values it mapped directly to the node
+// that is responsible for their keys, instead of funneling every value back
+// through the coordinator. Each responsible node combines the values it
+// received, and the coordinator collects only the combined values. The
+// Network has to implement ShuffleNetwork and the Executor of each node has
+// to be created with WithShuffler.
+func WithShuffle() MapReduceOption {
+	return func(r *MapReduce) {
+		r.shuffle = true
+	}
+}
+
+// WithShuffleReplication implies WithShuffle and sends the values of each key
+// to a second node as well, so that the keys of a node that fails before its
+// values were collected do not have to be mapped again. The values are
+// collected from both nodes, and the ones of the second node are only used
+// when the first one fails. Replication doubles the shuffled data.
+func WithShuffleReplication() MapReduceOption {
+	return func(r *MapReduce) {
+		r.shuffle = true
+		r.shuffleReplication = true
+	}
+}
+
+// ShufflePlan describes the shuffle of a calculation (see WithShuffle).
+type ShufflePlan struct {
+	// JobID identifies the calculation on the nodes.
+	JobID string
+
+	// Nodes are the nodes that the keys are partitioned across.
+	Nodes []string
+
+	// MaxReduceIterations bounds the number of times a node invokes the
+	// Reducer for a single key when the values are collected (see
+	// WithMaxReduceIterations). A value of 0 means there is no limit.
+	MaxReduceIterations int
+
+	// Replicate sends the values of each node to the next one of Nodes as
+	// well (see WithShuffleReplication).
+	Replicate bool
+}
+
+type shufflePlanKey struct{}
+
+// WithShufflePlan returns a context that carries the ShufflePlan.
+func WithShufflePlan(ctx context.Context, plan ShufflePlan) context.Context {
+	return context.WithValue(ctx, shufflePlanKey{}, plan)
+}
+
+// ShufflePlanFrom returns the ShufflePlan that is stored in the context.
+func ShufflePlanFrom(ctx context.Context) (ShufflePlan, bool) {
+	plan, ok := ctx.Value(shufflePlanKey{}).(ShufflePlan)
+	return plan, ok
+}
+
+// Shuffler sends the values that a node combined for a file (or split) to
+// the node that is responsible for their keys. The task identifies the file
+// (and split), so that the values of a retried task replace the ones of the
+// failed attempt. A Network that implements ShuffleNetwork usually
+// implements it as well.
+type Shuffler interface {
+	Shuffle(jobID, task, nodeID string, ctx context.Context, values map[string][]byte) error
+}
+
+// ShuffleNetwork is a Network that supports WithShuffle.
+type ShuffleNetwork interface {
+	Network
+
+	// Collect returns the values that were shuffled to the node (nodeID) for
+	// the calculation (jobID), combined by the algorithm (algName). It has
+	// to invoke Collect of the node's Executor.
+	Collect(jobID, algName, nodeID string, ctx context.Context, meta []byte) (result map[string][]byte, err error)
+}
+
+// WithShuffler configures the Executor to take part in shuffles. The values
+// are sent with the Shuffler to the node that the Partitioner picks for each
+// key. Every node has to use the same Partitioner. It defaults to a
+// ConsistentHash.
+func WithShuffler(s Shuffler, p Partitioner) ExecutorOption {
+	return func(e *Executor) {
+		if p == nil {
+			p = NewConsistentHash(100)
+		}
+
+		e.shuffler = s
+		e.partitioner = p
+	}
+}
+
+// Receive stores the values that a node shuffled to this one for the given
+// calculation and task. Values of a task that were received before are
+// replaced.
+func (e *Executor) Receive(jobID, task string, values map[string][]byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	tasks, ok := e.shuffled[jobID]
+	if !ok {
+		tasks = make(map[string]map[string][]byte)
+		e.shuffled[jobID] = tasks
+	}
+
+	merged, ok := tasks[task]
+	if !ok {
+		merged = make(map[string][]byte)
+		tasks[task] = merged
+	}
+
+	for key, value := range values {
+		merged[key] = value
+	}
+}
+
+// Collect combines the values that were shuffled to this node for the given
+// calculation with the reducer of the algorithm (algName). The values are
+// forgotten afterwards. The ShufflePlan of the calculation may be stored in
+// the context to bound the reduce iterations, and its ReducePlan to leave
+// the reduction to the coordinator.
+func (e *Executor) Collect(jobID, algName string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	e.mu.Lock()
+	tasks := e.shuffled[jobID]
+	delete(e.shuffled, jobID)
+	e.mu.Unlock()
+
+	alg, err := e.algFetcher.Alg(algName, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg.Reducer == nil {
+		return nil, fmt.Errorf("algorithm %s is missing a Reducer", algName)
+	}
+
+	if err := checkVersion(algName, alg, ctx); err != nil {
+		return nil, err
+	}
+
+	reduce, _ := ReducePlanFrom(ctx)
+	if err := checkOutputs(algName, alg, reduce); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][][]byte)
+	for _, values := range tasks {
+		for key, value := range values {
+			if reduce.Unreduced {
+				m[key] = append(m[key], splitValues(value)...)
+				continue
+			}
+			m[key] = append(m[key], value)
+		}
+	}
+
+	plan, _ := ShufflePlanFrom(ctx)
+	reduce.MaxIterations = plan.MaxReduceIterations
+	return combine(alg, reduce, m)
+}
+
+// shuffle partitions the values and sends each partition to its node.
+func (e *Executor) shuffle(plan ShufflePlan, task string, values map[string][]byte, ctx context.Context) error {
+	if e.shuffler == nil {
+		return fmt.Errorf("Executor is not configured to shuffle")
+	}
+
+	partitions := make(map[string]map[string][]byte)
+	for key, value := range values {
+		nodeID := e.partitioner.Partition(key, plan.Nodes)
+		if partitions[nodeID] == nil {
+			partitions[nodeID] = make(map[string][]byte)
+		}
+		partitions[nodeID][key] = value
+	}
+
+	for nodeID, partition := range partitions {
+		if err := e.shuffler.Shuffle(plan.JobID, task, nodeID, ctx, partition); err != nil {
+			return fmt.Errorf("failed to shuffle to %s: %s", nodeID, err)
+		}
+
+		replicaID, ok := plan.replica(nodeID)
+		if !ok {
+			continue
+		}
+
+		if err := e.shuffler.Shuffle(replicaJobID(plan.JobID, nodeID), task, replicaID, ctx, partition); err != nil {
+			return fmt.Errorf("failed to replicate to %s: %s", replicaID, err)
+		}
+	}
+	return nil
+}
+
+// replica returns the node that holds the replica of the values of the given
+// node, if the plan replicates them.
+func (p ShufflePlan) replica(nodeID string) (string, bool) {
+	if !p.Replicate || len(p.Nodes) < 2 {
+		return "", false
+	}
+
+	for i, id := range p.Nodes {
+		if id == nodeID {
+			return p.Nodes[(i+1)%len(p.Nodes)], true
+		}
+	}
+	return "", false
+}
+
+// replicaJobID identifies the replica of the values of the given node. The
+// replica is kept apart from the node's own values on the replica node.
+func replicaJobID(jobID, nodeID string) string {
+	return jobID + "/replica/" + nodeID
+}
+
+// taskID identifies the file, or the split of it, that is calculated.
+func taskID(fileName string, ctx context.Context) string {
+	split, ok := SplitFrom(ctx)
+	if !ok {
+		return task(fileName, nil)
+	}
+	return task(fileName, &split)
+}
+
+// shufflePlan returns the plan for a calculation of the assignments. The
+// keys are partitioned across the nodes that map, unless their roles say
+// otherwise (see WithRoles), and only the nearest of them are used if the
+// zones are known (see WithZones).
+func (r MapReduce) shufflePlan(assignments []assignment, discovered map[string]bool) (ShufflePlan, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ShufflePlan{}, err
+	}
+
+	seen := make(map[string]bool)
+	var nodeIDs []string
+	for _, a := range assignments {
+		if seen[a.nodeID] {
+			continue
+		}
+		seen[a.nodeID] = true
+		nodeIDs = append(nodeIDs, a.nodeID)
+	}
+
+	nodeIDs, err := r.reducers(nodeIDs, discovered)
+	if err != nil {
+		return ShufflePlan{}, err
+	}
+	nodeIDs = r.nearestNodes(nodeIDs)
+	sort.Strings(nodeIDs)
+
+	return ShufflePlan{
+		JobID:               hex.EncodeToString(id),
+		Nodes:               nodeIDs,
+		MaxReduceIterations: r.maxReduceIterations,
+		Replicate:           r.shuffleReplication,
+	}, nil
+}
+
+// collect collects the combined values from each node of the plan. Each
+// node's values are passed to f as soon as they arrive. If the plan
+// replicates the values, the replica is collected at the same time and used
+// when the node fails.
+func (r MapReduce) collect(plan ShufflePlan, algName string, ctx context.Context, meta []byte, f func(result map[string][]byte) error) error {
+	network := r.network.(ShuffleNetwork)
+
+	type collected struct {
+		result map[string][]byte
+		err    error
+	}
+	results := make(chan collected, len(plan.Nodes))
+	for _, nodeID := range plan.Nodes {
+		go func(nodeID string) {
+			var replica chan collected
+			if replicaID, ok := plan.replica(nodeID); ok {
+				replica = make(chan collected, 1)
+				go func() {
+					result, err := network.Collect(replicaJobID(plan.JobID, nodeID), algName, replicaID, ctx, meta)
+					replica <- collected{result: result, err: err}
+				}()
+			}
+
+			r.log.Printf("Collect shuffled values of %s from %s", plan.JobID, nodeID)
+			result, err := network.Collect(plan.JobID, algName, nodeID, ctx, meta)
+			if err != nil && replica != nil {
+				r.log.Printf("Failed to collect shuffled values of %s from %s, using the replica: %s", plan.JobID, nodeID, err)
+				c := <-replica
+				if c.err == nil {
+					result, err = c.result, nil
+				}
+			}
+			results <- collected{result: result, err: err}
+		}(nodeID)
+	}
+
+	var err error
+	for range plan.Nodes {
+		c := <-results
+		if c.err != nil {
+			err = c.err
+			continue
+		}
+
+		if err == nil {
+			err = f(c.result)
+		}
+	}
+	return err
+}
+
+// collectReduced collects the values that the nodes reduced and streams
+// them.
+func (r MapReduce) collectReduced(plan ShufflePlan, algName string, ctx context.Context, meta []byte, stream chan<- KeyedResult) (Results, error) {
+	finalResult := make(Results)
+	err := r.collect(plan, algName, ctx, meta, func(result map[string][]byte) error {
+		for key, value := range result {
+			finalResult[key] = value
+			if stream == nil {
+				continue
+			}
+
+			select {
+			case stream <- KeyedResult{Key: key, Value: value, Values: [][]byte{value}}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return finalResult, nil
+}
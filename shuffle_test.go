@@ -0,0 +1,238 @@
+package mapreduce_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TSH struct {
+	*testing.T
+	network *shuffleNetwork
+	mr      mapreduce.MapReduce
+}
+
+func TestShuffle(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TSH {
+		fs := fsfakes.NewInMemory("id-a", "id-b")
+		fs.Write("file-a", []byte("x"), []byte("y"), []byte("x"))
+		fs.Write("file-b", []byte("x"), []byte("z"))
+		fs.SetNodes("file-a", "id-a")
+		fs.SetNodes("file-b", "id-b")
+		fs.Write("stuck-a", []byte("x"))
+		fs.Write("stuck-b", []byte("x"))
+		fs.SetNodes("stuck-a", "id-a")
+		fs.SetNodes("stuck-b", "id-b")
+
+		algs := mapreduce.AlgFetcherMap{
+			"count": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), []byte{1}, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					var sum byte
+					for _, v := range values {
+						sum += v[0]
+					}
+					return [][]byte{{sum}}, nil
+				}),
+			},
+			"stuck": {
+				Mapper: mapreduce.MapFunc(func(value []byte) (string, []byte, error) {
+					return string(value), value, nil
+				}),
+				Reducer: mapreduce.ReduceFunc(func(values [][]byte) ([][]byte, error) {
+					return values, nil
+				}),
+			},
+		}
+
+		network := &shuffleNetwork{
+			executors: make(map[string]*mapreduce.Executor),
+		}
+		for _, id := range []string{"id-a", "id-b", "id-c"} {
+			network.executors[id] = mapreduce.NewExecutor(algs, fs, mapreduce.WithShuffler(network, nil))
+		}
+
+		return TSH{
+			T:       t,
+			network: network,
+			mr:      mapreduce.New(fs, network, algs, mapreduce.WithShuffle()),
+		}
+	})
+
+	o.Spec("it reduces the shuffled values", func(t TSH) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{
+			"x": {3},
+			"y": {1},
+			"z": {1},
+		}))
+	})
+
+	o.Spec("it sends each key to a single node", func(t TSH) {
+		_, err := t.mr.Calculate("file", "count", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+
+		Expect(t, t.network.returned).To(Equal(0))
+		Expect(t, t.network.keyNodes["x"]).To(HaveLen(1))
+	})
+
+	o.Spec("it only sends keys to the nodes that reduce", func(t TSH) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithRoles(map[string]mapreduce.Role{
+			"id-a": mapreduce.MapOnly,
+			"id-b": mapreduce.MapOnly,
+			"id-c": mapreduce.ReduceOnly,
+		}))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(HaveLen(3))
+
+		for _, nodes := range t.network.keyNodes {
+			Expect(t, nodes).To(Equal(map[string]bool{"id-c": true}))
+		}
+	})
+
+	o.Spec("it returns an error if no node reduces", func(t TSH) {
+		_, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithRoles(map[string]mapreduce.Role{
+			"id-a": mapreduce.MapOnly,
+			"id-b": mapreduce.MapOnly,
+		}))
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it reduces on the nodes", func(t TSH) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithRemoteReduce())
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results).To(Equal(mapreduce.Results{
+			"x": {3},
+			"y": {1},
+			"z": {1},
+		}))
+	})
+
+	o.Spec("it streams the values reduced on the nodes", func(t TSH) {
+		stream, err := t.mr.CalculateStream("file", "count", context.Background(), nil, mapreduce.WithRemoteReduce())
+		Expect(t, err == nil).To(BeTrue())
+
+		results := make(map[string][]byte)
+		for result := range stream {
+			Expect(t, result.Err == nil).To(BeTrue())
+			results[result.Key] = result.Value
+		}
+		Expect(t, results).To(HaveLen(3))
+	})
+
+	o.Spec("it bounds the reduce iterations on the nodes", func(t TSH) {
+		_, err := t.mr.Calculate("stuck", "stuck", context.Background(), nil, mapreduce.WithRemoteReduce(), mapreduce.WithMaxReduceIterations(3))
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Spec("it leaves the convergence of the shuffled values to the coordinator", func(t TSH) {
+		results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithConvergence(func(values [][]byte) bool {
+			return len(values) <= 3
+		}))
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, results.Values("x")).To(Equal([][]byte{{1}, {1}, {1}}))
+		Expect(t, results.Values("y")).To(Equal([][]byte{{1}}))
+	})
+
+	o.Spec("it does not combine a convergence predicate with reducing on the nodes", func(t TSH) {
+		_, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithRemoteReduce(), mapreduce.WithConvergence(func(values [][]byte) bool {
+			return true
+		}))
+		Expect(t, err == nil).To(BeFalse())
+	})
+
+	o.Group("when the shuffled values are replicated", func() {
+		o.Spec("it collects the replica of a failed node", func(t TSH) {
+			t.network.down = "id-a"
+			results, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithShuffleReplication())
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, results).To(Equal(mapreduce.Results{
+				"x": {3},
+				"y": {1},
+				"z": {1},
+			}))
+		})
+
+		o.Spec("it sends each key to a second node", func(t TSH) {
+			_, err := t.mr.Calculate("file", "count", context.Background(), nil, mapreduce.WithShuffleReplication())
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, t.network.keyNodes["x"]).To(HaveLen(2))
+		})
+
+		o.Spec("it fails without replicas", func(t TSH) {
+			t.network.down = "id-a"
+			_, err := t.mr.Calculate("file", "count", context.Background(), nil)
+			Expect(t, err == nil).To(BeFalse())
+		})
+	})
+
+	o.Spec("it returns an error if the Network cannot shuffle", func(t TSH) {
+		mr := mapreduce.New(fsfakes.NewInMemory(), newMockNetwork(), mapreduce.AlgFetcherMap{}, mapreduce.WithShuffle())
+		_, err := mr.Calculate("file", "count", context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
+
+// shuffleNetwork runs the Executor of each node in-process.
+type shuffleNetwork struct {
+	executors map[string]*mapreduce.Executor
+
+	// down fails every Collect on the node.
+	down string
+
+	mu       sync.Mutex
+	returned int
+	keyNodes map[string]map[string]bool
+}
+
+func (n *shuffleNetwork) Execute(file, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	result, err := n.executors[nodeID].Execute(file, algName, ctx, meta)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.returned += len(result)
+	return result, err
+}
+
+func (n *shuffleNetwork) Shuffle(jobID, task, nodeID string, ctx context.Context, values map[string][]byte) error {
+	e, ok := n.executors[nodeID]
+	if !ok {
+		return fmt.Errorf("unknown node %s", nodeID)
+	}
+
+	n.mu.Lock()
+	if n.keyNodes == nil {
+		n.keyNodes = make(map[string]map[string]bool)
+	}
+	for key := range values {
+		if n.keyNodes[key] == nil {
+			n.keyNodes[key] = make(map[string]bool)
+		}
+		n.keyNodes[key][nodeID] = true
+	}
+	n.mu.Unlock()
+
+	e.Receive(jobID, task, values)
+	return nil
+}
+
+func (n *shuffleNetwork) Collect(jobID, algName, nodeID string, ctx context.Context, meta []byte) (map[string][]byte, error) {
+	if nodeID == n.down {
+		return nil, fmt.Errorf("node %s is down", nodeID)
+	}
+	return n.executors[nodeID].Collect(jobID, algName, ctx, meta)
+}
@@ -0,0 +1,40 @@
+package mapreduce
+
+import "golang.org/x/net/context"
+
+type sideInputsKey struct{}
+
+// WithSideInput makes the given data available to every Mapper under the
+// given name. It is meant for small data sets (e.g., lookup tables) that
+// each node needs in full. Mappers read it via SideInput().
+func WithSideInput(name string, data []byte) MapReduceOption {
+	return func(r *MapReduce) {
+		sideInputs := make(map[string][]byte)
+		for n, d := range r.sideInputs {
+			sideInputs[n] = d
+		}
+		sideInputs[name] = data
+		r.sideInputs = sideInputs
+	}
+}
+
+// SideInput returns the named side input that was configured via
+// WithSideInput().
+func SideInput(ctx context.Context, name string) (data []byte, ok bool) {
+	data, ok = SideInputs(ctx)[name]
+	return data, ok
+}
+
+// SideInputs returns every side input stored in the context. A Network
+// implementation uses it to ship the side inputs to the remote node.
+func SideInputs(ctx context.Context) map[string][]byte {
+	sideInputs, _ := ctx.Value(sideInputsKey{}).(map[string][]byte)
+	return sideInputs
+}
+
+// WithSideInputs returns a context that stores the given side inputs. A
+// Network implementation uses it on the remote node before invoking the
+// Executor.
+func WithSideInputs(ctx context.Context, sideInputs map[string][]byte) context.Context {
+	return context.WithValue(ctx, sideInputsKey{}, sideInputs)
+}
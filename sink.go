@@ -0,0 +1,176 @@
+package mapreduce
+
+// fileSink receives the result of an assignment in batches as its node sends
+// them (see StreamNetwork). Each batch is merged into the calculation right
+// away and taken out again if the attempt fails or another attempt at the
+// same assignment wins (see WithSpeculation). A sink is used by a single
+// goroutine at a time.
+type fileSink struct {
+	a      assignment
+	events chan<- sinkEvent
+	stop   <-chan struct{}
+
+	// hashes holds the hash of each key of the result for WithCrossCheck. It
+	// is nil unless the calculation is cross-checked.
+	hashes map[string][]byte
+
+	// keys and committed are only used by the merger.
+	keys      map[string]bool
+	committed bool
+}
+
+// sinkEvent is a batch of a sink, or the request to discard its batches.
+type sinkEvent struct {
+	sink    *fileSink
+	nodeID  string
+	batch   map[string][]byte
+	discard bool
+}
+
+// emit merges a batch that the node sent. It returns once the merger took
+// the batch, or once the calculation stopped merging.
+func (s *fileSink) emit(nodeID string, batch map[string][]byte) {
+	if s.hashes != nil {
+		for key, value := range batch {
+			s.hashes[key] = entryHash(key, value)
+		}
+	}
+
+	select {
+	case s.events <- sinkEvent{sink: s, nodeID: nodeID, batch: batch}:
+	case <-s.stop:
+	}
+}
+
+// discard takes the batches that were emitted so far out of the
+// calculation. The sink may be used for another attempt afterwards.
+func (s *fileSink) discard() {
+	if s.hashes != nil {
+		s.hashes = make(map[string][]byte)
+	}
+
+	select {
+	case s.events <- sinkEvent{sink: s, discard: true}:
+	case <-s.stop:
+	}
+}
+
+// digest returns the digest of the result that was emitted.
+func (s *fileSink) digest() []byte {
+	return digest(s.hashes)
+}
+
+// merger holds the values of each key of a calculation along with the sink
+// that each value came from, so that the values of an attempt can be taken
+// out again. Values without a sink were merged before the calculation was
+// resumed (see WithCheckpoints).
+type merger struct {
+	values map[string][][]byte
+	owners map[string][]*fileSink
+	sinks  map[string][]*fileSink
+}
+
+func newMerger(values map[string][][]byte) *merger {
+	m := &merger{
+		values: make(map[string][][]byte, len(values)),
+		owners: make(map[string][]*fileSink, len(values)),
+		sinks:  make(map[string][]*fileSink),
+	}
+
+	for key, v := range values {
+		m.values[key] = v
+		m.owners[key] = make([]*fileSink, len(v))
+	}
+	return m
+}
+
+// add merges the values of a key that the sink emitted. Values the sink
+// emitted for the key before are replaced, as the Network replayed the call
+// (see StreamNetwork).
+func (m *merger) add(s *fileSink, key string, values [][]byte) {
+	if s.keys == nil {
+		s.keys = make(map[string]bool)
+		m.sinks[s.a.key] = append(m.sinks[s.a.key], s)
+	}
+
+	if s.keys[key] {
+		m.remove(s, key)
+	}
+	s.keys[key] = true
+
+	for _, value := range values {
+		m.values[key] = append(m.values[key], value)
+		m.owners[key] = append(m.owners[key], s)
+	}
+}
+
+// discard removes every value of the sink.
+func (m *merger) discard(s *fileSink) {
+	for key := range s.keys {
+		m.remove(s, key)
+	}
+
+	if s.keys != nil {
+		s.keys = make(map[string]bool)
+	}
+}
+
+// commit keeps the values of the sink and discards the ones of every other
+// attempt at the same assignment. It returns the keys of the sink.
+func (m *merger) commit(s *fileSink) map[string]bool {
+	s.committed = true
+	for _, other := range m.sinks[s.a.key] {
+		if other != s {
+			m.discard(other)
+		}
+	}
+	delete(m.sinks, s.a.key)
+	return s.keys
+}
+
+// abandon discards the values of every attempt at the assignment.
+func (m *merger) abandon(key string) {
+	for _, s := range m.sinks[key] {
+		m.discard(s)
+	}
+	delete(m.sinks, key)
+}
+
+// remove removes the values of the key that the sink emitted.
+func (m *merger) remove(s *fileSink, key string) {
+	values, owners := m.values[key], m.owners[key]
+
+	n := 0
+	for i, owner := range owners {
+		if owner == s {
+			continue
+		}
+		values[n], owners[n] = values[i], owner
+		n++
+	}
+
+	for i := n; i < len(values); i++ {
+		values[i], owners[i] = nil, nil
+	}
+
+	if n == 0 {
+		delete(m.values, key)
+		delete(m.owners, key)
+		return
+	}
+	m.values[key], m.owners[key] = values[:n], owners[:n]
+}
+
+// committed returns the values of the attempts that were committed, which
+// are the ones a checkpoint may hold.
+func (m *merger) committed() map[string][][]byte {
+	values := make(map[string][][]byte, len(m.values))
+	for key, v := range m.values {
+		for i, owner := range m.owners[key] {
+			if owner == nil || owner.committed {
+				values[key] = append(values[key], v[i])
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,174 @@
+package mapreduce
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// WithSpeculation launches a duplicate of a file (or split) that runs longer
+// than factor times the median duration of the files that already finished.
+// The duplicate runs on an idle node that has the file as well. Whichever
+// finishes first is used and the other one is canceled. The counters include
+// the work of both.
+func WithSpeculation(factor float64) MapReduceOption {
+	return func(r *MapReduce) {
+		r.speculation = factor
+	}
+}
+
+// attempt is the outcome of executing an assignment on a node.
+type attempt struct {
+	sink   *fileSink
+	nodeID string
+	err    error
+}
+
+// speculate executes the assignment and launches a duplicate once it is
+// considered a straggler. Each attempt emits its result to a sink of its
+// own, and the batches of an attempt that fails are discarded. It returns
+// the sink of the attempt that succeeded first.
+func (r MapReduce) speculate(a assignment, algName string, ctx context.Context, meta []byte, failed *nodeSet, s *stragglers, newSink func() *fileSink) (*fileSink, string, error) {
+	execute := func(a assignment) attempt {
+		sink := newSink()
+		nodeID, err := r.execute(a, algName, ctx, meta, failed, sink)
+		if err != nil {
+			sink.discard()
+		}
+		return attempt{sink: sink, nodeID: nodeID, err: err}
+	}
+
+	if s.factor <= 0 {
+		at := execute(a)
+		return at.sink, at.nodeID, at.err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attempts := make(chan attempt, 2)
+	run := func(a assignment) {
+		start := time.Now()
+		s.start(a.nodeID)
+		at := execute(a)
+		s.finish(a.nodeID, time.Since(start), at.err == nil)
+		attempts <- at
+	}
+
+	start := time.Now()
+	go run(a)
+	pending := 1
+	speculated := false
+
+	for {
+		var changed <-chan struct{}
+		var timeout <-chan time.Time
+		if !speculated {
+			var threshold time.Duration
+			threshold, changed = s.threshold()
+
+			elapsed := time.Since(start)
+			if threshold > 0 && elapsed >= threshold {
+				if nodeID, ok := s.idle(a.nodes, a.nodeID, failed); ok {
+					r.log.Printf("Calculation for file %s on %s is a straggler, launching a duplicate on %s", a.file, a.nodeID, nodeID)
+					duplicate := a
+					duplicate.nodeID = nodeID
+					go run(duplicate)
+					pending++
+					speculated = true
+					changed = nil
+				}
+			} else if threshold > 0 {
+				timeout = time.After(threshold - elapsed)
+			}
+		}
+
+		select {
+		case at := <-attempts:
+			pending--
+			if at.err != nil && pending > 0 {
+				continue
+			}
+			return at.sink, at.nodeID, at.err
+		case <-changed:
+		case <-timeout:
+		}
+	}
+}
+
+// stragglers keeps track of how long the files of a calculation take and
+// which nodes are busy.
+type stragglers struct {
+	factor float64
+
+	mu        sync.Mutex
+	durations []time.Duration
+	running   map[string]int
+	changed   chan struct{}
+}
+
+func newStragglers(factor float64) *stragglers {
+	return &stragglers{
+		factor:  factor,
+		running: make(map[string]int),
+		changed: make(chan struct{}),
+	}
+}
+
+func (s *stragglers) start(nodeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[nodeID]++
+}
+
+// finish records that the node is done with a file. Only successful
+// durations count towards the median.
+func (s *stragglers) finish(nodeID string, d time.Duration, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running[nodeID]--
+	if ok {
+		s.durations = append(s.durations, d)
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// threshold returns the duration after which a file is a straggler. It is
+// zero until a file finished. The channel is closed once it might change.
+func (s *stragglers) threshold() (time.Duration, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.durations) == 0 {
+		return 0, s.changed
+	}
+
+	durations := append([]time.Duration(nil), s.durations...)
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	median := durations[len(durations)/2]
+
+	threshold := time.Duration(float64(median) * s.factor)
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return threshold, s.changed
+}
+
+// idle returns a node that is not busy and has not failed.
+func (s *stragglers) idle(ids []string, exclude string, failed *nodeSet) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if id == exclude || s.running[id] > 0 || failed.has(id) {
+			continue
+		}
+		return id, true
+	}
+	return "", false
+}
@@ -0,0 +1,38 @@
+package mapreduce
+
+import "golang.org/x/net/context"
+
+type splitKey struct{}
+
+// Split is a byte range of a file. A node calculates the records that start
+// within the range.
+type Split struct {
+	// Start is the offset of the first byte of the range.
+	Start uint64
+
+	// End is the offset just past the last byte of the range.
+	End uint64
+}
+
+// WithSplitSize calculates files larger than n bytes in several splits of
+// n bytes each, so that a large file is spread across several nodes. The
+// FileSystem has to implement StatFileSystem and RangeFileSystem.
+func WithSplitSize(n uint64) MapReduceOption {
+	return func(r *MapReduce) {
+		r.splitSize = n
+	}
+}
+
+// SplitFrom returns the split of the file that is calculated with the given
+// context. It returns false if the whole file is calculated. A Network
+// implementation uses it to ship the split to the remote node.
+func SplitFrom(ctx context.Context) (split Split, ok bool) {
+	split, ok = ctx.Value(splitKey{}).(Split)
+	return split, ok
+}
+
+// WithSplit returns a context that stores the given split. A Network
+// implementation uses it on the remote node before invoking the Executor.
+func WithSplit(ctx context.Context, split Split) context.Context {
+	return context.WithValue(ctx, splitKey{}, split)
+}
@@ -0,0 +1,106 @@
+package mapreduce
+
+import (
+	"sort"
+	"sync"
+)
+
+// WithWorkStealing calculates at most slots files (or splits) on each node at
+// the same time and queues the rest on their assigned node. A node with a
+// free slot and an empty queue steals an unstarted file from the longest
+// queue that holds a file it has as well. Uneven files then do not leave
+// most of the nodes idle while one of them works through its queue. By
+// default every file is started on its assigned node at once.
+func WithWorkStealing(slots int) MapReduceOption {
+	return func(r *MapReduce) {
+		r.stealing = slots
+	}
+}
+
+// workQueues holds the unstarted assignments of each node.
+type workQueues struct {
+	mu     sync.Mutex
+	queues map[string][]assignment
+	log    Log
+}
+
+func newWorkQueues(assignments []assignment, log Log) *workQueues {
+	q := &workQueues{
+		queues: make(map[string][]assignment),
+		log:    log,
+	}
+
+	for _, a := range assignments {
+		q.queues[a.nodeID] = append(q.queues[a.nodeID], a)
+		for _, id := range a.nodes {
+			if _, ok := q.queues[id]; !ok {
+				q.queues[id] = nil
+			}
+		}
+	}
+	return q
+}
+
+// nodes returns every node that is able to take on an assignment.
+func (q *workQueues) nodes() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ids []string
+	for id := range q.queues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// next returns the next assignment of the node. Once its own queue is empty,
+// it steals the last assignment that the node is eligible for from the
+// longest queue. It returns false if there is nothing left.
+func (q *workQueues) next(nodeID string) (assignment, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if queue := q.queues[nodeID]; len(queue) > 0 {
+		q.queues[nodeID] = queue[1:]
+		return queue[0], true
+	}
+
+	var (
+		victim string
+		index  = -1
+	)
+	for id, queue := range q.queues {
+		if index >= 0 && len(queue) <= len(q.queues[victim]) {
+			continue
+		}
+
+		for i := len(queue) - 1; i >= 0; i-- {
+			if contains(queue[i].nodes, nodeID) {
+				victim, index = id, i
+				break
+			}
+		}
+	}
+
+	if index < 0 {
+		return assignment{}, false
+	}
+
+	queue := q.queues[victim]
+	a := queue[index]
+	q.queues[victim] = append(queue[:index:index], queue[index+1:]...)
+	q.log.Printf("Node %s steals file %s from %s", nodeID, a.file, victim)
+
+	a.nodeID = nodeID
+	return a, true
+}
+
+func contains(ids []string, id string) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package mapreduce
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// WithOutputFile stores the results of a calculation in the given file via
+// Store() once the calculation has finished, so that they end up in the same
+// storage as its input. A calculation whose results cannot be stored fails.
+// The FileSystem has to be a WriteFileSystem.
+func WithOutputFile(file string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.outputFile = file
+	}
+}
+
+// Store writes the results to the given file so that they can be loaded
+// later via Load() instead of being calculated again. The FileSystem has to
+// be a WriteFileSystem.
+func (r MapReduce) Store(file string, results Results, ctx context.Context, meta []byte) error {
+	fs, ok := r.fs.(WriteFileSystem)
+	if !ok {
+		return fmt.Errorf("file system does not support writing")
+	}
+
+	writer, close, err := fs.Writer(file, ctx, meta)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range results.SortedKeys() {
+		if err := writer(Results{key: results[key]}.ToProto()); err != nil {
+			close()
+			return err
+		}
+	}
+
+	return close()
+}
+
+// Load reads results that were written via Store().
+func (r MapReduce) Load(file string, ctx context.Context, meta []byte) (Results, error) {
+	reader, err := r.fs.Reader(file, ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(Results)
+	for {
+		data, err := reader()
+		if err == io.EOF {
+			return results, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := ResultsFromProto(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record in %s: %s", file, err)
+		}
+
+		for key, value := range record {
+			results[key] = value
+		}
+	}
+}
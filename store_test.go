@@ -0,0 +1,122 @@
+package mapreduce_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/poy/mapreduce"
+	"github.com/poy/mapreduce/fs/fsfakes"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TS struct {
+	*testing.T
+	records             *[][]byte
+	mockWriteFileSystem *mockWriteFileSystem
+	mr                  mapreduce.MapReduce
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) TS {
+		mockWriteFileSystem := newMockWriteFileSystem()
+
+		return TS{
+			T:                   t,
+			records:             &[][]byte{},
+			mockWriteFileSystem: mockWriteFileSystem,
+			mr:                  mapreduce.New(mockWriteFileSystem, newMockNetwork(), newMockAlgorithmFetcher()),
+		}
+	})
+
+	o.Group("when the file system does not return an error", func() {
+		o.BeforeEach(func(t TS) TS {
+			t.mockWriteFileSystem.WriterOutput.Writer <- func(data []byte) error {
+				*t.records = append(*t.records, data)
+				return nil
+			}
+			t.mockWriteFileSystem.WriterOutput.Close <- func() error {
+				records := *t.records
+				t.mockWriteFileSystem.ReaderOutput.Reader <- func() ([]byte, error) {
+					if len(records) == 0 {
+						return nil, io.EOF
+					}
+					defer func() { records = records[1:] }()
+					return records[0], nil
+				}
+				return nil
+			}
+			close(t.mockWriteFileSystem.WriterOutput.Err)
+			close(t.mockWriteFileSystem.ReaderOutput.Err)
+			return t
+		})
+
+		o.Spec("it loads what it stores", func(t TS) {
+			results := mapreduce.Results{
+				"key-a": []byte("value-a"),
+				"key-b": []byte("value-b"),
+			}
+			err := t.mr.Store("some-file", results, context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+
+			loaded, err := t.mr.Load("some-file", context.Background(), nil)
+			Expect(t, err == nil).To(BeTrue())
+			Expect(t, loaded).To(Equal(results))
+		})
+
+		o.Spec("it uses the given file", func(t TS) {
+			t.mr.Store("some-file", mapreduce.Results{}, context.Background(), nil)
+			Expect(t, t.mockWriteFileSystem.WriterInput.File).To(Chain(
+				Receive(), Equal("some-file"),
+			))
+		})
+	})
+
+	o.Group("when the file system returns an error", func() {
+		o.BeforeEach(func(t TS) TS {
+			close(t.mockWriteFileSystem.WriterOutput.Writer)
+			close(t.mockWriteFileSystem.WriterOutput.Close)
+			t.mockWriteFileSystem.WriterOutput.Err <- fmt.Errorf("some-error")
+			return t
+		})
+
+		o.Spec("it returns an error", func(t TS) {
+			err := t.mr.Store("some-file", mapreduce.Results{}, context.Background(), nil)
+			Expect(t, err == nil).To(BeFalse())
+		})
+	})
+
+	o.Spec("it stores the results of a calculation in the output file", func(t TS) {
+		fs := fsfakes.NewInMemory("id-a")
+		fs.Write("some-input")
+
+		mockNetwork := newMockNetwork()
+		mockNetwork.ExecuteOutput.Result <- map[string][]byte{"key-a": []byte("value-a")}
+		close(mockNetwork.ExecuteOutput.Err)
+
+		mockAlgFetcher := newMockAlgorithmFetcher()
+		mockAlgFetcher.AlgOutput.Alg <- mapreduce.Algorithm{Mapper: newMockMapper(), Reducer: newMockReducer()}
+		close(mockAlgFetcher.AlgOutput.Err)
+
+		mr := mapreduce.New(fs, mockNetwork, mockAlgFetcher)
+		results, err := mr.Calculate("some-input", "some-alg", context.Background(), nil, mapreduce.WithOutputFile("some-output"))
+		Expect(t, err == nil).To(BeTrue())
+
+		loaded, err := mr.Load("some-output", context.Background(), nil)
+		Expect(t, err == nil).To(BeTrue())
+		Expect(t, loaded).To(Equal(results))
+	})
+
+	o.Spec("it returns an error when the file system cannot write", func(t TS) {
+		mr := mapreduce.New(newMockFileSystem(), newMockNetwork(), newMockAlgorithmFetcher())
+		err := mr.Store("some-file", mapreduce.Results{}, context.Background(), nil)
+		Expect(t, err == nil).To(BeFalse())
+	})
+}
@@ -0,0 +1,56 @@
+package mapreduce
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// VersionMismatchError is returned when a node runs a different version of
+// an algorithm (see Algorithm.Version), or of the protocol of a Network,
+// than the coordinator.
+type VersionMismatchError struct {
+	// Name is the name of the algorithm or the protocol.
+	Name string
+
+	// Coordinator is the version of the coordinator.
+	Coordinator string
+
+	// Node is the version of the node.
+	Node string
+}
+
+// Error implements error.
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("version mismatch for %s: coordinator has %q, node has %q", e.Name, e.Coordinator, e.Node)
+}
+
+type algorithmVersionKey struct{}
+
+// WithAlgorithmVersion returns a context that carries the coordinator's
+// version of the algorithm.
+func WithAlgorithmVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, algorithmVersionKey{}, version)
+}
+
+// AlgorithmVersionFrom returns the coordinator's version of the algorithm
+// that is stored in the context.
+func AlgorithmVersionFrom(ctx context.Context) (string, bool) {
+	version, ok := ctx.Value(algorithmVersionKey{}).(string)
+	return version, ok
+}
+
+// checkVersion returns a VersionMismatchError if the coordinator has a
+// different version of the algorithm.
+func checkVersion(algName string, alg Algorithm, ctx context.Context) error {
+	version, ok := AlgorithmVersionFrom(ctx)
+	if !ok || version == alg.Version {
+		return nil
+	}
+
+	return &VersionMismatchError{
+		Name:        algName,
+		Coordinator: version,
+		Node:        alg.Version,
+	}
+}
@@ -0,0 +1,167 @@
+package mapreduce
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Zones reports the zone of the nodes. A zone is named after its region and
+// itself, separated by a slash (e.g., "us-east1/us-east1-b"), so that nodes
+// of different zones in the same region are told apart from the ones of
+// other regions. It has to be safe for concurrent use.
+type Zones interface {
+	// Zones returns the zone of each node ID. A node that is missing is in an
+	// unknown zone, which is treated as another region.
+	Zones(ctx context.Context) (map[string]string, error)
+}
+
+// ZonesFunc wraps a function into a Zones.
+type ZonesFunc func(ctx context.Context) (map[string]string, error)
+
+// Zones implements Zones.
+func (f ZonesFunc) Zones(ctx context.Context) (map[string]string, error) {
+	return f(ctx)
+}
+
+// StaticZones returns a Zones that always reports the given zones.
+func StaticZones(zones map[string]string) Zones {
+	return ZonesFunc(func(ctx context.Context) (map[string]string, error) {
+		return zones, nil
+	})
+}
+
+// TransferBytesCounter returns the counter that holds the bytes the
+// coordinator received from the nodes of the zone (see WithZones). The
+// counter of the nodes of an unknown zone is TransferBytesCounter("").
+func TransferBytesCounter(zone string) string {
+	if zone == "" {
+		zone = "unknown"
+	}
+	return "mapreduce.transfer-bytes." + zone
+}
+
+// WithZones makes the calculation aware of the zones that z reports when the
+// calculation is started, with the coordinator in the given zone. Files are
+// assigned to the nodes that have them in the same zone as the coordinator
+// if possible, otherwise in the same region. With WithShuffle, the keys are
+// only partitioned across the reducing nodes of the nearest zone, so that
+// the shuffled values stay close to the coordinator that collects them. The
+// bytes that the coordinator receives from the nodes of each zone are
+// counted (see TransferBytesCounter).
+func WithZones(z Zones, zone string) MapReduceOption {
+	return func(r *MapReduce) {
+		r.zones = z
+		r.zone = zone
+	}
+}
+
+// WithCrossRegionLimit fails a calculation with a *CrossRegionLimitError
+// once the coordinator received more than the given bytes from the nodes of
+// other regions (see WithZones).
+func WithCrossRegionLimit(bytes int64) MapReduceOption {
+	return func(r *MapReduce) {
+		r.crossRegionLimit = bytes
+	}
+}
+
+// CrossRegionLimitError is returned when a calculation transferred more
+// bytes across regions than WithCrossRegionLimit allows.
+type CrossRegionLimitError struct {
+	Limit       int64
+	Transferred int64
+}
+
+// Error implements error.
+func (e *CrossRegionLimitError) Error() string {
+	return fmt.Sprintf("transferred %d bytes across regions, limit is %d", e.Transferred, e.Limit)
+}
+
+// resolveZones looks up the zones of the nodes. It returns nil if there is
+// no Zones.
+func (r MapReduce) resolveZones(ctx context.Context) (map[string]string, error) {
+	if r.zones == nil {
+		return nil, nil
+	}
+
+	zones, err := r.zones.Zones(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if zones == nil {
+		zones = make(map[string]string)
+	}
+	return zones, nil
+}
+
+// distance returns how far the node is from the coordinator: 0 within the
+// same zone, 1 within the same region and 2 otherwise.
+func (r MapReduce) distance(nodeID string) int {
+	zone, ok := r.nodeZones[nodeID]
+	switch {
+	case !ok || zone == "":
+		return 2
+	case zone == r.zone:
+		return 0
+	case region(zone) == region(r.zone):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// nearestNodes returns the nodes that are nearest to the coordinator. The
+// nodes are returned as they are if the zones are not known.
+func (r MapReduce) nearestNodes(nodeIDs []string) []string {
+	if r.nodeZones == nil {
+		return nodeIDs
+	}
+
+	var nearest []string
+	best := -1
+	for _, id := range nodeIDs {
+		d := r.distance(id)
+		switch {
+		case best < 0 || d < best:
+			nearest, best = []string{id}, d
+		case d == best:
+			nearest = append(nearest, id)
+		}
+	}
+	return nearest
+}
+
+// transferred counts the bytes of a result that the coordinator received
+// from the node. It returns a *CrossRegionLimitError once the bytes that
+// were received from other regions (crossRegion) exceed the limit.
+func (r MapReduce) transferred(job *Job, nodeID string, result map[string][]byte, crossRegion *int64) error {
+	if r.nodeZones == nil {
+		return nil
+	}
+
+	var size int64
+	for key, value := range result {
+		size += int64(len(key) + len(value))
+	}
+	job.counters.Add(TransferBytesCounter(r.nodeZones[nodeID]), size)
+
+	if r.distance(nodeID) < 2 {
+		return nil
+	}
+
+	*crossRegion += size
+	if r.crossRegionLimit > 0 && *crossRegion > r.crossRegionLimit {
+		return &CrossRegionLimitError{Limit: r.crossRegionLimit, Transferred: *crossRegion}
+	}
+	return nil
+}
+
+// region returns the region of the zone.
+func region(zone string) string {
+	if i := strings.Index(zone, "/"); i >= 0 {
+		return zone[:i]
+	}
+	return zone
+}